@@ -6,15 +6,19 @@ import (
 	"log"
 	"os/signal"
 	"syscall"
-	"time"
 
 	"github.com/STTM-NSU/trading-bot/internal/backtest"
+	"github.com/STTM-NSU/trading-bot/internal/backtest/engine"
 	"github.com/STTM-NSU/trading-bot/internal/config"
+	"github.com/STTM-NSU/trading-bot/internal/invest/broker"
 	"github.com/STTM-NSU/trading-bot/internal/invest/instrument"
 	"github.com/STTM-NSU/trading-bot/internal/invest/md"
 	"github.com/STTM-NSU/trading-bot/internal/invest/techan"
 	"github.com/STTM-NSU/trading-bot/internal/logger"
+	"github.com/STTM-NSU/trading-bot/internal/model"
 	"github.com/STTM-NSU/trading-bot/internal/postgres"
+	"github.com/STTM-NSU/trading-bot/internal/signals"
+	"github.com/STTM-NSU/trading-bot/internal/strategy"
 	"github.com/STTM-NSU/trading-bot/internal/sttm"
 	"github.com/joho/godotenv"
 	"github.com/russianinvestments/invest-api-go-sdk/investgo"
@@ -68,67 +72,57 @@ func main() {
 	if err := cfg.Validate(); err != nil {
 		zapLogger.Fatalf("%s: config validation failed", err)
 	}
+	retrier := broker.NewRetrier(cfg.Retry, zapLogger)
 
-	candlesService := md.NewCandlesService(investClient, db, zapLogger)
-	instrumentsService := instrument.NewInstrumentsService(investClient, zapLogger)
-	techAnService := techan.NewTechAnalyseService(investClient, cfg.TechnicalIndicators, zapLogger)
-	sttmService := sttm.NewSTTMService(cfg.STTM, zapLogger)
+	candlesService := md.NewCandlesService(investClient, db, retrier, zapLogger)
+	instrumentsService := instrument.NewInstrumentsService(investClient, retrier, zapLogger)
+	techAnService := techan.NewAdjustedAnalyseService(candlesService, cfg.TechnicalIndicators)
+	sttmService := sttm.NewSTTMService(cfg.STTM, db, zapLogger)
+	signalProvider, err := signals.NewProvider(cfg.Signal, sttmService, candlesService)
+	if err != nil {
+		zapLogger.Fatalf("%s: can't create signal provider", err)
+	}
 
 	// собрать стартовый портфель на стартовую сумму - не надо, дождёмся пятницы
-	portfolio := backtest.NewPortfolio(zapLogger, cfg.StartAmountOfMoney[0].Value, candlesService)
-	executor := backtest.NewExecutor(zapLogger, cfg.Taxes, cfg.MarginTaxes, candlesService, portfolio, cfg.Orders)
-
-	tradingBot := backtest.NewTradingBot(
-		zapLogger, instrumentsService, cfg.Instruments, candlesService, techAnService,
-		sttmService, executor, cfg.Orders, portfolio, cfg.MarginTradingConfig,
-	)
-
-	intervals := backtest.SplitIntoWeeks(cfg.From.UTC(), cfg.To.UTC())
-	for i, interval := range intervals { // iterate over weeks
-		zapLogger.Infof("Interval: %v", interval)
-		zapLogger.Infof("Balance: %v", portfolio.GetBalance())
-		zapLogger.Infof("Balance with instruments: %v", portfolio.GetBalanceWithInstruments(interval.Start))
-		zapLogger.Infof("Portfolio: %v", portfolio.GetInstruments())
-		var lastDay time.Time
-		for _, h := range backtest.DivideIntoHours(interval.Start, interval.End) {
-			if ctx.Err() != nil {
-				break
-			}
-			if h.Weekday() == time.Saturday || h.Weekday() == time.Sunday {
-				continue
-			}
-
-			if lastDay != h.Truncate(24*time.Hour) {
-				zapLogger.Infof("Day: %v", h)
-				lastDay = h.Truncate(24 * time.Hour)
-			}
-
-			switch {
-			case h.Weekday() == time.Friday && h.Hour() == 18 && i == len(intervals)-1:
-				tradingBot.SellOutPortfolio()
-			case h.Weekday() == time.Friday && h.Hour() == 19:
-				tradingBot.SellOutRemaining()
-				tradingBot.BuyDeptMargin()
-			case h.Weekday() == time.Friday && h.Hour() == 20 && i != len(intervals)-1:
-				zapLogger.Infof("Rebalance on: %s", h)
-				if err := tradingBot.Rebalance(ctx, interval.Start, h); err != nil {
-					zapLogger.Errorf("%s: rebalance failed", err)
-				}
-				continue
-			}
-
-			if h.Hour() == 12 {
-				tradingBot.CheckTechIndicators(h)
-			}
-			tradingBot.ExecutorCheck(h)
-		}
+	portfolio := backtest.NewPortfolio(zapLogger, cfg.StartAmountOfMoney[0].Value, cfg.Taxes, candlesService)
+	slippage := backtest.NewSlippageModels(cfg.Slippage, candlesService)
+	ndfl := backtest.NewNDFL(zapLogger, cfg.NDFL)
+	cashFlows, err := loadCashFlows(cfg, instrumentsService)
+	if err != nil {
+		zapLogger.Fatalf("%s: can't load cash flows", err)
+	}
+	riskRates, err := loadRiskRates(cfg, instrumentsService)
+	if err != nil {
+		zapLogger.Fatalf("%s: can't load risk rates", err)
+	}
+	margin := backtest.NewMargin(cfg.MarginTaxes, riskRates, cfg.DefaultRiskRates)
+	executor := backtest.NewExecutor(zapLogger, cfg.Taxes, margin, slippage, cfg.MaxVolumeParticipation, ndfl,
+		backtest.NewCashFlows(zapLogger, cashFlows, cfg.CashFlows.Tax), candlesService, portfolio, cfg.Orders)
+
+	sttmStrategy := strategy.NewSTTM(zapLogger, instrumentsService, cfg.Instruments, candlesService,
+		strategy.CombinedSignals{Provider: signalProvider, Indicators: techAnService},
+		backtest.NewSimulatedExecution(executor), portfolio, cfg.STTM, cfg.Orders, cfg.MarginTradingConfig)
+	tradingBot := backtest.NewTradingBot(zapLogger, sttmStrategy, executor, portfolio)
+
+	eng := engine.NewEngine(zapLogger, cfg.STTM.CalculationInterval, cfg.From.UTC(), cfg.To.UTC())
+	eng.Register(tradingBot)
+	if cfg.PrewarmSTTM {
+		go prewarmSTTM(ctx, zapLogger, sttmService, instrumentsService, cfg, eng.RebalanceWindows())
+	}
+	if err := eng.Run(ctx); err != nil {
+		zapLogger.Errorf("%s: backtest interrupted", err)
 	}
 
 	zapLogger.Infof("Trading bot finished trades")
+	executor.Withdraw()
+	zapLogger.Infof("NDFL paid: %v", ndfl.Paid())
 	zapLogger.Infof("Balance: %v", portfolio.GetBalance())
-	zapLogger.Infof("Balance with instruments: %v", portfolio.GetBalanceWithInstruments(intervals[len(intervals)-1].End))
-	zapLogger.Infof("Profit: %v", portfolio.GetProfit(intervals[len(intervals)-1].End))
+	zapLogger.Infof("Balance with instruments: %v", portfolio.GetBalanceWithInstruments(eng.End()))
+	zapLogger.Infof("Profit: %v", portfolio.GetProfit(eng.End()))
 	zapLogger.Infof("Remaining portfolio: %v", portfolio.GetInstruments())
+	slippageCost, commissionCost := executor.GetCosts()
+	zapLogger.Infof("Slippage: %v Commission: %v", slippageCost, commissionCost)
+	zapLogger.Infof("Turnover [%s]: %v", cfg.STTM.CalculationInterval, executor.GetTurnover())
 
 	printInfo(tradingBot.GetInfo())
 
@@ -136,15 +130,84 @@ func main() {
 	zapLogger.Infoln("start graceful shutdown")
 }
 
+func loadCashFlows(cfg config.BacktestConfig, instrumentsService *instrument.InstrumentsService) ([]model.CashFlow, error) {
+	if !cfg.CashFlows.Enabled {
+		return nil, nil
+	}
+	if cfg.CashFlows.File != "" {
+		return instrument.LoadCashFlows(cfg.CashFlows.File)
+	}
+
+	instruments, err := instrumentsService.LoadInstruments(cfg.Instruments)
+	if err != nil {
+		return nil, fmt.Errorf("%w: can't load instruments", err)
+	}
+	return instrumentsService.GetCashFlows(instruments, cfg.From, cfg.To)
+}
+
+func loadRiskRates(cfg config.BacktestConfig, instrumentsService *instrument.InstrumentsService) (map[string]model.RiskRates, error) {
+	if !cfg.MarginTradingConfig.Enabled {
+		return nil, nil
+	}
+	if cfg.RiskRatesFile != "" {
+		return instrument.LoadRiskRates(cfg.RiskRatesFile)
+	}
+
+	instruments, err := instrumentsService.LoadInstruments(cfg.Instruments)
+	if err != nil {
+		return nil, fmt.Errorf("%w: can't load instruments", err)
+	}
+	return instrumentsService.GetInstrumentsRiskRates(instruments), nil
+}
+
+// prewarmSTTM caches sttm indexes of loaded instruments for all rebalances, so backtest and its reruns read them from db
+func prewarmSTTM(ctx context.Context, l logger.Logger, sttmService *sttm.STTMService,
+	instrumentsService *instrument.InstrumentsService, cfg config.BacktestConfig, rebalances []engine.Interval) {
+	instruments, err := instrumentsService.LoadInstruments(cfg.Instruments)
+	if err != nil {
+		l.Errorf("%s: can't load instruments for sttm prewarm", err)
+		return
+	}
+	ids := make([]string, 0, len(instruments))
+	for _, i := range instruments {
+		ids = append(ids, i.FIGI)
+	}
+
+	windows := make([]sttm.Window, 0, len(rebalances))
+	for _, r := range rebalances {
+		from, to := sttm.IndexWindow(r.Start, r.End)
+		windows = append(windows, sttm.Window{From: from, To: to})
+	}
+	if err := sttmService.Prewarm(ctx, windows, ids...); err != nil {
+		l.Errorf("%s: sttm prewarm is stopped", err)
+	}
+}
+
 func printInfo(info []backtest.IntervalProfit) {
 	for _, i := range info {
 		fmt.Printf("%f,", i.Balance)
 	}
 	fmt.Println()
+	for _, i := range info {
+		fmt.Printf("%f,", i.PreTaxBalance)
+	}
+	fmt.Println()
+	for _, i := range info {
+		fmt.Printf("%f,", i.PostTaxBalance)
+	}
+	fmt.Println()
 	for _, i := range info {
 		fmt.Printf("%f,", i.Profit)
 	}
 	fmt.Println()
+	for _, i := range info {
+		fmt.Printf("%f,", i.Slippage)
+	}
+	fmt.Println()
+	for _, i := range info {
+		fmt.Printf("%f,", i.Commission)
+	}
+	fmt.Println()
 	for _, i := range info {
 		fmt.Printf("%s,", i.Ts)
 	}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/STTM-NSU/trading-bot/internal/logger"
+	"github.com/STTM-NSU/trading-bot/internal/server"
+	"github.com/STTM-NSU/trading-bot/internal/sttm/stub"
+)
+
+// sttm-stub serves /get-index of sttm service from fixture or synthetic indexes for development and CI
+func main() {
+	var (
+		port    = flag.String("port", "8000", "port to listen")
+		fixture = flag.String("fixture", "", "json file with recorded indexes, synthetic indexes are served if empty")
+		seed    = flag.Uint64("seed", 0, "seed of synthetic indexes")
+		faults  stub.Faults
+	)
+	flag.IntVar(&faults.RateLimitEvery, "rate-limit-every", 0, "every n-th request gets 429")
+	flag.DurationVar(&faults.RetryAfter, "retry-after", time.Second, "retry after of 429 responses")
+	flag.IntVar(&faults.FailEvery, "fail-every", 0, "every n-th request gets 500")
+	flag.IntVar(&faults.DropEvery, "drop-every", 0, "every n-th instrument of request isn't answered")
+	flag.DurationVar(&faults.Latency, "latency", 0, "latency of every request")
+	flag.Parse()
+
+	zapLogger, loggerSync, err := logger.NewZapLogger(logger.Debug)
+	if err != nil {
+		log.Fatalf("%s: can't init logger", err)
+	}
+	defer loggerSync()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	var source stub.Source = stub.Synthetic{Seed: *seed}
+	if *fixture != "" {
+		if source, err = stub.LoadFixture(*fixture); err != nil {
+			zapLogger.Fatalf("%s: can't load fixture", err)
+		}
+	}
+
+	zapLogger.Infof("sttm stub is listening on :%s", *port)
+	s := server.NewHTTPServer(ctx, *port, stub.NewHandler(source, faults, zapLogger).Mux())
+	if err := s.Run(ctx); err != nil {
+		zapLogger.Errorf("%s: sttm stub stopped", err)
+	}
+}
@@ -2,18 +2,35 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"os/signal"
 	"syscall"
 
+	"github.com/STTM-NSU/trading-bot/internal/bot"
 	"github.com/STTM-NSU/trading-bot/internal/config"
+	"github.com/STTM-NSU/trading-bot/internal/invest/broker"
+	"github.com/STTM-NSU/trading-bot/internal/invest/executor"
+	"github.com/STTM-NSU/trading-bot/internal/invest/instrument"
+	"github.com/STTM-NSU/trading-bot/internal/invest/md"
+	"github.com/STTM-NSU/trading-bot/internal/invest/order"
+	"github.com/STTM-NSU/trading-bot/internal/invest/position"
+	"github.com/STTM-NSU/trading-bot/internal/invest/techan"
 	"github.com/STTM-NSU/trading-bot/internal/logger"
+	"github.com/STTM-NSU/trading-bot/internal/model"
+	"github.com/STTM-NSU/trading-bot/internal/paper"
+	"github.com/STTM-NSU/trading-bot/internal/portfolio"
+	"github.com/STTM-NSU/trading-bot/internal/postgres"
+	"github.com/STTM-NSU/trading-bot/internal/signals"
+	"github.com/STTM-NSU/trading-bot/internal/strategy"
+	"github.com/STTM-NSU/trading-bot/internal/sttm"
 	"github.com/joho/godotenv"
 	"github.com/russianinvestments/invest-api-go-sdk/investgo"
 )
 
 const (
 	_investCfgFilePath = "./configs/invest.yaml"
+	_cfgFilePath       = "./configs/config.yaml"
 )
 
 func main() {
@@ -30,20 +47,204 @@ func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
+	cfg, err := config.LoadTradingBotConfig(_cfgFilePath)
+	if err != nil {
+		zapLogger.Fatalf("%s: can't load trading bot cfg", err)
+	}
+	if len(cfg.StartAmountOfMoney) == 0 {
+		zapLogger.Fatalf("empty start amount of money")
+	}
+	currency := cfg.StartAmountOfMoney[0].Currency
+	retrier := broker.NewRetrier(cfg.Retry, zapLogger)
+
+	pgConfig := postgres.NewConfigFromEnv().Setup()
+	zapLogger.Debugf("trying to connect to db with: %s", pgConfig)
+	db, err := postgres.NewDB(pgConfig)
+	if err != nil {
+		zapLogger.Fatalf("%s: can't connect to db", err)
+	}
+
 	investCfg, err := config.LoadInvestConfig(_investCfgFilePath)
 	if err != nil {
 		zapLogger.Fatalf("%s: can't load invest cfg", err)
 	}
+	if investCfg.AccountId == "" {
+		zapLogger.Fatalf("empty account id in invest cfg")
+	}
+	accountID := investCfg.AccountId
 
 	investClient, err := investgo.NewClient(ctx, investCfg, zapLogger)
 	if err != nil {
 		zapLogger.Fatalf("%s: can't create invest client", err)
 	}
 
-	s := investClient.NewUsersServiceClient()
-	i, err := s.GetInfo()
+	candlesService := md.NewCandlesService(investClient, db, retrier, zapLogger)
+	instrumentsService := instrument.NewInstrumentsService(investClient, retrier, zapLogger)
+	positionsService := position.NewPositionsService(investClient, accountID, zapLogger)
+	techAnService := techan.NewTechAnalyseService(investClient, cfg.TechnicalIndicators, retrier, zapLogger)
+	sttmService := sttm.NewSTTMService(cfg.STTM, db, zapLogger)
+	signalProvider, err := signals.NewProvider(cfg.Signal, sttmService, candlesService)
+	if err != nil {
+		zapLogger.Fatalf("%s: can't create signal provider", err)
+	}
+
+	instruments, err := instrumentsService.LoadInstruments(cfg.Instruments)
 	if err != nil {
-		zapLogger.Fatalf("%s: can't get info", err)
+		zapLogger.Fatalf("%s: can't load instruments", err)
+	}
+	rates, err := loadRiskRates(cfg, instrumentsService, instruments)
+	if err != nil {
+		zapLogger.Fatalf("%s: can't load risk rates", err)
+	}
+
+	// paper portfolio is stored apart from the real one and isn't checked against account positions
+	portfolioAccountID := accountID
+	if cfg.Paper.Enabled {
+		portfolioAccountID = portfolio.PaperAccountID(accountID)
+	}
+	balances := make([]model.Balance, 0, len(cfg.StartAmountOfMoney))
+	for _, m := range cfg.StartAmountOfMoney {
+		balances = append(balances, model.Balance{Value: m.Value, Currency: m.Currency, AccountID: portfolioAccountID})
+	}
+	port := portfolio.NewPortfolio(portfolioAccountID, instrumentsService, positionsService, balances, db, zapLogger)
+	if cfg.Paper.Enabled {
+		_, err = port.LoadFromDB(ctx)
+	} else {
+		err = port.Init(ctx)
+	}
+	if err != nil {
+		zapLogger.Fatalf("%s: can't init portfolio", err)
+	}
+	restorePortfolio(zapLogger, port, instrumentsService, instruments)
+	go port.Run(ctx)
+
+	// market data of universe and held instruments comes from stream, unary calls are used when it is stale
+	streamManager := md.NewStreamManager(investClient, candlesService, zapLogger)
+	streamManager.Subscribe(portfolioIds(zapLogger, port, instruments)...)
+	go streamManager.Run(ctx)
+
+	livePortfolio := bot.NewLivePortfolio(port, currency, zapLogger)
+	var execution strategy.Execution
+	if cfg.Paper.Enabled {
+		// fills are simulated on stream prices with investor tariff commissions and written to journal
+		paperExecutor := paper.NewExecutor(zapLogger, streamManager, port, portfolio.NewJournal(db),
+			portfolioAccountID, currency, model.InvestorTaxes, cfg.Paper)
+		paperExecutor.RestoreShorts(cfg.MarginTradingConfig)
+		go paperExecutor.Run(ctx, cfg.Paper.CheckInterval)
+		execution = paperExecutor
+	} else {
+		risk, err := newRiskChecker(cfg, investClient, retrier, candlesService, port, instruments, zapLogger)
+		if err != nil {
+			zapLogger.Fatalf("%s: can't create risk checker", err)
+		}
+		liveExecutor := executor.NewExecutor(investClient, cfg.Orders, candlesService, risk, retrier, zapLogger)
+		liveExecution := bot.NewLiveExecution(zapLogger, liveExecutor, livePortfolio, streamManager, accountID, cfg.Orders, rates)
+		if err := liveExecution.ReconcileBrackets(); err != nil {
+			zapLogger.Errorf("%s: can't reconcile bracket orders", err)
+		}
+		ordersService := order.NewOrdersService(investClient, accountID, zapLogger)
+		go ordersService.Run(ctx, liveExecution.OnOrderState)
+		execution = liveExecution
+	}
+
+	sttmStrategy := strategy.NewSTTM(zapLogger, instrumentsService, cfg.Instruments, streamManager,
+		strategy.CombinedSignals{Provider: signalProvider, Indicators: techAnService},
+		execution, livePortfolio, cfg.STTM, cfg.Orders, cfg.MarginTradingConfig)
+	tradingBot := bot.NewTradingBot(zapLogger, sttmStrategy, execution, instrumentsService, exchangeOf(instruments),
+		cfg.STTM.CalculationInterval, cfg.MarginTradingConfig)
+
+	zapLogger.Infof("Trading bot started on account %s, paper: %t", portfolioAccountID, cfg.Paper.Enabled)
+	tradingBot.Run(ctx)
+
+	zapLogger.Infoln("start graceful shutdown")
+	if err := port.FlushToDB(context.Background()); err != nil {
+		zapLogger.Errorf("%s: can't flush portfolio", err)
+	}
+}
+
+func loadRiskRates(cfg config.TradingBotConfig, instrumentsService *instrument.InstrumentsService,
+	instruments []model.Instrument) (map[string]model.RiskRates, error) {
+	if !cfg.MarginTradingConfig.Enabled {
+		return nil, nil
+	}
+	if cfg.RiskRatesFile != "" {
+		return instrument.LoadRiskRates(cfg.RiskRatesFile)
+	}
+	return instrumentsService.GetInstrumentsRiskRates(instruments), nil
+}
+
+// newRiskChecker returns nil if orders aren't checked, qualified investor status is taken from account info
+func newRiskChecker(cfg config.TradingBotConfig, investClient *investgo.Client, retrier *broker.Retrier, candlesService *md.CandlesService,
+	port *portfolio.Portfolio, instruments []model.Instrument, l logger.Logger) (*executor.RiskChecker, error) {
+	if !cfg.Orders.Risk.Enabled {
+		return nil, nil
+	}
+
+	info, err := broker.Call(retrier, "GetInfo", func() (*investgo.GetInfoResponse, error) {
+		return investClient.NewUsersServiceClient().GetInfo()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: can't get account info", err)
+	}
+
+	risk := executor.NewRiskChecker(candlesService, port, info.GetQualStatus(), cfg.Orders.Risk, l)
+	risk.SetInstruments(instruments)
+	return risk, nil
+}
+
+// restorePortfolio sets lots and figi of instruments loaded from db, they aren't stored there
+func restorePortfolio(l logger.Logger, port *portfolio.Portfolio, instrumentsService *instrument.InstrumentsService,
+	instruments []model.Instrument) {
+	byUID := make(map[string]model.Instrument, len(instruments))
+	for _, i := range instruments {
+		byUID[i.UID] = i
+	}
+
+	held, err := port.GetInstruments()
+	if err != nil {
+		l.Errorf("%s: can't get portfolio instruments", err)
+		return
+	}
+	for _, h := range held {
+		if h.Lot > 0 && h.FIGI != "" {
+			continue
+		}
+		i, ok := byUID[h.InstrumentID]
+		if !ok {
+			found, err := instrumentsService.GetInstrument(h.InstrumentID)
+			if err != nil {
+				l.Errorf("%s: can't get held instrument %s", err, h.InstrumentID)
+				continue
+			}
+			i = *found
+		}
+		h.Lot, h.FIGI = float64(i.Lot), i.FIGI
+		port.UpdateInstrument(h)
+	}
+}
+
+// exchangeOf returns instrument which exchange schedule is used for session end
+func exchangeOf(instruments []model.Instrument) model.Instrument {
+	for _, i := range instruments {
+		if i.ExchangeSection != "" {
+			return i
+		}
+	}
+	return model.Instrument{}
+}
+
+func portfolioIds(l logger.Logger, port *portfolio.Portfolio, instruments []model.Instrument) []string {
+	ids := make([]string, 0, len(instruments))
+	for _, i := range instruments {
+		ids = append(ids, i.UID)
+	}
+	held, err := port.GetInstruments()
+	if err != nil {
+		l.Errorf("%s: can't get portfolio instruments", err)
+		return ids
+	}
+	for _, h := range held {
+		ids = append(ids, h.InstrumentID)
 	}
-	zapLogger.Infoln(i.GetTariff())
+	return ids
 }
@@ -0,0 +1,117 @@
+package backtest
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/STTM-NSU/trading-bot/internal/logger"
+	"github.com/STTM-NSU/trading-bot/internal/model"
+)
+
+type payment struct {
+	figi   string
+	amount float64
+	date   time.Time
+}
+
+// CashFlows tracks dividends and coupons: entitlement is fixed on ex-date for held positions
+// and money is credited on payment date
+type CashFlows struct {
+	logger logger.Logger
+
+	mu      sync.Mutex
+	tax     float64
+	flows   map[string][]model.CashFlow // figi -> flows sorted by ex-date
+	next    map[string]int              // figi -> index of the first not processed flow
+	pending []payment
+}
+
+func NewCashFlows(logger logger.Logger, flows []model.CashFlow, tax float64) *CashFlows {
+	m := make(map[string][]model.CashFlow)
+	for _, f := range flows {
+		m[f.FIGI] = append(m[f.FIGI], f)
+	}
+	for _, f := range m {
+		slices.SortFunc(f, func(a, b model.CashFlow) int {
+			return a.ExDate().Compare(b.ExDate())
+		})
+	}
+
+	return &CashFlows{
+		logger: logger,
+		tax:    tax,
+		flows:  m,
+		next:   make(map[string]int),
+	}
+}
+
+// ExDates returns flows with ex-date up to from that weren't returned before
+func (c *CashFlows) ExDates(from time.Time) []model.CashFlow {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var res []model.CashFlow
+	for figi, flows := range c.flows {
+		i := c.next[figi]
+		for i < len(flows) && !flows[i].ExDate().After(from) {
+			res = append(res, flows[i])
+			i++
+		}
+		c.next[figi] = i
+	}
+
+	return res
+}
+
+// Entitle registers payment for quantity of securities, long positions get money net of tax
+// and short positions pay the whole value to the lender. Returns registered amount
+func (c *CashFlows) Entitle(f model.CashFlow, quantity float64) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	amount := f.Value * quantity
+	if amount > 0 {
+		amount *= 1 - c.tax
+	}
+	c.pending = append(c.pending, payment{figi: f.FIGI, amount: amount, date: f.PaymentDate})
+	c.logger.Infof("%s %s entitled %f for %f on %s", f.Type, f.FIGI, amount, quantity, f.PaymentDate)
+
+	return amount
+}
+
+// Due returns payments with payment date up to from
+func (c *CashFlows) Due(from time.Time) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var sum float64
+	pending := c.pending[:0]
+	for _, p := range c.pending {
+		if p.date.After(from) {
+			pending = append(pending, p)
+			continue
+		}
+		sum += p.amount
+	}
+	c.pending = pending
+
+	return sum
+}
+
+// AccruedInterest returns accrued coupon interest for one bond on ts
+func (c *CashFlows) AccruedInterest(figi string, ts time.Time) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, f := range c.flows[figi] {
+		if f.Type != model.Coupon || !f.PeriodEnd.After(f.PeriodStart) {
+			continue
+		}
+		if ts.Before(f.PeriodStart) || !ts.Before(f.PeriodEnd) {
+			continue
+		}
+		return f.Value * float64(ts.Sub(f.PeriodStart)) / float64(f.PeriodEnd.Sub(f.PeriodStart))
+	}
+	return 0
+}
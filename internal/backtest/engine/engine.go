@@ -0,0 +1,185 @@
+package engine
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/STTM-NSU/trading-bot/internal/config"
+	"github.com/STTM-NSU/trading-bot/internal/logger"
+)
+
+const (
+	_sessionOpenHour  = 7
+	_endOfTestHour    = 18 // before session close, so strategy has time to liquidate
+	_sessionCloseHour = 19
+	_rebalanceHour    = 20
+)
+
+type EventType string
+
+const (
+	Bar          EventType = "bar"           // every trading hour
+	SessionOpen  EventType = "session_open"  // every trading day
+	SessionClose EventType = "session_close" // every trading day
+	RebalanceDue EventType = "rebalance_due" // after session close on rebalance day, except the last one
+	EndOfTest    EventType = "end_of_test"   // on the last rebalance day before session close
+)
+
+type Event struct {
+	Type     EventType
+	Ts       time.Time
+	Interval Interval
+	// From is start of sttm calculation interval for RebalanceDue
+	From time.Time
+	// RebalanceDay is set for events on days when rebalance happens
+	RebalanceDay bool
+	Last         bool // event of the last interval
+}
+
+type Handler func(ctx context.Context, e Event) error
+
+type Registrar interface {
+	On(t EventType, h Handler)
+}
+
+// Strategy registers its handlers for clock events
+type Strategy interface {
+	Register(r Registrar)
+}
+
+// Engine is simulated clock of backtest, it walks over trading hours of intervals
+// and emits events to registered handlers in the order of registration
+type Engine struct {
+	logger logger.Logger
+
+	daily     bool
+	intervals []Interval
+	handlers  map[EventType][]Handler
+}
+
+func NewEngine(logger logger.Logger, interval config.CalculationInterval, from, to time.Time) *Engine {
+	daily := interval == config.Day
+	intervals := SplitInto(interval, from, to)
+	if daily { // there are no sessions to rebalance after on weekends
+		intervals = slices.DeleteFunc(intervals, func(v Interval) bool {
+			return IsWeekend(v.Start)
+		})
+	}
+
+	return &Engine{
+		logger:    logger,
+		daily:     daily,
+		intervals: intervals,
+		handlers:  make(map[EventType][]Handler),
+	}
+}
+
+func (e *Engine) On(t EventType, h Handler) {
+	e.handlers[t] = append(e.handlers[t], h)
+}
+
+func (e *Engine) Register(strategies ...Strategy) {
+	for _, s := range strategies {
+		s.Register(e)
+	}
+}
+
+func (e *Engine) Intervals() []Interval {
+	return e.intervals
+}
+
+// RebalanceWindows returns From and Ts of all RebalanceDue events
+func (e *Engine) RebalanceWindows() []Interval {
+	var windows []Interval
+	for _, interval := range e.intervals[:max(len(e.intervals)-1, 0)] {
+		for _, h := range DivideIntoHours(interval.Start, interval.End) {
+			if IsWeekend(h) || h.Hour() != _rebalanceHour || !(e.daily || h.Weekday() == time.Friday) {
+				continue
+			}
+			windows = append(windows, Interval{Start: e.calculationStart(interval, h), End: h})
+		}
+	}
+	return windows
+}
+
+func (e *Engine) calculationStart(interval Interval, h time.Time) time.Time {
+	if e.daily { // sttm is calculated over the preceding day
+		return CalculationStart(config.Day, h)
+	}
+	// the first week of test can start after monday
+	if from := CalculationStart(config.Week, h); from.After(interval.Start) {
+		return from
+	}
+	return interval.Start
+}
+
+// End returns the end of the last interval
+func (e *Engine) End() time.Time {
+	if len(e.intervals) == 0 {
+		return time.Time{}
+	}
+	return e.intervals[len(e.intervals)-1].End
+}
+
+// Run emits events until the end of test or context cancellation
+func (e *Engine) Run(ctx context.Context) error {
+	for i, interval := range e.intervals {
+		e.logger.Infof("Interval: %v", interval)
+		last := i == len(e.intervals)-1
+
+		var lastDay time.Time
+		for _, h := range DivideIntoHours(interval.Start, interval.End) {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if IsWeekend(h) {
+				continue
+			}
+
+			if lastDay != h.Truncate(24*time.Hour) {
+				e.logger.Infof("Day: %v", h)
+				lastDay = h.Truncate(24 * time.Hour)
+			}
+
+			// weekly mode rebalances on friday, daily mode after every session
+			event := Event{
+				Ts:           h,
+				Interval:     interval,
+				RebalanceDay: e.daily || h.Weekday() == time.Friday,
+				Last:         last,
+			}
+
+			switch {
+			case h.Hour() == _sessionOpenHour:
+				e.emit(ctx, SessionOpen, event)
+			case event.RebalanceDay && h.Hour() == _endOfTestHour && last:
+				e.emit(ctx, EndOfTest, event)
+			case h.Hour() == _sessionCloseHour:
+				e.emit(ctx, SessionClose, event)
+			case event.RebalanceDay && h.Hour() == _rebalanceHour && !last:
+				event.From = e.calculationStart(interval, h)
+				e.emit(ctx, RebalanceDue, event)
+				continue // orders placed on rebalance are checked from the next bar
+			}
+
+			e.emit(ctx, Bar, event)
+		}
+	}
+
+	return nil
+}
+
+func (e *Engine) emit(ctx context.Context, t EventType, event Event) {
+	event.Type = t
+	for _, h := range e.handlers[t] {
+		if err := h(ctx, event); err != nil {
+			e.logger.Errorf("%s: %s handler failed on %s", err, t, event.Ts)
+		}
+	}
+}
+
+// IsWeekend reports whether t is on saturday or sunday, there are no trading hours then
+func IsWeekend(t time.Time) bool {
+	return t.Weekday() == time.Saturday || t.Weekday() == time.Sunday
+}
@@ -0,0 +1,83 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/STTM-NSU/trading-bot/internal/config"
+	"github.com/STTM-NSU/trading-bot/internal/logger"
+)
+
+type recorder struct {
+	events []Event
+}
+
+func (r *recorder) Register(reg Registrar) {
+	for _, t := range []EventType{Bar, SessionOpen, SessionClose, RebalanceDue, EndOfTest} {
+		reg.On(t, func(_ context.Context, e Event) error {
+			r.events = append(r.events, e)
+			return nil
+		})
+	}
+}
+
+func (r *recorder) count(t EventType) int {
+	var n int
+	for _, e := range r.events {
+		if e.Type == t {
+			n++
+		}
+	}
+	return n
+}
+
+func TestEngineDaily(t *testing.T) {
+	l, sync, err := logger.NewZapLogger(logger.Error)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sync()
+
+	// monday to sunday, weekend days are skipped
+	from := time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC)
+	e := NewEngine(l, config.Day, from, from.Add(6*24*time.Hour))
+	r := &recorder{}
+	e.Register(r)
+	if err := e.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := r.count(SessionOpen); n != 5 {
+		t.Errorf("unexpected session opens %d", n)
+	}
+	if n := r.count(RebalanceDue); n != 4 {
+		t.Errorf("unexpected rebalances %d", n)
+	}
+	if n := r.count(EndOfTest); n != 1 {
+		t.Errorf("unexpected end of test events %d", n)
+	}
+	for _, ev := range r.events {
+		if ev.Type == Bar && ev.Ts.Hour() == _rebalanceHour && ev.Ts.Weekday() != time.Friday {
+			t.Errorf("bar on rebalance hour %v", ev.Ts)
+		}
+		if ev.Type == RebalanceDue && ev.Ts.Weekday() == time.Tuesday && ev.From.Weekday() != time.Monday {
+			t.Errorf("unexpected sttm interval start %v", ev.From)
+		}
+	}
+
+	windows := e.RebalanceWindows()
+	k := 0
+	for _, ev := range r.events {
+		if ev.Type != RebalanceDue {
+			continue
+		}
+		if k >= len(windows) || !windows[k].Start.Equal(ev.From) || !windows[k].End.Equal(ev.Ts) {
+			t.Errorf("rebalance window %d doesn't match event %v", k, ev)
+		}
+		k++
+	}
+	if k != len(windows) {
+		t.Errorf("unexpected rebalance windows %d", len(windows))
+	}
+}
@@ -0,0 +1,129 @@
+package engine
+
+import (
+	"time"
+
+	"github.com/STTM-NSU/trading-bot/internal/config"
+)
+
+type Interval struct {
+	Start time.Time
+	End   time.Time
+}
+
+// SplitIntoWeeks разбивает интервал на недельные интервалы
+func SplitIntoWeeks(from, to time.Time) []Interval {
+	var intervals []Interval
+
+	current := from.Truncate(24 * time.Hour)
+	end := to.Truncate(24 * time.Hour)
+
+	if current.After(end) {
+		return intervals
+	}
+
+	current = findNextMonday(current)
+	if current.After(end) {
+		intervals = append(intervals, Interval{
+			Start: from,
+			End:   end.Add(24*time.Hour - time.Nanosecond),
+		})
+		return intervals
+	}
+
+	firstSunday := current.Add(-24 * time.Hour)
+	if firstSunday.After(from) {
+		intervals = append(intervals, Interval{
+			Start: from,
+			End:   firstSunday.Add(24*time.Hour - time.Nanosecond),
+		})
+	}
+
+	for {
+		nextSunday := current.Add(6 * 24 * time.Hour)
+		if nextSunday.After(end) {
+			break
+		}
+
+		intervals = append(intervals, Interval{
+			Start: current,
+			End:   nextSunday.Add(24*time.Hour - time.Nanosecond),
+		})
+
+		current = current.Add(7 * 24 * time.Hour)
+	}
+
+	if current.Before(end) || current.Equal(end) {
+		intervals = append(intervals, Interval{
+			Start: current,
+			End:   end.Add(24*time.Hour - time.Nanosecond),
+		})
+	}
+
+	return intervals
+}
+
+// SplitIntoDays splits interval into days, first and last days are bounded by from and to
+func SplitIntoDays(from, to time.Time) []Interval {
+	var intervals []Interval
+
+	current := from.Truncate(24 * time.Hour)
+	end := to.Truncate(24 * time.Hour)
+
+	for !current.After(end) {
+		start := current
+		if start.Before(from) {
+			start = from
+		}
+		intervals = append(intervals, Interval{
+			Start: start,
+			End:   current.Add(24*time.Hour - time.Nanosecond),
+		})
+		current = current.Add(24 * time.Hour)
+	}
+
+	return intervals
+}
+
+// SplitInto splits interval by sttm calculation interval
+func SplitInto(interval config.CalculationInterval, from, to time.Time) []Interval {
+	if interval == config.Day {
+		return SplitIntoDays(from, to)
+	}
+	return SplitIntoWeeks(from, to)
+}
+
+// PreviousWeekday returns the same time of the previous working day
+func PreviousWeekday(t time.Time) time.Time {
+	t = t.Add(-24 * time.Hour)
+	for IsWeekend(t) {
+		t = t.Add(-24 * time.Hour)
+	}
+	return t
+}
+
+// CalculationStart returns start of sttm interval which ends at h: the preceding weekday in daily mode
+// and monday of the week in weekly one
+func CalculationStart(interval config.CalculationInterval, h time.Time) time.Time {
+	if interval == config.Day {
+		return PreviousWeekday(h)
+	}
+	day := h.Truncate(24 * time.Hour)
+	return day.Add(-time.Duration((int(day.Weekday())+6)%7) * 24 * time.Hour)
+}
+
+func findNextMonday(t time.Time) time.Time {
+	weekday := t.Weekday()
+	daysUntilMonday := (8 - int(weekday)) % 7
+	return t.AddDate(0, 0, daysUntilMonday)
+}
+
+func DivideIntoHours(from, to time.Time) []time.Time {
+	hours := make([]time.Time, 0, int(to.Sub(from).Hours()))
+	for from.Before(to) {
+		hours = append(hours, from)
+		from = from.Add(1 * time.Hour)
+	}
+
+	return hours
+}
@@ -0,0 +1,53 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/STTM-NSU/trading-bot/internal/config"
+)
+
+func TestSplitIntoWeeks(t *testing.T) {
+	i := SplitIntoWeeks(time.Now().Add(-12*31*24*time.Hour).UTC(), time.Now().UTC())
+	for _, v := range i {
+		fmt.Printf("%v - %v\n", v.Start, v.End)
+		for _, h := range DivideIntoHours(v.Start, v.End) {
+			fmt.Printf("hour - %v\n", h)
+		}
+	}
+}
+
+func TestSplitIntoDays(t *testing.T) {
+	from := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 1, 3, 6, 0, 0, 0, time.UTC)
+
+	i := SplitIntoDays(from, to)
+	if len(i) != 3 {
+		t.Fatalf("unexpected days count %d", len(i))
+	}
+	if !i[0].Start.Equal(from) {
+		t.Errorf("first day must start on from, got %v", i[0].Start)
+	}
+	if !i[2].End.Equal(time.Date(2024, 1, 4, 0, 0, 0, 0, time.UTC).Add(-time.Nanosecond)) {
+		t.Errorf("unexpected end of last day %v", i[2].End)
+	}
+}
+
+func TestPreviousWeekday(t *testing.T) {
+	monday := time.Date(2024, 1, 8, 20, 0, 0, 0, time.UTC)
+	if p := PreviousWeekday(monday); !p.Equal(monday.Add(-3 * 24 * time.Hour)) {
+		t.Errorf("expected friday, got %v", p)
+	}
+}
+
+func TestCalculationStart(t *testing.T) {
+	friday := time.Date(2024, 1, 12, 20, 0, 0, 0, time.UTC)
+	if from := CalculationStart(config.Week, friday); !from.Equal(time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("weekly sttm interval must start on monday, got %v", from)
+	}
+	monday := time.Date(2024, 1, 15, 20, 0, 0, 0, time.UTC)
+	if from := CalculationStart(config.Day, monday); !from.Equal(friday) {
+		t.Errorf("daily sttm interval must start on the preceding weekday, got %v", from)
+	}
+}
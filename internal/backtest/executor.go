@@ -1,13 +1,11 @@
 package backtest
 
 import (
-	"maps"
-	"slices"
+	"math"
 	"sync"
 	"time"
 
 	"github.com/STTM-NSU/trading-bot/internal/config"
-	"github.com/STTM-NSU/trading-bot/internal/invest/md"
 	"github.com/STTM-NSU/trading-bot/internal/logger"
 	"github.com/STTM-NSU/trading-bot/internal/model"
 )
@@ -35,13 +33,32 @@ type TrackingInstrument struct {
 	market        bool
 	direction     Direction
 
-	marginTaxDay time.Time
+	// trailing stop sells when price falls by trail from the running high since entry
+	trail float64
+	high  float64
+
+	// partial fills of buy order
+	placed      time.Time
+	timeout     time.Duration
+	filled      float64
+	filledPrice float64
 }
 
 type IntervalProfit struct {
-	Balance float64
-	Profit  float64
-	Ts      time.Time
+	Balance        float64
+	PreTaxBalance  float64 // balance without any withheld ndfl
+	PostTaxBalance float64 // balance without accrued ndfl for current year
+	Profit         float64
+	Slippage       float64 // overall slippage cost up to Ts
+	Commission     float64 // overall broker commission up to Ts
+	Ts             time.Time
+}
+
+// Candles are market data of executor, implemented by md.CandlesService
+type Candles interface {
+	GetLastPriceOn(instrumentId string, from time.Time) (float64, error)
+	GetCandleOn(instrumentId string, from time.Time) (model.Candle, error)
+	GetCorporateActions(from, to time.Time) ([]model.CorporateAction, error)
 }
 
 type Executor struct {
@@ -50,29 +67,45 @@ type Executor struct {
 	mu          sync.Mutex
 	instruments map[string]TrackingInstrument
 	taxes       map[model.InstrumentType]float64
-	marginTaxes map[float64]float64
+	margin      *Margin
+	slippage    map[model.InstrumentType]SlippageModel
 
-	candlesService *md.CandlesService
+	maxParticipation float64 // max part of bar volume, zero for unlimited
+	ndfl             *NDFL
+	cashFlows        *CashFlows
+
+	candlesService Candles
 	portfolio      *Portfolio
 	ordersCfg      config.OrdersConfig
 
-	info    []IntervalProfit
-	lastDay time.Time
+	info      []IntervalProfit
+	lastDay   time.Time
+	actionsTs time.Time
+	marginDay time.Time
+
+	slippageCost   float64
+	commissionCost float64
+	turnover       float64
 }
 
 func NewExecutor(
 	logger logger.Logger,
-	taxes map[model.InstrumentType]float64, marginTaxes map[float64]float64,
-	candlesService *md.CandlesService, portfolio *Portfolio, ordersCfg config.OrdersConfig) *Executor {
+	taxes map[model.InstrumentType]float64, margin *Margin,
+	slippage map[model.InstrumentType]SlippageModel, maxParticipation float64, ndfl *NDFL, cashFlows *CashFlows,
+	candlesService Candles, portfolio *Portfolio, ordersCfg config.OrdersConfig) *Executor {
 	return &Executor{
-		logger:         logger,
-		taxes:          taxes,
-		marginTaxes:    marginTaxes,
-		portfolio:      portfolio,
-		candlesService: candlesService,
-		ordersCfg:      ordersCfg,
-		instruments:    make(map[string]TrackingInstrument),
-		info:           make([]IntervalProfit, 0),
+		logger:           logger,
+		taxes:            taxes,
+		margin:           margin,
+		slippage:         slippage,
+		maxParticipation: maxParticipation,
+		ndfl:             ndfl,
+		cashFlows:        cashFlows,
+		portfolio:        portfolio,
+		candlesService:   candlesService,
+		ordersCfg:        ordersCfg,
+		instruments:      make(map[string]TrackingInstrument),
+		info:             make([]IntervalProfit, 0),
 	}
 }
 
@@ -82,13 +115,199 @@ func (e *Executor) GetInfo() []IntervalProfit {
 	return e.info
 }
 
-func getMarginTaxes(price float64, taxes map[float64]float64) float64 {
-	for _, p := range slices.Sorted(maps.Keys(taxes)) {
-		if price < p {
-			return taxes[p]
+// GetCosts returns overall slippage and commission costs
+func (e *Executor) GetCosts() (float64, float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.slippageCost, e.commissionCost
+}
+
+// GetTurnover returns money amount of all fills
+func (e *Executor) GetTurnover() float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.turnover
+}
+
+type fill struct {
+	amount     float64 // paid or received money with slippage and commission
+	slippage   float64
+	commission float64
+}
+
+// fillOn calculates order fill on price moved by slippage against the order direction,
+// buyer of bond also pays accrued coupon interest to seller
+func (e *Executor) fillOn(instr TrackingInstrument, price, slippage float64, buy bool, from time.Time) fill {
+	volume := instr.quantity * instr.lot
+	amount, slippageCost, commission := FillOn(price, volume, slippage, e.taxes[instr.instrumentType], buy)
+	if instr.instrumentType == model.Bond {
+		amount += volume * e.cashFlows.AccruedInterest(instr.figi, from)
+	}
+	return fill{
+		amount:     amount,
+		slippage:   slippageCost,
+		commission: commission,
+	}
+}
+
+// FillOn returns money amount of volume units filled on price moved by slippage against the order direction,
+// buyer pays commission on top of amount and seller gets amount without commission. Slippage and commission costs are returned too
+func FillOn(price, volume, slippage, commissionRate float64, buy bool) (float64, float64, float64) {
+	sign := 1.0
+	if !buy {
+		sign = -1.0
+	}
+	fillPrice := price * (1 + sign*slippage)
+	commission := volume * fillPrice * commissionRate
+	return volume*fillPrice + sign*commission, volume * price * slippage, commission
+}
+
+func (e *Executor) marketFill(instr TrackingInstrument, price float64, buy bool, from time.Time) fill {
+	var slippage float64
+	if m, ok := e.slippage[instr.instrumentType]; ok {
+		slippage = m.Slippage(instr, price, from)
+	}
+	return e.fillOn(instr, price, slippage, buy, from)
+}
+
+func (e *Executor) commitFill(f fill) {
+	e.slippageCost += f.slippage
+	e.commissionCost += f.commission
+	e.turnover += f.amount
+}
+
+// fillableQuantity returns quantity in lots that can be filled on bar with max participation in bar volume
+func (e *Executor) fillableQuantity(instr TrackingInstrument, quantity float64, from time.Time) float64 {
+	if e.maxParticipation <= 0 {
+		return quantity
+	}
+	candle, err := e.candlesService.GetCandleOn(instr.figi, from)
+	if err != nil { // no trades on bar
+		return 0
+	}
+	return min(quantity, math.Floor(candle.Volume*e.maxParticipation))
+}
+
+// payTaxes withholds ndfl for previous year on the first check of new year
+func (e *Executor) payTaxes(from time.Time) {
+	if tax := e.ndfl.CloseYear(from); tax != 0 {
+		e.portfolio.PayTax(tax)
+	}
+}
+
+// processCashFlows fixes dividends and coupons for positions held on ex-date and credits them on payment date.
+// Price drop on ex-date is subtracted from reference price of sell orders, so it doesn't trigger stops
+func (e *Executor) processCashFlows(from time.Time) {
+	flows := e.cashFlows.ExDates(from)
+	if len(flows) > 0 {
+		portfolio := e.portfolio.GetInstruments()
+		shorts := e.portfolio.GetShorts()
+		for _, f := range flows {
+			var quantity float64
+			for _, v := range portfolio {
+				if v.FIGI == f.FIGI {
+					quantity += v.Quantity * v.Lot
+				}
+			}
+			for _, v := range shorts {
+				if v.FIGI == f.FIGI {
+					quantity -= v.Quantity * v.Lot
+				}
+			}
+			if quantity == 0 {
+				continue
+			}
+			e.portfolio.AddReceivable(e.cashFlows.Entitle(f, quantity))
+
+			for id, instr := range e.instruments {
+				if instr.figi == f.FIGI && instr.direction == Sell {
+					instr.origPrice -= f.Value * instr.quantity * instr.lot
+					e.instruments[id] = instr
+				}
+			}
 		}
 	}
-	return 0
+
+	if due := e.cashFlows.Due(from); due != 0 {
+		e.portfolio.ReceiveCash(due)
+	}
+}
+
+// applyCorporateActions changes positions on splits, so raw prices after split don't look like crash
+func (e *Executor) applyCorporateActions(from time.Time) {
+	if !from.After(e.actionsTs) {
+		return
+	}
+	if e.actionsTs.IsZero() {
+		e.actionsTs = from
+		return
+	}
+
+	actions, err := e.candlesService.GetCorporateActions(e.actionsTs, from)
+	e.actionsTs = from
+	if err != nil {
+		e.logger.Errorf("GetCorporateActions: %v", err)
+		return
+	}
+
+	for _, a := range actions {
+		e.logger.Infof("%s %s with ratio %f on %s", a.Type, a.InstrumentID, a.Ratio, a.Ts)
+		e.portfolio.ApplySplit(a.InstrumentID, a.Ratio)
+		for id, instr := range e.instruments {
+			if instr.figi == a.InstrumentID {
+				instr.lot *= a.Ratio
+				instr.i.Lot *= a.Ratio
+				e.instruments[id] = instr
+			}
+		}
+	}
+}
+
+// checkMargin charges daily fee for the sum of uncovered positions
+// and force-closes shorts when equity is lower than minimal margin
+func (e *Executor) checkMargin(from time.Time) {
+	positions := e.portfolio.GetPositionValues(from)
+	var uncovered float64
+	for _, p := range positions {
+		if p.Value < 0 {
+			uncovered -= p.Value
+		}
+	}
+	if uncovered == 0 {
+		return
+	}
+
+	if day := from.Truncate(24 * time.Hour); e.marginDay != day {
+		e.marginDay = day
+		fee := e.margin.DailyFee(uncovered)
+		e.logger.Infof("margin fee for uncovered positions %f: %f", uncovered, fee)
+		e.portfolio.PayMarginFee(fee)
+	}
+
+	_, minimal := e.margin.Requirements(positions)
+	equity := e.portfolio.GetBalanceWithInstruments(from)
+	if equity >= minimal {
+		return
+	}
+
+	e.logger.Warnf("margin call: equity %f < minimal margin %f", equity, minimal)
+	for id, instr := range e.instruments {
+		if instr.direction == Short {
+			instr.market = true
+			e.instruments[id] = instr
+			e.checkShort(instr, from)
+		}
+	}
+}
+
+// Withdraw withholds ndfl for profit realized in current year as broker does on money withdrawal
+func (e *Executor) Withdraw() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if tax := e.ndfl.Withdraw(); tax != 0 {
+		e.portfolio.PayTax(tax)
+	}
 }
 
 func (e *Executor) Check(from time.Time) {
@@ -96,6 +315,9 @@ func (e *Executor) Check(from time.Time) {
 	defer e.mu.Unlock()
 
 	e.logger.Debugf("checking trading instruments %d", len(e.instruments))
+	e.applyCorporateActions(from)
+	e.payTaxes(from)
+	e.processCashFlows(from)
 
 	// Sell stage
 	for _, instr := range e.instruments {
@@ -114,6 +336,7 @@ func (e *Executor) Check(from time.Time) {
 		default:
 		}
 	}
+	e.checkMargin(from)
 
 	e.updateInfo(from)
 
@@ -129,6 +352,10 @@ func (e *Executor) CheckTogether(from time.Time) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
+	e.applyCorporateActions(from)
+	e.payTaxes(from)
+	e.processCashFlows(from)
+
 	for _, instr := range e.instruments {
 		switch instr.direction {
 		case Sell:
@@ -141,6 +368,7 @@ func (e *Executor) CheckTogether(from time.Time) {
 			e.checkBuy(instr, from)
 		}
 	}
+	e.checkMargin(from)
 
 	e.updateInfo(from)
 }
@@ -151,21 +379,50 @@ func (e *Executor) checkSell(instr TrackingInstrument, from time.Time) {
 		// e.logger.Errorf("GetLastPriceOn exec check err: %v", err)
 		return
 	}
-	instrPrice := instr.quantity * instr.lot * price * (1 - e.taxes[instr.instrumentType])
+	if instr.trail > 0 && !instr.market {
+		instr.high = max(instr.high, price)
+		e.instruments[instr.instrumentId] = instr
+		if price > instr.high*(1-instr.trail) {
+			return
+		}
+		e.logger.Infof("trailing stop %s %f from high %f", instr.instrumentId, price, instr.high)
+		instr.market = true // stop is executed by market
+	}
+	instrPrice := e.fillOn(instr, price, 0, false, from).amount
+	if !instr.market && instr.profitPercent*instr.origPrice > instrPrice &&
+		instr.hedgePercent*instr.origPrice <= instrPrice {
+		return
+	}
+
+	q := e.fillableQuantity(instr, instr.quantity, from)
+	if q <= 0 {
+		return
+	}
+	part := instr
+	part.quantity = q
+	f := e.fillOn(part, price, 0, false, from)
 	if instr.market {
-		e.logger.Infof("sell market %s %f %f %f %f", instr.instrumentId, instrPrice, instr.quantity, instr.lot, price)
-		e.portfolio.UpdateBalance(instrPrice, instr.instrumentId)
-		e.portfolio.RemoveInstrument(instr.instrumentId)
-		delete(e.instruments, instr.instrumentId)
-	} else if instr.profitPercent*instr.origPrice <= instrPrice ||
-		instr.hedgePercent*instr.origPrice > instrPrice {
-		e.logger.Infof("sell limit %s [%f, %f] %f %f %f %f", instr.instrumentId,
+		f = e.marketFill(part, price, false, from)
+		e.logger.Infof("sell market %s %f %f/%f %f %f", instr.instrumentId, f.amount, q, instr.quantity, instr.lot, price)
+	} else {
+		e.logger.Infof("sell limit %s [%f, %f] %f %f/%f %f %f", instr.instrumentId,
 			instr.profitPercent*instr.origPrice, instr.hedgePercent*instr.origPrice,
-			instrPrice, instr.quantity, instr.lot, price)
-		e.portfolio.UpdateBalance(instrPrice, instr.instrumentId)
-		e.portfolio.RemoveInstrument(instr.instrumentId)
-		delete(e.instruments, instr.instrumentId)
+			f.amount, q, instr.quantity, instr.lot, price)
 	}
+	e.commitFill(f)
+	e.ndfl.Sell(instr.instrumentId, q, f.amount)
+
+	if q < instr.quantity { // remaining quantity waits for next bars
+		e.portfolio.SellPartially(f.amount, q, instr.instrumentId)
+		instr.origPrice *= (instr.quantity - q) / instr.quantity
+		instr.quantity -= q
+		e.instruments[instr.instrumentId] = instr
+		return
+	}
+
+	e.portfolio.UpdateBalance(f.amount, instr.instrumentId)
+	e.portfolio.RemoveInstrument(instr.instrumentId)
+	delete(e.instruments, instr.instrumentId)
 }
 
 func (e *Executor) checkNewShort(instr TrackingInstrument, from time.Time) {
@@ -174,107 +431,175 @@ func (e *Executor) checkNewShort(instr TrackingInstrument, from time.Time) {
 		// e.logger.Errorf("GetLastPriceOn exec check err: %v", err)
 		return
 	}
-	instrPrice := instr.quantity * instr.lot * price * (1 - e.taxes[instr.instrumentType])
+	positions := append(e.portfolio.GetPositionValues(from),
+		PositionValue{FIGI: instr.figi, Value: -instr.quantity * instr.lot * price})
+	initial, _ := e.margin.Requirements(positions)
+	if equity := e.portfolio.GetBalanceWithInstruments(from); equity < initial {
+		e.logger.Infof("not enough margin for short %s: equity %f < initial margin %f", instr.instrumentId, equity, initial)
+		delete(e.instruments, instr.instrumentId)
+		return
+	}
+
+	f := e.marketFill(instr, price, false, from)
+	e.commitFill(f)
+	instrPrice := f.amount
 	instr.origPrice = instrPrice
-	instr.marginTaxDay = from.Truncate(24 * time.Hour)
 	instr.direction = Short
 	e.instruments[instr.instrumentId] = instr
+	e.portfolio.UpdateShort(shortInstrument(instr))
 	e.logger.Infof("open short %s [%f %f>%f] %f %f %f", instr.instrumentId,
 		instrPrice, instr.profitPercent*instr.origPrice, instr.hedgePercent*instr.origPrice,
 		instr.quantity, instr.lot, price)
 }
 
 func (e *Executor) checkShort(instr TrackingInstrument, from time.Time) {
-	if instr.marginTaxDay != from.Truncate(24*time.Hour) {
-		instr.marginTaxDay = from.Truncate(24 * time.Hour)
-		tax := getMarginTaxes(instr.origPrice, e.marginTaxes)
-		e.logger.Infof("taxes for short %s [%f, %f]", instr.instrumentId, instr.origPrice, tax)
-		instr.origPrice -= tax
-		e.instruments[instr.instrumentId] = instr
-	}
-
 	price, err := e.candlesService.GetLastPriceOn(instr.figi, from)
 	if err != nil {
 		// e.logger.Errorf("GetLastPriceOn exec check err: %v", err)
 		return
 	}
-	instrPrice := instr.quantity * instr.lot * price * (1 + e.taxes[instr.instrumentType])
+	f := e.fillOn(instr, price, 0, true, from)
+	if instr.market {
+		f = e.marketFill(instr, price, true, from)
+	}
+	instrPrice := f.amount
 	if instr.market { // buy out
 		e.logger.Infof("close short market %s [%f > %f > %f] [%f] %f %f %f",
 			instr.instrumentId,
 			instr.origPrice*instr.profitPercent, instr.origPrice, instr.origPrice*instr.hedgePercent,
 			instrPrice, instr.quantity, instr.lot, price)
+		e.commitFill(f)
+		e.ndfl.Realize(instr.origPrice - instrPrice)
 		e.portfolio.UpdateBalanceMargin(instrPrice, instr.origPrice)
+		e.portfolio.RemoveShort(instr.instrumentId)
 		delete(e.instruments, instr.instrumentId)
 	} else if instrPrice <= instr.origPrice*instr.profitPercent { // profit
 		e.logger.Infof("close short profit %s [%f > %f > %f] [%f] %f %f %f",
 			instr.instrumentId,
 			instr.origPrice*instr.profitPercent, instr.origPrice, instr.origPrice*instr.hedgePercent,
 			instrPrice, instr.quantity, instr.lot, price)
+		e.commitFill(f)
+		e.ndfl.Realize(instr.origPrice - instrPrice)
 		e.portfolio.UpdateBalanceMargin(instrPrice, instr.origPrice)
+		e.portfolio.RemoveShort(instr.instrumentId)
 		delete(e.instruments, instr.instrumentId)
 	} else if instrPrice > instr.origPrice*instr.hedgePercent {
 		e.logger.Infof("close short hedge %s [%f > %f > %f] [%f] %f %f %f",
 			instr.instrumentId,
 			instr.origPrice*instr.profitPercent, instr.origPrice, instr.origPrice*instr.hedgePercent,
 			instrPrice, instr.quantity, instr.lot, price)
+		e.commitFill(f)
+		e.ndfl.Realize(instr.origPrice - instrPrice)
 		e.portfolio.UpdateBalanceMargin(instrPrice, instr.origPrice)
+		e.portfolio.RemoveShort(instr.instrumentId)
 		delete(e.instruments, instr.instrumentId)
 	}
 }
 
+func shortInstrument(instr TrackingInstrument) model.PortfolioInstrument {
+	return model.PortfolioInstrument{
+		FIGI:           instr.figi,
+		InstrumentType: string(instr.instrumentType),
+		EntryPrice:     instr.origPrice,
+		Quantity:       instr.quantity,
+		Lot:            instr.lot,
+		InstrumentID:   instr.instrumentId,
+	}
+}
+
 func (e *Executor) checkBuy(instr TrackingInstrument, from time.Time) {
 	if !instr.market {
 		return
 	}
+	if instr.placed.IsZero() {
+		instr.placed = from
+	}
+	defer func() { e.finishBuy(instr, from) }()
 
 	price, err := e.candlesService.GetLastPriceOn(instr.figi, from)
 	if err != nil {
 		// e.logger.Errorf("GetLastPriceOn exec err: %v", err)
 		return
 	}
-	instrPrice := instr.quantity * instr.lot * price * (1 + e.taxes[instr.instrumentType])
+
+	q := e.fillableQuantity(instr, instr.quantity-instr.filled, from)
+	if q <= 0 {
+		return
+	}
+	part := instr
+	part.quantity = q
+	f := e.marketFill(part, price, true, from)
+	instrPrice := f.amount
 	if e.portfolio.GetBalance() >= instrPrice {
-		e.logger.Infof("buy %s %f %f %f %f", instr.instrumentId, instrPrice, instr.quantity, instr.lot, price)
+		e.logger.Infof("buy %s %f %f/%f %f %f", instr.instrumentId, instrPrice, q, instr.quantity, instr.lot, price)
+		e.commitFill(f)
+		e.ndfl.Buy(instr.instrumentId, q, instrPrice)
 		e.portfolio.Buy(instrPrice)
-		portfolioInstr := model.PortfolioInstrument{
+		e.portfolio.AddInstrument(model.PortfolioInstrument{
 			FIGI:           instr.figi,
 			InstrumentType: string(instr.instrumentType),
 			EntryPrice:     instrPrice,
-			Quantity:       instr.quantity,
+			Quantity:       q,
 			Lot:            instr.lot,
 			InstrumentID:   instr.instrumentId,
-		}
-		e.portfolio.AddInstrument(portfolioInstr)
-		delete(e.instruments, instr.instrumentId)
+		})
+		instr.filled += q
+		instr.filledPrice += instrPrice
+	}
+}
 
-		e.instruments[instr.instrumentId] = TrackingInstrument{
-			instrumentId:   instr.instrumentId,
-			figi:           instr.figi,
-			quantity:       instr.quantity,
-			lot:            instr.lot,
-			instrumentType: instr.instrumentType,
-			i:              portfolioInstr,
-			origPrice:      instrPrice,
-			hedgePercent:   1 - e.ordersCfg.SellOrder.DefencePercentIndent,
-			profitPercent:  1 + e.ordersCfg.SellOrder.ProfitPercentIndent,
-			direction:      Sell,
-		}
+// finishBuy keeps buy order with unfilled remainder until timeout, then starts tracking filled part for selling
+func (e *Executor) finishBuy(instr TrackingInstrument, from time.Time) {
+	expired := instr.timeout > 0 && from.Sub(instr.placed) >= instr.timeout
+	if instr.filled < instr.quantity && !expired {
+		e.instruments[instr.instrumentId] = instr
+		return
+	}
+
+	delete(e.instruments, instr.instrumentId)
+	if instr.filled <= 0 {
+		e.logger.Infof("buy order expired %s %f", instr.instrumentId, instr.quantity)
+		return
+	}
+	if expired && instr.filled < instr.quantity {
+		e.logger.Infof("buy order expired %s filled %f/%f", instr.instrumentId, instr.filled, instr.quantity)
 	}
+	e.trackFilled(instr)
 }
 
+func (e *Executor) trackFilled(instr TrackingInstrument) {
+	e.instruments[instr.instrumentId] = TrackingInstrument{
+		instrumentId:   instr.instrumentId,
+		figi:           instr.figi,
+		quantity:       instr.filled,
+		lot:            instr.lot,
+		instrumentType: instr.instrumentType,
+		i:              e.portfolio.GetInstrument(instr.instrumentId),
+		origPrice:      instr.filledPrice,
+		hedgePercent:   1 - e.ordersCfg.SellOrder.DefencePercentIndent,
+		profitPercent:  1 + e.ordersCfg.SellOrder.ProfitPercentIndent,
+		direction:      Sell,
+	}
+}
+
+// updateInfo marks portfolio to market once per half-day, reported rows keep half-day timestamps
 func (e *Executor) updateInfo(from time.Time) {
 	fromDay := from.Truncate(12 * time.Hour)
-	if e.lastDay != fromDay && fromDay.Hour() != 0 {
-		balance := e.portfolio.GetBalanceWithInstruments(from)
-		e.logger.Infof("Portfolio balance: %f on %s", balance, from)
-		e.lastDay = fromDay
-		e.info = append(e.info, IntervalProfit{
-			Balance: balance,
-			Profit:  e.portfolio.GetProfit(from),
-			Ts:      fromDay,
-		})
+	if e.lastDay == fromDay || fromDay.Hour() == 0 {
+		return
 	}
+	balance := e.portfolio.GetBalanceWithInstruments(from)
+	e.logger.Infof("Portfolio balance: %f on %s", balance, from)
+	e.lastDay = fromDay
+	e.info = append(e.info, IntervalProfit{
+		Balance:        balance,
+		PreTaxBalance:  balance + e.ndfl.Paid(),
+		PostTaxBalance: balance - e.ndfl.Accrued(),
+		Profit:         e.portfolio.GetProfit(from),
+		Slippage:       e.slippageCost,
+		Commission:     e.commissionCost,
+		Ts:             fromDay,
+	})
 }
 
 func (e *Executor) BuyDeptMargin() {
@@ -293,18 +618,21 @@ func (e *Executor) BuyDeptMargin() {
 	}
 }
 
-// RemoveBuyOrders in case there are remaining buy orders on next rebalance
+// RemoveBuyOrders in case there are remaining buy orders on next rebalance,
+// partially filled orders are tracked for selling with filled quantity
 func (e *Executor) RemoveBuyOrders() {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	instrs := make(map[string]TrackingInstrument, len(e.instruments))
 	for id, instr := range e.instruments {
 		if instr.direction != Buy {
-			instrs[id] = instr
+			continue
+		}
+		delete(e.instruments, id)
+		if instr.filled > 0 {
+			e.trackFilled(instr)
 		}
 	}
-	e.instruments = instrs
 }
 
 func (e *Executor) SellOutPortfolio() {
@@ -431,6 +759,41 @@ func (e *Executor) SellLimit(profit, hedge float64, i model.PortfolioInstrument)
 	}
 }
 
+// SellTrailing tracks the running high starting from entry price and sells by market
+// when price falls below high * (1 - trail)
+func (e *Executor) SellTrailing(trail float64, i model.PortfolioInstrument) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if v, ok := e.instruments[i.InstrumentID]; ok {
+		if v.direction == Sell && !v.market {
+			v.trail = trail
+			if v.high == 0 && v.quantity > 0 && v.lot > 0 { // trailing starts from entry price
+				v.high = v.origPrice / (v.quantity * v.lot)
+			}
+			e.instruments[i.InstrumentID] = v
+		}
+		return
+	}
+
+	var high float64
+	if i.Quantity > 0 && i.Lot > 0 {
+		high = i.EntryPrice / (i.Quantity * i.Lot)
+	}
+	e.instruments[i.InstrumentID] = TrackingInstrument{
+		instrumentId:   i.InstrumentID,
+		figi:           i.FIGI,
+		quantity:       i.Quantity,
+		lot:            i.Lot,
+		instrumentType: model.InstrumentType(i.InstrumentType),
+		i:              i,
+		origPrice:      i.EntryPrice,
+		direction:      Sell,
+		trail:          trail,
+		high:           high,
+	}
+}
+
 func (e *Executor) SellMarket(i model.PortfolioInstrument) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
@@ -464,17 +827,11 @@ func (e *Executor) BuyMarket(q float64, i model.Instrument) {
 			instrumentType: i.InstrumentType,
 			market:         true,
 			direction:      Buy,
+			timeout:        e.ordersCfg.BuyOrder.Timeout,
 		}
 	} else if v.direction == Buy {
-		e.instruments[i.UID] = TrackingInstrument{
-			figi:           v.figi,
-			instrumentId:   v.instrumentId,
-			lot:            v.lot,
-			quantity:       v.quantity + q,
-			instrumentType: v.instrumentType,
-			market:         v.market,
-			direction:      v.direction,
-		}
+		v.quantity += q
+		e.instruments[i.UID] = v
 	}
 }
 
@@ -0,0 +1,62 @@
+package backtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/STTM-NSU/trading-bot/internal/config"
+	"github.com/STTM-NSU/trading-bot/internal/logger"
+	"github.com/STTM-NSU/trading-bot/internal/model"
+)
+
+type testCandles struct {
+	price, volume float64
+}
+
+func (c testCandles) GetLastPriceOn(string, time.Time) (float64, error) {
+	return c.price, nil
+}
+
+func (c testCandles) GetCandleOn(_ string, from time.Time) (model.Candle, error) {
+	return model.Candle{ClosePrice: c.price, Volume: c.volume, Ts: from}, nil
+}
+
+func (c testCandles) GetCorporateActions(time.Time, time.Time) ([]model.CorporateAction, error) {
+	return nil, nil
+}
+
+func TestBuyFilledOnSeveralBars(t *testing.T) {
+	l, _, err := logger.NewZapLogger(logger.Error)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	portfolio := NewPortfolio(l, 10_000, nil, nil)
+	// 10 lots in bar, so order of 8 lots is filled by 5 and 3
+	e := NewExecutor(l, nil, nil, nil, 0.5, NewNDFL(l, nil), nil,
+		testCandles{price: 100, volume: 10}, portfolio, config.OrdersConfig{})
+	e.BuyMarket(8, model.Instrument{FIGI: "f", UID: "a", Lot: 1, InstrumentType: model.Share})
+
+	from := time.Date(2024, 1, 10, 10, 0, 0, 0, time.UTC)
+	for k := 0; k < 3; k++ {
+		for _, instr := range e.instruments {
+			if instr.direction == Buy {
+				e.checkBuy(instr, from.Add(time.Duration(k)*time.Hour))
+			}
+		}
+	}
+
+	if len(e.instruments) != 1 {
+		t.Fatalf("expected one tracked instrument, got %d", len(e.instruments))
+	}
+	instr := e.instruments["a"]
+	if instr.direction != Sell || instr.quantity != 8 || instr.origPrice != 800 {
+		t.Errorf("unexpected sell tracker %+v", instr)
+	}
+	if i := portfolio.GetInstrument("a"); i.Quantity != 8 || i.EntryPrice != 800 {
+		t.Errorf("unexpected portfolio instrument %+v", i)
+	}
+	if b := portfolio.GetBalance(); b != 10_000-800 {
+		t.Errorf("unexpected balance %f", b)
+	}
+}
@@ -0,0 +1,66 @@
+package backtest
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/STTM-NSU/trading-bot/internal/model"
+)
+
+// PositionValue is market value of position, negative for shorts
+type PositionValue struct {
+	FIGI  string
+	Value float64
+}
+
+// Margin calculates broker fees and margin requirements for the whole portfolio
+type Margin struct {
+	taxes        map[float64]float64 // uncovered positions sum -> fee per day
+	rates        map[string]model.RiskRates
+	defaultRates model.RiskRates
+}
+
+func NewMargin(taxes map[float64]float64, rates map[string]model.RiskRates, defaultRates model.RiskRates) *Margin {
+	return &Margin{
+		taxes:        taxes,
+		rates:        rates,
+		defaultRates: defaultRates,
+	}
+}
+
+func (m *Margin) rate(figi string) model.RiskRates {
+	if r, ok := m.rates[figi]; ok {
+		return r
+	}
+	return m.defaultRates
+}
+
+// DailyFee returns fee for the sum of all uncovered positions
+func (m *Margin) DailyFee(uncovered float64) float64 {
+	return getMarginTaxes(uncovered, m.taxes)
+}
+
+// Requirements returns initial and minimal margin for positions
+func (m *Margin) Requirements(positions []PositionValue) (float64, float64) {
+	var initial, minimal float64
+	for _, p := range positions {
+		r := m.rate(p.FIGI)
+		if p.Value >= 0 {
+			initial += p.Value * r.Dlong
+			minimal += p.Value * r.DlongMin
+		} else {
+			initial -= p.Value * r.Dshort
+			minimal -= p.Value * r.DshortMin
+		}
+	}
+	return initial, minimal
+}
+
+func getMarginTaxes(price float64, taxes map[float64]float64) float64 {
+	for _, p := range slices.Sorted(maps.Keys(taxes)) {
+		if price < p {
+			return taxes[p]
+		}
+	}
+	return 0
+}
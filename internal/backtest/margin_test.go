@@ -0,0 +1,37 @@
+package backtest
+
+import (
+	"testing"
+
+	"github.com/STTM-NSU/trading-bot/internal/model"
+)
+
+func TestMarginDailyFee(t *testing.T) {
+	m := NewMargin(model.MarginTaxPerDay, nil, model.RiskRates{})
+
+	// tier is chosen by the sum of uncovered positions, not by every position
+	if fee := m.DailyFee(4_000); fee != 0 {
+		t.Errorf("unexpected fee %f", fee)
+	}
+	if fee := m.DailyFee(4_000 + 4_000); fee != 45 {
+		t.Errorf("unexpected fee %f", fee)
+	}
+}
+
+func TestMarginRequirements(t *testing.T) {
+	m := NewMargin(nil, map[string]model.RiskRates{
+		"a": {Dlong: 0.2, DlongMin: 0.1, Dshort: 0.4, DshortMin: 0.2},
+	}, model.RiskRates{Dlong: 1, DlongMin: 0.5, Dshort: 1, DshortMin: 0.5})
+
+	initial, minimal := m.Requirements([]PositionValue{
+		{FIGI: "a", Value: 1000},
+		{FIGI: "a", Value: -500},
+		{FIGI: "b", Value: -100},
+	})
+	if initial != 200+200+100 {
+		t.Errorf("unexpected initial margin %f", initial)
+	}
+	if minimal != 100+100+50 {
+		t.Errorf("unexpected minimal margin %f", minimal)
+	}
+}
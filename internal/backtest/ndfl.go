@@ -0,0 +1,150 @@
+package backtest
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/STTM-NSU/trading-bot/internal/logger"
+	"github.com/STTM-NSU/trading-bot/internal/model"
+)
+
+type taxLot struct {
+	quantity float64
+	price    float64 // cost of one quantity unit with commission
+}
+
+// NDFL simulates personal income tax withheld by broker: cost basis is tracked per lot by FIFO,
+// profits and losses are offset inside calendar year and tax is calculated at year end or on withdrawal
+type NDFL struct {
+	logger logger.Logger
+
+	mu       sync.Mutex
+	brackets []model.TaxBracket
+	lots     map[string][]taxLot // instrument id -> FIFO queue
+
+	year     int
+	realized float64 // realized profit for current year
+	withheld float64 // tax already withheld for current year
+	paid     float64 // overall paid tax
+}
+
+func NewNDFL(logger logger.Logger, brackets []model.TaxBracket) *NDFL {
+	return &NDFL{
+		logger:   logger,
+		brackets: brackets,
+		lots:     make(map[string][]taxLot),
+	}
+}
+
+func (n *NDFL) Buy(id string, quantity, amount float64) {
+	if quantity <= 0 {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.lots[id] = append(n.lots[id], taxLot{quantity: quantity, price: amount / quantity})
+}
+
+// Sell consumes lots by FIFO and returns realized profit
+func (n *NDFL) Sell(id string, quantity, amount float64) float64 {
+	if quantity <= 0 {
+		return 0
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var basis float64
+	remaining := quantity
+	lots := n.lots[id]
+	for len(lots) > 0 && remaining > 0 {
+		q := min(lots[0].quantity, remaining)
+		basis += q * lots[0].price
+		remaining -= q
+		lots[0].quantity -= q
+		if lots[0].quantity <= 0 {
+			lots = lots[1:]
+		}
+	}
+	if len(lots) == 0 {
+		delete(n.lots, id)
+	} else {
+		n.lots[id] = lots
+	}
+	if remaining > 0 {
+		n.logger.Warnf("ndfl: sell %f of %s without cost basis", remaining, id)
+	}
+
+	profit := amount - basis
+	n.realized += profit
+	return profit
+}
+
+// Realize adds profit or loss that doesn't have lots, e.g. from closed short
+func (n *NDFL) Realize(profit float64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.realized += profit
+}
+
+// CloseYear returns tax to pay for the previous year if ts is in the next year, negative value is refund
+func (n *NDFL) CloseYear(ts time.Time) float64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.year == 0 {
+		n.year = ts.Year()
+		return 0
+	}
+	if ts.Year() == n.year {
+		return 0
+	}
+
+	due := n.Tax(n.realized) - n.withheld
+	n.logger.Infof("ndfl for %d: realized %f, tax %f, withheld %f", n.year, n.realized, due+n.withheld, n.withheld)
+	n.paid += due
+	n.year = ts.Year()
+	n.realized = 0
+	n.withheld = 0
+	return due
+}
+
+// Withdraw returns tax that is withheld on money withdrawal for profit realized in current year
+func (n *NDFL) Withdraw() float64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	due := max(n.Tax(n.realized)-n.withheld, 0)
+	n.withheld += due
+	n.paid += due
+	return due
+}
+
+// Accrued returns tax for current year that isn't withheld yet
+func (n *NDFL) Accrued() float64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.Tax(n.realized) - n.withheld
+}
+
+func (n *NDFL) Paid() float64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.paid
+}
+
+// Tax calculates progressive tax for annual base rounded to rubles
+func (n *NDFL) Tax(base float64) float64 {
+	var tax float64
+	for i, b := range n.brackets {
+		if base <= b.From {
+			break
+		}
+		upper := math.Inf(1)
+		if i+1 < len(n.brackets) {
+			upper = n.brackets[i+1].From
+		}
+		tax += (min(base, upper) - b.From) * b.Rate
+	}
+	return math.Round(tax)
+}
@@ -0,0 +1,62 @@
+package backtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/STTM-NSU/trading-bot/internal/logger"
+	"github.com/STTM-NSU/trading-bot/internal/model"
+)
+
+func newTestNDFL(t *testing.T) *NDFL {
+	l, sync, err := logger.NewZapLogger(logger.Error)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(sync)
+	return NewNDFL(l, model.NDFLBrackets)
+}
+
+func TestNDFLFIFO(t *testing.T) {
+	n := newTestNDFL(t)
+	n.Buy("a", 10, 1000) // 100 per lot
+	n.Buy("a", 10, 2000) // 200 per lot
+
+	// 10 lots from the first buy and 5 from the second
+	if p := n.Sell("a", 15, 3000); p != 3000-1000-1000 {
+		t.Errorf("unexpected profit %f", p)
+	}
+	if p := n.Sell("a", 5, 500); p != 500-1000 {
+		t.Errorf("unexpected profit %f", p)
+	}
+}
+
+func TestNDFLYear(t *testing.T) {
+	n := newTestNDFL(t)
+	n.CloseYear(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	n.Buy("a", 1, 1000)
+	n.Sell("a", 1, 2000)
+	n.Realize(-400) // loss is offset inside year
+
+	if tax := n.Withdraw(); tax != 78 {
+		t.Errorf("unexpected withheld tax %f", tax)
+	}
+	n.Realize(-600)
+	if tax := n.CloseYear(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)); tax != -78 {
+		t.Errorf("expected refund, got %f", tax)
+	}
+	if n.Paid() != 0 {
+		t.Errorf("unexpected paid tax %f", n.Paid())
+	}
+}
+
+func TestNDFLBrackets(t *testing.T) {
+	n := newTestNDFL(t)
+	if tax := n.Tax(6_000_000); tax != 5_000_000*0.13+1_000_000*0.15 {
+		t.Errorf("unexpected tax %f", tax)
+	}
+	if tax := n.Tax(-100); tax != 0 {
+		t.Errorf("unexpected tax for loss %f", tax)
+	}
+}
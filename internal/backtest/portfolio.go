@@ -17,16 +17,28 @@ type Portfolio struct {
 	entryBalance float64
 
 	instruments    map[string]model.PortfolioInstrument
+	shorts         map[string]model.PortfolioInstrument // EntryPrice is money received on short sell
 	candlesService *md.CandlesService
+	taxes          map[model.InstrumentType]float64
+	receivables    float64 // fixed dividends and coupons waiting for payment date
+
+	// prices snapshot for mark-to-market valuation
+	pricesTs   time.Time
+	fetched    map[string]struct{}
+	lastPrices map[string]float64 // figi -> last known close price
 }
 
-func NewPortfolio(logger logger.Logger, balance float64, cs *md.CandlesService) *Portfolio {
+func NewPortfolio(logger logger.Logger, balance float64, taxes map[model.InstrumentType]float64, cs *md.CandlesService) *Portfolio {
 	return &Portfolio{
 		logger:         logger,
 		balance:        balance,
 		entryBalance:   balance,
 		candlesService: cs,
+		taxes:          taxes,
 		instruments:    make(map[string]model.PortfolioInstrument),
+		shorts:         make(map[string]model.PortfolioInstrument),
+		fetched:        make(map[string]struct{}),
+		lastPrices:     make(map[string]float64),
 	}
 }
 
@@ -41,11 +53,16 @@ func (p *Portfolio) GetInstrument(id string) model.PortfolioInstrument {
 	return model.PortfolioInstrument{}
 }
 
+// AddInstrument adds instrument or merges partial fill into existing one,
+// EntryPrice holds overall paid money so average entry price is EntryPrice / (Quantity * Lot)
 func (p *Portfolio) AddInstrument(i model.PortfolioInstrument) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	if _, ok := p.instruments[i.InstrumentID]; ok {
+	if v, ok := p.instruments[i.InstrumentID]; ok {
+		v.Quantity += i.Quantity
+		v.EntryPrice += i.EntryPrice
+		p.instruments[i.InstrumentID] = v
 		return
 	}
 
@@ -66,18 +83,111 @@ func (p *Portfolio) GetInstruments() map[string]model.PortfolioInstrument {
 	return p.instruments
 }
 
+// UpdateShort adds or updates opened short position
+func (p *Portfolio) UpdateShort(i model.PortfolioInstrument) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.shorts[i.InstrumentID] = i
+}
+
+func (p *Portfolio) RemoveShort(id string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.shorts, id)
+}
+
+func (p *Portfolio) GetShorts() map[string]model.PortfolioInstrument {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.shorts
+}
+
+// updatePrices loads prices snapshot on from for instruments that weren't fetched for this timestamp yet
+func (p *Portfolio) updatePrices(from time.Time) {
+	if !p.pricesTs.Equal(from) {
+		p.pricesTs = from
+		p.fetched = make(map[string]struct{})
+	}
+
+	ids := make([]string, 0, len(p.instruments)+len(p.shorts))
+	for _, m := range []map[string]model.PortfolioInstrument{p.instruments, p.shorts} {
+		for _, v := range m {
+			if _, ok := p.fetched[v.FIGI]; !ok {
+				ids = append(ids, v.FIGI)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	prices, err := p.candlesService.GetLastPricesOnDB(from, ids...)
+	if err != nil {
+		p.logger.Errorf("GetLastPricesOnDB: %v", err)
+		return
+	}
+	for _, id := range ids {
+		p.fetched[id] = struct{}{}
+	}
+	for id, price := range prices {
+		p.lastPrices[id] = price
+	}
+}
+
+// GetPositionValues returns market value of long and short positions on from,
+// positions without known price are valued on entry price
+func (p *Portfolio) GetPositionValues(from time.Time) []PositionValue {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.updatePrices(from)
+
+	values := make([]PositionValue, 0, len(p.instruments)+len(p.shorts))
+	for _, v := range p.instruments {
+		value := v.EntryPrice
+		if price, ok := p.lastPrices[v.FIGI]; ok {
+			value = v.Lot * v.Quantity * price
+		}
+		values = append(values, PositionValue{FIGI: v.FIGI, Value: value})
+	}
+	for _, v := range p.shorts {
+		value := v.EntryPrice
+		if price, ok := p.lastPrices[v.FIGI]; ok {
+			value = v.Lot * v.Quantity * price
+		}
+		values = append(values, PositionValue{FIGI: v.FIGI, Value: -value})
+	}
+
+	return values
+}
+
+// GetBalanceWithInstruments returns mark-to-market balance: long positions are valued on last close price
+// minus liquidation commission, short positions are valued as liability to buy them back.
+// Instruments without known price are valued on entry price
 func (p *Portfolio) GetBalanceWithInstruments(from time.Time) float64 {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	sum := p.balance
+	p.updatePrices(from)
+
+	sum := p.balance + p.receivables
 	for _, v := range p.instruments {
-		// lp, err := p.candlesService.GetLastPriceOnDB(v.FIGI, from)
-		// if err != nil {
-		sum += v.EntryPrice
-		// 	continue
-		// }
-		// sum += v.Lot * v.Quantity * lp
+		price, ok := p.lastPrices[v.FIGI]
+		if !ok {
+			sum += v.EntryPrice
+			continue
+		}
+		sum += v.Lot * v.Quantity * price * (1 - p.taxes[model.InstrumentType(v.InstrumentType)])
+	}
+	for _, v := range p.shorts {
+		price, ok := p.lastPrices[v.FIGI]
+		if !ok {
+			continue
+		}
+		sum += v.EntryPrice - v.Lot*v.Quantity*price*(1+p.taxes[model.InstrumentType(v.InstrumentType)])
 	}
 
 	return sum
@@ -109,6 +219,25 @@ func (p *Portfolio) UpdateBalance(sellPrice float64, id string) {
 	}
 }
 
+// SellPartially updates balance with sold quantity and reduces instrument quantity and entry price proportionally
+func (p *Portfolio) SellPartially(sellPrice, quantity float64, id string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.balance += sellPrice
+
+	v, ok := p.instruments[id]
+	if !ok || v.Quantity <= 0 {
+		p.logger.Warnf("partial sell with price %f unknown id: %s", sellPrice, id)
+		return
+	}
+
+	entryPrice := v.EntryPrice * quantity / v.Quantity
+	p.logger.Infof("partial sell %f with price %f, profit %f percent", quantity, sellPrice, (sellPrice-entryPrice)/sellPrice*100)
+	v.Quantity -= quantity
+	v.EntryPrice -= entryPrice
+	p.instruments[id] = v
+}
+
 func (p *Portfolio) UpdateBalanceMargin(buyPrice float64, entryPrice float64) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -117,6 +246,52 @@ func (p *Portfolio) UpdateBalanceMargin(buyPrice float64, entryPrice float64) {
 	p.logger.Infof("margin with price %f, profit %f percent", profit, profit/buyPrice*100)
 }
 
+// AddReceivable registers dividend or coupon that will be paid later, negative for short positions
+func (p *Portfolio) AddReceivable(amount float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.receivables += amount
+}
+
+// ReceiveCash credits paid dividends and coupons to balance
+func (p *Portfolio) ReceiveCash(amount float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.receivables -= amount
+	p.balance += amount
+	p.logger.Infof("cash flow received %f", amount)
+}
+
+// ApplySplit changes lot size of positions for figi, so quantity in lots and entry price stay the same
+func (p *Portfolio) ApplySplit(figi string, ratio float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, m := range []map[string]model.PortfolioInstrument{p.instruments, p.shorts} {
+		for id, v := range m {
+			if v.FIGI == figi {
+				v.Lot *= ratio
+				m[id] = v
+			}
+		}
+	}
+}
+
+// PayMarginFee debits daily fee for uncovered positions
+func (p *Portfolio) PayMarginFee(fee float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.balance -= fee
+}
+
+// PayTax debits withheld tax from balance, negative tax is refund
+func (p *Portfolio) PayTax(tax float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.balance -= tax
+	p.logger.Infof("tax withheld %f", tax)
+}
+
 func (p *Portfolio) Buy(price float64) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -0,0 +1,52 @@
+package backtest
+
+import (
+	"github.com/STTM-NSU/trading-bot/internal/config"
+	"github.com/STTM-NSU/trading-bot/internal/model"
+)
+
+// SimulatedExecution is strategy.Execution over backtest executor,
+// prices are ignored because orders are filled on candles
+type SimulatedExecution struct {
+	executor *Executor
+}
+
+func NewSimulatedExecution(executor *Executor) SimulatedExecution {
+	return SimulatedExecution{executor: executor}
+}
+
+func (s SimulatedExecution) Buy(quantity, _ float64, i model.Instrument) {
+	s.executor.BuyMarket(quantity, i)
+}
+
+func (s SimulatedExecution) Sell(_ float64, i model.PortfolioInstrument, cfg config.OrderConfig) {
+	switch cfg.Type {
+	case config.Market:
+		s.executor.SellMarket(i)
+		return
+	case config.TrailingStop:
+		s.executor.SellTrailing(cfg.TrailPercent, i)
+		return
+	}
+	s.executor.SellLimit(cfg.ProfitPercentIndent, cfg.DefencePercentIndent, i)
+}
+
+func (s SimulatedExecution) Short(quantity, _ float64, i model.Instrument, cfg config.MarginTradingConfig) {
+	s.executor.SellMargin(quantity, cfg.ShortProfitPercent, cfg.HedgePercent, i)
+}
+
+func (s SimulatedExecution) CancelBuys() {
+	s.executor.RemoveBuyOrders()
+}
+
+func (s SimulatedExecution) CoverShorts() {
+	s.executor.BuyDeptMargin()
+}
+
+func (s SimulatedExecution) SellOut() {
+	s.executor.SellOut()
+}
+
+func (s SimulatedExecution) Liquidate() {
+	s.executor.SellOutPortfolio()
+}
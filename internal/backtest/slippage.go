@@ -0,0 +1,146 @@
+package backtest
+
+import (
+	"math"
+	"time"
+
+	"github.com/STTM-NSU/trading-bot/internal/config"
+	"github.com/STTM-NSU/trading-bot/internal/invest/md"
+	"github.com/STTM-NSU/trading-bot/internal/model"
+)
+
+// SlippageModel returns relative price move against the order, so buy fills on price * (1 + s)
+// and sell fills on price * (1 - s)
+type SlippageModel interface {
+	Slippage(instr TrackingInstrument, price float64, from time.Time) float64
+}
+
+func NewSlippageModels(cfg map[model.InstrumentType]config.SlippageConfig, cs *md.CandlesService) map[model.InstrumentType]SlippageModel {
+	models := make(map[model.InstrumentType]SlippageModel, len(cfg))
+	for t, c := range cfg {
+		switch c.Model {
+		case config.FixedSlippage:
+			models[t] = FixedSlippage{bps: c.BPS}
+		case config.SpreadSlippage:
+			models[t] = &SpreadSlippage{
+				spread:         c.Spread,
+				lookback:       c.SpreadLookback,
+				candlesService: cs,
+				estimates:      make(map[string]spreadEstimate),
+			}
+		case config.VolumeSlippage:
+			models[t] = VolumeSlippage{
+				coefficient:    c.ImpactCoefficient,
+				candlesService: cs,
+			}
+		}
+	}
+	return models
+}
+
+type FixedSlippage struct {
+	bps float64
+}
+
+func (s FixedSlippage) Slippage(TrackingInstrument, float64, time.Time) float64 {
+	return s.bps / 10_000
+}
+
+type spreadEstimate struct {
+	day    time.Time
+	spread float64
+}
+
+// SpreadSlippage crosses half of the spread, if spread isn't configured
+// it's estimated by Roll's estimator on close prices for lookback interval
+type SpreadSlippage struct {
+	spread   float64
+	lookback time.Duration
+
+	candlesService *md.CandlesService
+	estimates      map[string]spreadEstimate // figi -> estimate for day
+}
+
+func (s *SpreadSlippage) Slippage(instr TrackingInstrument, _ float64, from time.Time) float64 {
+	if s.spread > 0 {
+		return s.spread / 2
+	}
+
+	day := from.Truncate(24 * time.Hour)
+	if v, ok := s.estimates[instr.figi]; ok && v.day.Equal(day) {
+		return v.spread / 2
+	}
+
+	candles, err := s.candlesService.GetAdjustedCandlesFor(instr.figi, from.Add(-s.lookback), from)
+	if err != nil {
+		return 0
+	}
+	prices := make([]float64, 0, len(candles))
+	for _, c := range candles {
+		prices = append(prices, c.ClosePrice)
+	}
+	spread := RollSpread(prices)
+	s.estimates[instr.figi] = spreadEstimate{day: day, spread: spread}
+
+	return spread / 2
+}
+
+// RollSpread estimates relative bid-ask spread from serial covariance of price changes:
+// spread = 2 * sqrt(-cov(dp[t], dp[t-1])) / mean price, zero if covariance is positive
+func RollSpread(prices []float64) float64 {
+	if len(prices) < 3 {
+		return 0
+	}
+
+	diffs := make([]float64, 0, len(prices)-1)
+	mean := prices[0]
+	for i := 1; i < len(prices); i++ {
+		diffs = append(diffs, prices[i]-prices[i-1])
+		mean += prices[i]
+	}
+	mean /= float64(len(prices))
+
+	var diffMean float64
+	for _, d := range diffs {
+		diffMean += d
+	}
+	diffMean /= float64(len(diffs))
+
+	var cov float64
+	for i := 1; i < len(diffs); i++ {
+		cov += (diffs[i] - diffMean) * (diffs[i-1] - diffMean)
+	}
+	cov /= float64(len(diffs) - 1)
+
+	if cov >= 0 || mean == 0 {
+		return 0
+	}
+
+	return 2 * math.Sqrt(-cov) / mean
+}
+
+// VolumeSlippage uses square root market impact of order participation in bar volume
+type VolumeSlippage struct {
+	coefficient float64
+
+	candlesService *md.CandlesService
+}
+
+func (s VolumeSlippage) Slippage(instr TrackingInstrument, _ float64, from time.Time) float64 {
+	candle, err := s.candlesService.GetCandleOn(instr.figi, from)
+	if err != nil {
+		return 0
+	}
+	return VolumeImpact(s.coefficient, instr.quantity, candle.Volume)
+}
+
+// VolumeImpact returns coefficient * sqrt(quantity / volume), for empty bar whole coefficient is used
+func VolumeImpact(coefficient, quantity, volume float64) float64 {
+	if quantity <= 0 {
+		return 0
+	}
+	if volume <= 0 {
+		return coefficient
+	}
+	return coefficient * math.Sqrt(quantity/volume)
+}
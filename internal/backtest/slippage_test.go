@@ -0,0 +1,35 @@
+package backtest
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRollSpread(t *testing.T) {
+	// bid-ask bounce around 100 with spread 1
+	prices := []float64{99.5, 100.5, 99.5, 100.5, 99.5, 100.5, 99.5, 100.5}
+	if s := RollSpread(prices); s <= 0 || s > 0.03 {
+		t.Errorf("unexpected spread for bounce: %f", s)
+	}
+
+	// trending prices have positive covariance
+	if s := RollSpread([]float64{100, 101, 102, 103, 104, 105}); s != 0 {
+		t.Errorf("expected zero spread for trend, got %f", s)
+	}
+
+	if s := RollSpread([]float64{100, 101}); s != 0 {
+		t.Errorf("expected zero spread for short series, got %f", s)
+	}
+}
+
+func TestVolumeImpact(t *testing.T) {
+	if v := VolumeImpact(0.1, 25, 100); math.Abs(v-0.05) > 1e-9 {
+		t.Errorf("expected 0.05, got %f", v)
+	}
+	if v := VolumeImpact(0.1, 10, 0); v != 0.1 {
+		t.Errorf("expected coefficient for empty bar, got %f", v)
+	}
+	if v := VolumeImpact(0.1, 0, 100); v != 0 {
+		t.Errorf("expected zero for empty order, got %f", v)
+	}
+}
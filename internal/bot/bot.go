@@ -1,7 +1,157 @@
 package bot
 
+import (
+	"context"
+	"time"
+
+	"github.com/STTM-NSU/trading-bot/internal/backtest/engine"
+	"github.com/STTM-NSU/trading-bot/internal/config"
+	"github.com/STTM-NSU/trading-bot/internal/logger"
+	"github.com/STTM-NSU/trading-bot/internal/model"
+	"github.com/STTM-NSU/trading-bot/internal/strategy"
+)
+
+// hours are in utc as in backtest engine
+const (
+	_tickInterval     = 1 * time.Minute // resting orders are maintained on every tick
+	_techCheckHour    = 12
+	_sessionCloseHour = 19
+	_rebalanceHour    = 20
+)
+
+// RestingOrders is optional for execution, orders resting at broker are maintained between rebalances
+type RestingOrders interface {
+	TrailStops()
+	RepriceOrders() // limit orders priced by order book follow the touch
+}
+
+// ShortCover is optional for execution, shorts are covered before session end of trading schedule
+type ShortCover interface {
+	CoverShortsBeforeClose(now time.Time, schedule model.TradingSchedule, cfg config.MarginTradingConfig)
+}
+
+type Schedules interface {
+	GetInstrumentTradingSchedule(i model.Instrument, from, to time.Time) ([]model.TradingSchedule, error)
+}
+
+// TradingBot runs the same strategy as backtest on wall clock with live execution
 type TradingBot struct {
+	logger    logger.Logger
+	strategy  *strategy.STTM
+	execution strategy.Execution
+	schedules Schedules
+	exchange  model.Instrument // its exchange schedule is used for the whole universe
+
+	interval  config.CalculationInterval
+	marginCfg config.MarginTradingConfig
+
+	lastHour    time.Time
+	schedule    model.TradingSchedule
+	scheduleDay time.Time
 }
 
-type Portfolio struct {
+func NewTradingBot(
+	logger logger.Logger,
+	strategy *strategy.STTM,
+	execution strategy.Execution,
+	schedules Schedules,
+	exchange model.Instrument,
+	interval config.CalculationInterval,
+	marginCfg config.MarginTradingConfig,
+) *TradingBot {
+	return &TradingBot{
+		logger:    logger,
+		strategy:  strategy,
+		execution: execution,
+		schedules: schedules,
+		exchange:  exchange,
+		interval:  interval,
+		marginCfg: marginCfg,
+	}
+}
+
+func (t *TradingBot) Rebalance(ctx context.Context, from, to time.Time) error {
+	return t.strategy.Rebalance(ctx, from, to)
+}
+
+func (t *TradingBot) CheckTechIndicators(now time.Time) {
+	t.strategy.CheckTechIndicators(now)
+}
+
+func (t *TradingBot) CloseSession() {
+	t.strategy.CloseSession()
+}
+
+// Run ticks until ctx is done, hourly events happen on the first tick of hour as backtest events
+func (t *TradingBot) Run(ctx context.Context) {
+	t.lastHour = time.Now().UTC().Truncate(time.Hour)
+
+	ticker := time.NewTicker(_tickInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			t.tick(ctx, now.UTC())
+		}
+	}
+}
+
+func (t *TradingBot) tick(ctx context.Context, now time.Time) {
+	if o, ok := t.execution.(RestingOrders); ok {
+		o.TrailStops()
+		o.RepriceOrders()
+	}
+	if c, ok := t.execution.(ShortCover); ok && t.marginCfg.Enabled {
+		if schedule, ok := t.scheduleOn(now); ok {
+			c.CoverShortsBeforeClose(now, schedule, t.marginCfg)
+		}
+	}
+
+	hour := now.Truncate(time.Hour)
+	if !hour.After(t.lastHour) {
+		return
+	}
+	t.lastHour = hour
+	if engine.IsWeekend(hour) {
+		return
+	}
+
+	// weekly mode rebalances on friday, daily mode after every session
+	rebalanceDay := t.interval == config.Day || hour.Weekday() == time.Friday
+	switch {
+	case hour.Hour() == _techCheckHour:
+		t.CheckTechIndicators(hour)
+	case hour.Hour() == _sessionCloseHour && rebalanceDay:
+		t.CloseSession()
+	case hour.Hour() == _rebalanceHour && rebalanceDay:
+		from := engine.CalculationStart(t.interval, hour)
+		t.logger.Infof("Rebalance on: %s, sttm from %s", hour, from)
+		if err := t.Rebalance(ctx, from, hour); err != nil {
+			t.logger.Errorf("%s: rebalance failed", err)
+		}
+	}
+}
+
+// scheduleOn returns trading schedule of the day, it is requested once a day
+func (t *TradingBot) scheduleOn(now time.Time) (model.TradingSchedule, bool) {
+	day := now.Truncate(24 * time.Hour)
+	if t.scheduleDay.Equal(day) {
+		return t.schedule, true
+	}
+
+	schedules, err := t.schedules.GetInstrumentTradingSchedule(t.exchange, day, day.Add(24*time.Hour))
+	if err != nil {
+		t.logger.Errorf("%s: can't get trading schedule of %s", err, t.exchange.ExchangeSection)
+		return model.TradingSchedule{}, false
+	}
+	t.schedule, t.scheduleDay = model.TradingSchedule{}, day // not trading day if there is no schedule
+	for _, s := range schedules {
+		// date of exchange day can be midnight of exchange time zone
+		if d := s.Date.Sub(day); d > -12*time.Hour && d < 12*time.Hour {
+			t.schedule = s
+		}
+	}
+	return t.schedule, true
 }
@@ -0,0 +1,564 @@
+package bot
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/STTM-NSU/trading-bot/internal/config"
+	"github.com/STTM-NSU/trading-bot/internal/invest/broker"
+	"github.com/STTM-NSU/trading-bot/internal/invest/executor"
+	"github.com/STTM-NSU/trading-bot/internal/logger"
+	"github.com/STTM-NSU/trading-bot/internal/model"
+	"github.com/STTM-NSU/trading-bot/internal/portfolio"
+	"github.com/STTM-NSU/trading-bot/internal/strategy"
+)
+
+// LivePortfolio is strategy.Portfolio over account portfolio in one currency
+type LivePortfolio struct {
+	portfolio *portfolio.Portfolio
+	currency  string
+	logger    logger.Logger
+}
+
+func NewLivePortfolio(portfolio *portfolio.Portfolio, currency string, logger logger.Logger) LivePortfolio {
+	return LivePortfolio{
+		portfolio: portfolio,
+		currency:  currency,
+		logger:    logger,
+	}
+}
+
+func (p LivePortfolio) GetBalance() float64 {
+	return p.portfolio.GetBalance(p.currency)
+}
+
+// GetInstruments returns long positions
+func (p LivePortfolio) GetInstruments() map[string]model.PortfolioInstrument {
+	return p.positions(false)
+}
+
+// GetShorts returns short positions of paper portfolio, shorts of account are tracked by executor
+func (p LivePortfolio) GetShorts() map[string]model.PortfolioInstrument {
+	return p.positions(true)
+}
+
+func (p LivePortfolio) positions(short bool) map[string]model.PortfolioInstrument {
+	instruments, err := p.portfolio.GetInstruments()
+	if err != nil {
+		p.logger.Errorf("%s: can't get portfolio instruments", err)
+		return nil
+	}
+	m := make(map[string]model.PortfolioInstrument, len(instruments))
+	for _, i := range instruments {
+		if i.IsShort() == short {
+			m[i.InstrumentID] = i
+		}
+	}
+	return m
+}
+
+func (p LivePortfolio) update(i model.PortfolioInstrument, balanceDiff float64) {
+	p.portfolio.UpdateInstrument(i)
+	p.portfolio.UpdateBalance(model.Balance{Value: balanceDiff, Currency: p.currency, AccountID: i.AccountID})
+}
+
+func (p LivePortfolio) remove(i model.PortfolioInstrument, balanceDiff float64) {
+	p.portfolio.RemoveInstrument(i)
+	p.portfolio.UpdateBalance(model.Balance{Value: balanceDiff, Currency: p.currency, AccountID: i.AccountID})
+}
+
+type placedOrder struct {
+	instrument model.PortfolioInstrument
+	orderType  config.OrderType
+	executed   float64 // lots
+}
+
+func (o placedOrder) is(s model.OrderState) bool {
+	return o.instrument.OrderID == s.OrderID || (s.OrderRequestID != "" && o.instrument.OrderRequestID == s.OrderRequestID)
+}
+
+// LiveExecution is strategy.Execution which sends orders to the broker
+// and remembers placed orders to cancel them on rebalance
+type LiveExecution struct {
+	logger     logger.Logger
+	executor   *executor.Executor
+	portfolio  LivePortfolio
+	marketData strategy.MarketData
+
+	accountID string
+	ordersCfg config.OrdersConfig
+	rates     map[string]model.RiskRates // figi -> risk rates
+
+	mu          sync.Mutex
+	buys        map[string]placedOrder // instrument uid -> placed order
+	sells       map[string]placedOrder
+	notTradable map[string]struct{} // instruments refused by broker
+}
+
+func NewLiveExecution(
+	logger logger.Logger,
+	executor *executor.Executor,
+	portfolio LivePortfolio,
+	marketData strategy.MarketData,
+	accountID string,
+	ordersCfg config.OrdersConfig,
+	rates map[string]model.RiskRates,
+) *LiveExecution {
+	return &LiveExecution{
+		logger:      logger,
+		executor:    executor,
+		portfolio:   portfolio,
+		marketData:  marketData,
+		accountID:   accountID,
+		ordersCfg:   ordersCfg,
+		rates:       rates,
+		buys:        make(map[string]placedOrder),
+		sells:       make(map[string]placedOrder),
+		notTradable: make(map[string]struct{}),
+	}
+}
+
+func (e *LiveExecution) toPortfolioInstrument(quantity float64, i model.Instrument) model.PortfolioInstrument {
+	return model.PortfolioInstrument{
+		InstrumentType:    string(i.InstrumentType),
+		Quantity:          quantity,
+		Lot:               float64(i.Lot),
+		MinPriceIncrement: i.MinPriceIncrement,
+		InstrumentID:      i.UID,
+		FIGI:              i.FIGI,
+		AccountID:         e.accountID,
+	}
+}
+
+func (e *LiveExecution) Buy(quantity, price float64, i model.Instrument) {
+	instr := e.toPortfolioInstrument(quantity, i)
+	orderRequestId, orderId, err := e.executor.Buy(price, instr)
+	if err != nil {
+		e.logger.Errorf("%s: can't buy %s", err, i.UID)
+		e.markNotTradable(i.UID, err)
+		return
+	}
+	instr.OrderRequestID, instr.OrderID = orderRequestId, orderId
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.buys[i.UID] = placedOrder{instrument: instr, orderType: e.ordersCfg.BuyOrder.Type}
+}
+
+func (e *LiveExecution) Sell(price float64, i model.PortfolioInstrument, cfg config.OrderConfig) {
+	held, isHeld := e.portfolio.GetInstruments()[i.InstrumentID]
+	if isHeld && cfg.Type.IsStop() && held.ExitOrderID != "" { // exit leg is replaced
+		if err := e.executor.CancelStop(held.AccountID, held.ExitOrderID); err != nil {
+			e.logger.Warnf("%s: can't cancel exit order of %s", err, i.InstrumentID)
+		}
+	}
+
+	orderRequestId, orderId, err := e.executor.Sell(price, i, cfg)
+	if err != nil {
+		e.logger.Errorf("%s: can't sell %s", err, i.InstrumentID)
+		return
+	}
+	i.OrderRequestID, i.OrderID = orderRequestId, orderId
+
+	if isHeld && cfg.Type.IsStop() { // exit stop and hedge make bracket
+		held.ExitOrderID = orderId
+		e.portfolio.update(held, 0)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.sells[i.InstrumentID] = placedOrder{instrument: i, orderType: cfg.Type}
+}
+
+func (e *LiveExecution) Short(quantity, price float64, i model.Instrument, cfg config.MarginTradingConfig) {
+	if quantity <= 0 {
+		return
+	}
+	if _, err := e.executor.SellShort(price, e.toPortfolioInstrument(quantity, i), e.rates[i.FIGI], cfg); err != nil {
+		e.logger.Errorf("%s: can't short %s", err, i.UID)
+		e.markNotTradable(i.UID, err)
+	}
+}
+
+// IsNotTradable implements strategy.NotTradable
+func (e *LiveExecution) IsNotTradable(instrumentId string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, ok := e.notTradable[instrumentId]
+	return ok
+}
+
+func (e *LiveExecution) markNotTradable(instrumentId string, err error) {
+	if !errors.Is(err, broker.ErrNotTradable) {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.notTradable[instrumentId] = struct{}{}
+}
+
+func (e *LiveExecution) CancelBuys() {
+	e.mu.Lock()
+	buys := e.buys
+	e.buys = make(map[string]placedOrder)
+	e.mu.Unlock()
+
+	for id, o := range buys {
+		if err := e.executor.CancelOrder(o.instrument, o.orderType); err != nil {
+			e.logger.Warnf("%s: can't cancel buy order for %s", err, id)
+		}
+	}
+	e.executor.ResetReservedCash()
+}
+
+func (e *LiveExecution) CoverShorts() {
+	for _, s := range e.executor.GetShorts() {
+		if err := e.executor.CoverShort(s); err != nil {
+			e.logger.Errorf("%s: can't cover short %s", err, s.Instrument.InstrumentID)
+		}
+	}
+}
+
+// CoverShortsBeforeClose covers shorts when session end of schedule is closer than cfg.CoverBeforeClose
+func (e *LiveExecution) CoverShortsBeforeClose(now time.Time, schedule model.TradingSchedule, cfg config.MarginTradingConfig) {
+	e.executor.CoverShortsBeforeClose(now, schedule, cfg)
+}
+
+// SellOut replaces not filled sell orders with market ones
+func (e *LiveExecution) SellOut() {
+	e.sellOut()
+}
+
+func (e *LiveExecution) sellOut() map[string]struct{} {
+	e.mu.Lock()
+	sells := make([]placedOrder, 0, len(e.sells))
+	for id, o := range e.sells {
+		sells = append(sells, o)
+		delete(e.sells, id)
+	}
+	e.mu.Unlock()
+
+	sold := make(map[string]struct{}, len(sells))
+	for _, o := range sells {
+		if err := e.executor.CancelOrder(o.instrument, o.orderType); err != nil {
+			e.logger.Warnf("%s: can't cancel sell order for %s", err, o.instrument.InstrumentID)
+		}
+		e.sellMarket(o.instrument)
+		sold[o.instrument.InstrumentID] = struct{}{}
+	}
+	return sold
+}
+
+func (e *LiveExecution) Liquidate() {
+	sold := e.sellOut()
+	for id, i := range e.portfolio.GetInstruments() {
+		if _, ok := sold[id]; !ok {
+			e.sellMarket(i)
+		}
+	}
+}
+
+// OnOrderState updates portfolio on fills of placed orders, every buy fill gets protective hedge
+// for the whole position and hedge is resized or cancelled on sell fills
+func (e *LiveExecution) OnOrderState(s model.OrderState) {
+	if p, ok := e.executor.ParentState(s); ok { // child order of execution algorithm
+		s = p
+	}
+	if e.executor.OnShortOrder(s) {
+		return
+	}
+
+	if o, ok := e.onOrderState(s); ok {
+		e.placeRemaining(o)
+	}
+}
+
+// onOrderState returns filled limit order which quantity was capped by order book depth.
+// Placed orders are copied under lock and broker is called without it, so the bot tick isn't blocked by retries
+func (e *LiveExecution) onOrderState(s model.OrderState) (executor.RestingOrder, bool) {
+	if o, buy, ok := e.placed(s); ok {
+		o = e.onFill(o, s, buy)
+		if !e.storePlaced(o, s, buy) || !s.Done {
+			return executor.RestingOrder{}, false
+		}
+		return e.takeRemaining(o, s)
+	}
+
+	if s.Buy && e.executor.OnCoverFill(s) { // cover stop of short fired
+		return executor.RestingOrder{}, false
+	}
+
+	// exchange order of fired stop has its own id
+	if held, ok := e.portfolio.GetInstruments()[s.InstrumentID]; ok && !s.Buy && executor.HasBracket(held) {
+		e.logger.Infof("bracket leg of %s fired, order %s", s.InstrumentID, s.OrderID)
+		e.executor.CancelBracket(held)
+		held.ExitOrderID, held.HedgeOrderID = "", ""
+		e.portfolio.update(held, 0)
+
+		held.OrderID, held.OrderRequestID = s.OrderID, s.OrderRequestID
+		o := e.onFill(placedOrder{instrument: held, orderType: config.Market}, s, false)
+		if !s.Done {
+			e.mu.Lock()
+			e.sells[s.InstrumentID] = o
+			e.mu.Unlock()
+		}
+	}
+	return executor.RestingOrder{}, false
+}
+
+// placed returns placed order of state and whether it is buy
+func (e *LiveExecution) placed(s model.OrderState) (placedOrder, bool, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if o, ok := e.buys[s.InstrumentID]; ok && o.is(s) {
+		return o, true, true
+	}
+	if o, ok := e.sells[s.InstrumentID]; ok && o.is(s) {
+		return o, false, true
+	}
+	return placedOrder{}, false, false
+}
+
+// storePlaced updates placed order or removes it when it is done,
+// it returns false if order was replaced or cancelled meanwhile
+func (e *LiveExecution) storePlaced(o placedOrder, s model.OrderState, buy bool) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	placedOrders := e.sells
+	if buy {
+		placedOrders = e.buys
+	}
+	if cur, ok := placedOrders[s.InstrumentID]; !ok || !cur.is(s) {
+		return false
+	}
+	if s.Done {
+		delete(placedOrders, s.InstrumentID)
+	} else {
+		placedOrders[s.InstrumentID] = o
+	}
+	return true
+}
+
+func (e *LiveExecution) takeRemaining(o placedOrder, s model.OrderState) (executor.RestingOrder, bool) {
+	if s.LotsLeft > 0 {
+		e.logger.Infof("order %s of %s is done with %f lots left", s.OrderID, s.InstrumentID, s.LotsLeft)
+	}
+	r, ok := e.executor.TakeResting(o.instrument.OrderRequestID)
+	if !ok || r.Remaining <= 0 || s.LotsLeft > 0 { // not filled order isn't continued
+		return executor.RestingOrder{}, false
+	}
+	return r, true
+}
+
+// placeRemaining places lots which weren't placed because of order book depth cap, when capped order is filled
+func (e *LiveExecution) placeRemaining(r executor.RestingOrder) {
+	i := r.Instrument
+	i.Quantity, i.OrderRequestID, i.OrderID = r.Remaining, "", ""
+	price, err := e.marketData.GetLastPriceOn(i.InstrumentID, time.Now())
+	if err != nil {
+		e.logger.Errorf("%s: can't get last price for %s", err, i.InstrumentID)
+		return
+	}
+	e.logger.Infof("place remaining %f lots of %s", i.Quantity, i.InstrumentID)
+
+	var (
+		orderRequestId, orderId string
+		o                       = placedOrder{orderType: config.Limit}
+	)
+	if r.Buy {
+		o.orderType = e.ordersCfg.BuyOrder.Type
+		orderRequestId, orderId, err = e.executor.Buy(price, i)
+	} else {
+		orderRequestId, orderId, err = e.executor.Sell(price, i, config.OrderConfig{Type: config.Limit})
+	}
+	if err != nil {
+		e.logger.Errorf("%s: can't place remaining lots of %s", err, i.InstrumentID)
+		return
+	}
+	i.OrderRequestID, i.OrderID = orderRequestId, orderId
+	o.instrument = i
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if r.Buy {
+		e.buys[i.InstrumentID] = o
+	} else {
+		e.sells[i.InstrumentID] = o
+	}
+}
+
+// RepriceOrders replaces resting limit orders when the touch moved away from them
+func (e *LiveExecution) RepriceOrders() {
+	e.mu.Lock()
+	orders := make([]placedOrder, 0, len(e.buys)+len(e.sells))
+	for _, o := range e.buys {
+		orders = append(orders, o)
+	}
+	for _, o := range e.sells {
+		orders = append(orders, o)
+	}
+	e.mu.Unlock()
+
+	for _, o := range orders {
+		r, ok := e.executor.Resting(o.instrument.OrderRequestID)
+		if !ok {
+			continue
+		}
+		r.Instrument.Quantity -= o.executed
+		if r.Instrument.Quantity <= 0 {
+			continue
+		}
+		r, moved, err := e.executor.Reprice(r)
+		if err != nil {
+			e.logger.Errorf("%s: can't reprice order of %s", err, o.instrument.InstrumentID)
+			continue
+		}
+		if !moved {
+			continue
+		}
+
+		e.mu.Lock()
+		placedOrders := e.sells
+		if r.Buy {
+			placedOrders = e.buys
+		}
+		if placed, ok := placedOrders[o.instrument.InstrumentID]; ok && placed.instrument.OrderRequestID == o.instrument.OrderRequestID {
+			placed.instrument.OrderRequestID, placed.instrument.OrderID = r.Instrument.OrderRequestID, r.Instrument.OrderID
+			placed.executed = 0 // executed lots of replaced order are already in portfolio
+			placedOrders[o.instrument.InstrumentID] = placed
+		}
+		e.mu.Unlock()
+	}
+}
+
+// ReconcileBrackets cancels orphaned bracket legs after restart: sell stops of positions that are gone
+// and siblings of legs that fired while bot was down
+func (e *LiveExecution) ReconcileBrackets() error {
+	active, err := e.executor.GetStopOrders(e.accountID)
+	if err != nil {
+		return err
+	}
+	instruments := e.portfolio.GetInstruments()
+
+	for _, id := range executor.OrphanedLegs(active, instruments) {
+		e.logger.Infof("cancel orphaned stop order %s", id)
+		if err := e.executor.CancelStop(e.accountID, id); err != nil {
+			e.logger.Warnf("%s: can't cancel orphaned stop order", err)
+		}
+	}
+
+	activeIDs := make(map[string]struct{}, len(active))
+	for _, o := range active {
+		activeIDs[o.ID] = struct{}{}
+	}
+	for _, i := range instruments {
+		_, exitActive := activeIDs[i.ExitOrderID]
+		_, hedgeActive := activeIDs[i.HedgeOrderID]
+		if !executor.HasBracket(i) || (exitActive || i.ExitOrderID == "") && (hedgeActive || i.HedgeOrderID == "") {
+			continue
+		}
+		i.ExitOrderID, i.HedgeOrderID = "", "" // bracket is broken
+		e.portfolio.update(i, 0)
+	}
+	return nil
+}
+
+func (e *LiveExecution) onFill(o placedOrder, s model.OrderState, buy bool) placedOrder {
+	lots := s.LotsExecuted - o.executed
+	if lots <= 0 {
+		return o
+	}
+	o.executed = s.LotsExecuted
+
+	held, ok := e.portfolio.GetInstruments()[s.InstrumentID]
+	if !ok {
+		held = o.instrument
+		held.Quantity, held.EntryPrice = 0, 0
+	}
+	if !buy && held.Quantity <= 0 {
+		e.logger.Warnf("sell fill of %s which isn't in portfolio, order %s", s.InstrumentID, s.OrderID)
+		return o
+	}
+	amount := lots * held.Lot * s.ExecutedPrice
+	if buy {
+		e.executor.ReleaseCash(held.InstrumentID, amount)
+		held.Quantity += lots
+		held.EntryPrice += amount
+		amount = -amount
+	} else {
+		held.EntryPrice *= max(held.Quantity-lots, 0) / held.Quantity
+		held.Quantity -= lots
+	}
+	hedgePrice := s.ExecutedPrice
+	if held.Quantity > 0 { // position is hedged from average entry
+		hedgePrice = held.EntryPrice / (held.Quantity * held.Lot)
+	}
+
+	var (
+		hedgeID string
+		err     error
+	)
+	if buy || s.Done {
+		hedgeID, err = e.executor.ReplaceHedge(hedgePrice, held)
+	} else { // hedge with the rest of sell order could sell more than held
+		err = e.executor.CancelHedge(held)
+	}
+	if err != nil {
+		e.logger.Errorf("%s: can't replace hedge for %s", err, held.InstrumentID)
+	}
+	held.HedgeOrderID = hedgeID
+
+	if held.Quantity <= 0 {
+		e.executor.CancelBracket(held) // exit stop is left after sell by other order
+		e.portfolio.remove(held, amount)
+		return o
+	}
+	e.portfolio.update(held, amount)
+	return o
+}
+
+// TrailStops moves stop losses re-posted by bot after price rises
+func (e *LiveExecution) TrailStops() {
+	for _, o := range e.executor.GetTrailing() {
+		price, err := e.marketData.GetLastPriceOn(o.Instrument.InstrumentID, time.Now())
+		if err != nil {
+			e.logger.Errorf("%s: can't get last price for %s", err, o.Instrument.InstrumentID)
+			continue
+		}
+		o, _, err = e.executor.Trail(o.Instrument.InstrumentID, price)
+		if err != nil {
+			e.logger.Errorf("%s: can't trail stop for %s", err, o.Instrument.InstrumentID)
+		}
+		// exit leg is re-posted or cancelled before failed re-post
+		if held, ok := e.portfolio.GetInstruments()[o.Instrument.InstrumentID]; ok && held.ExitOrderID != o.Instrument.OrderID {
+			held.ExitOrderID = o.Instrument.OrderID
+			e.portfolio.update(held, 0)
+		}
+	}
+}
+
+func (e *LiveExecution) sellMarket(i model.PortfolioInstrument) {
+	price, err := e.marketData.GetLastPriceOn(i.InstrumentID, time.Now())
+	if err != nil {
+		e.logger.Errorf("%s: can't get last price for %s", err, i.InstrumentID)
+		return
+	}
+	if held, ok := e.portfolio.GetInstruments()[i.InstrumentID]; ok && executor.HasBracket(held) {
+		// stops mustn't fire after position is sold
+		e.executor.CancelBracket(held)
+		held.ExitOrderID, held.HedgeOrderID = "", ""
+		e.portfolio.update(held, 0)
+	}
+
+	orderRequestId, orderId, err := e.executor.Sell(price, i, config.OrderConfig{Type: config.Market})
+	if err != nil {
+		e.logger.Errorf("%s: can't sell market %s", err, i.InstrumentID)
+		return
+	}
+	i.OrderRequestID, i.OrderID = orderRequestId, orderId
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.sells[i.InstrumentID] = placedOrder{instrument: i, orderType: config.Market}
+}
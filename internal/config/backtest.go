@@ -9,19 +9,38 @@ import (
 
 type BacktestConfig struct {
 	TradingBotConfig
-	MarginTradingConfig
 	Taxes    map[model.InstrumentType]float64
-	From, To time.Time
+	Slippage map[model.InstrumentType]SlippageConfig
+	// MaxVolumeParticipation is max part of hour bar volume that order can fill, remainder waits for next bars
+	MaxVolumeParticipation float64
+	NDFL                   []model.TaxBracket // empty for no income tax
+	CashFlows              CashFlowsConfig
+	PrewarmSTTM            bool // caches sttm indexes of all rebalances in background
+	From, To               time.Time
 }
 
-type MarginTradingConfig struct {
-	Enabled            bool
-	STTMTop            float64
-	STTMThreshold      float64
-	STTMUpperThreshold float64
-	ShortProfitPercent float64
-	HedgePercent       float64
-	MarginTaxes        map[float64]float64
+type CashFlowsConfig struct {
+	Enabled bool
+	File    string  // yaml file with cash flows, if empty they're requested from api
+	Tax     float64 // withheld from dividends and coupons
+}
+
+type SlippageModel string
+
+const (
+	FixedSlippage  SlippageModel = "fixed"  // constant basis points from close price
+	SpreadSlippage SlippageModel = "spread" // half of configured or estimated spread
+	VolumeSlippage SlippageModel = "volume" // impact from participation in bar volume
+)
+
+type SlippageConfig struct {
+	Model SlippageModel
+	BPS   float64 // for fixed model, 1 bps = 0.0001
+
+	Spread         float64       // relative spread, estimated from candles when zero
+	SpreadLookback time.Duration // candles interval for spread estimation
+
+	ImpactCoefficient float64 // slippage = coefficient * sqrt(quantity / bar volume)
 }
 
 func parseTimeNoErr(s string) time.Time {
@@ -37,16 +56,43 @@ var BacktestCfg = BacktestConfig{
 	To:   parseTimeNoErr("2025-01-06T00:00:00Z"), // для 24 года запуск
 	// To:    parseTimeNoErr("2025-02-26T00:00:00Z"), // для 24 года запуск
 	Taxes: model.InvestorTaxes,
-	MarginTradingConfig: MarginTradingConfig{
-		Enabled:            false,
-		STTMTop:            0.1,
-		STTMThreshold:      -1500,
-		STTMUpperThreshold: 1000,
-		ShortProfitPercent: 0.005,
-		HedgePercent:       0.05,
-		MarginTaxes:        model.MarginTaxPerDay,
+	Slippage: map[model.InstrumentType]SlippageConfig{
+		model.Share: {
+			Model:          SpreadSlippage,
+			SpreadLookback: 5 * 24 * time.Hour,
+		},
+		model.Etf: {
+			Model: FixedSlippage,
+			BPS:   5,
+		},
+		model.Bond: {
+			Model:             VolumeSlippage,
+			ImpactCoefficient: 0.1,
+		},
 	},
+	MaxVolumeParticipation: 0.1,
+	NDFL:                   model.NDFLBrackets,
+	CashFlows: CashFlowsConfig{
+		Enabled: true,
+		Tax:     0.13,
+	},
+	PrewarmSTTM: true,
 	TradingBotConfig: TradingBotConfig{
+		MarginTradingConfig: MarginTradingConfig{
+			Enabled:            false,
+			STTMTop:            0.1,
+			STTMThreshold:      -1500,
+			STTMUpperThreshold: 1000,
+			ShortProfitPercent: 0.005,
+			HedgePercent:       0.05,
+			MarginTaxes:        model.MarginTaxPerDay,
+			DefaultRiskRates: model.RiskRates{
+				Dlong:     0.25,
+				Dshort:    0.3,
+				DlongMin:  0.125,
+				DshortMin: 0.15,
+			},
+		},
 		StartAmountOfMoney: []model.MoneyValue{
 			{
 				Currency: "RUB",
@@ -91,7 +137,8 @@ var BacktestCfg = BacktestConfig{
 				DefencePercentIndent: 0.3,
 			},
 			BuyOrder: OrderConfig{
-				Type: Market,
+				Type:    Market,
+				Timeout: 24 * time.Hour,
 			},
 			HedgeOrder: OrderConfig{
 				Type:                 Limit,
@@ -111,5 +158,32 @@ func (b BacktestConfig) Validate() error {
 		return fmt.Errorf("from after to: [%v, %v]", b.From, b.To)
 	}
 
+	if b.CashFlows.Tax < 0 || b.CashFlows.Tax >= 1 {
+		return fmt.Errorf("cash flows tax must be in [0, 1): %f", b.CashFlows.Tax)
+	}
+
+	if b.MaxVolumeParticipation < 0 || b.MaxVolumeParticipation > 1 {
+		return fmt.Errorf("max volume participation must be in [0, 1]: %f", b.MaxVolumeParticipation)
+	}
+
+	for t, s := range b.Slippage {
+		switch s.Model {
+		case FixedSlippage:
+			if s.BPS < 0 {
+				return fmt.Errorf("negative slippage bps for %s", t)
+			}
+		case SpreadSlippage:
+			if s.Spread <= 0 && s.SpreadLookback <= 0 {
+				return fmt.Errorf("spread or spread lookback is required for %s", t)
+			}
+		case VolumeSlippage:
+			if s.ImpactCoefficient <= 0 {
+				return fmt.Errorf("impact coefficient is required for %s", t)
+			}
+		default:
+			return fmt.Errorf("unknown slippage model %q for %s", s.Model, t)
+		}
+	}
+
 	return nil
 }
@@ -42,6 +42,42 @@ type STTMConfig struct {
 	TopSTTMThreshold    float64             `yaml:"top_sttm_treshold"`
 	CalculationInterval CalculationInterval `yaml:"calculation_interval"`
 	STTMHyperparameters STTMHyperparameters `yaml:"sttm_hyperparameters"`
+	Client              STTMClientConfig    `yaml:"client"`
+}
+
+// STTMClientConfig limits requests to sttm service, instruments are requested by batches in parallel
+type STTMClientConfig struct {
+	BatchSize       int           `yaml:"batch_size"`
+	Parallel        int           `yaml:"parallel"`
+	MaxRetries      int           `yaml:"max_retries"`      // per batch
+	MaxWait         time.Duration `yaml:"max_wait"`         // for all batches with retries
+	RetryDelay      time.Duration `yaml:"retry_delay"`      // when service doesn't return retry after
+	BreakerFailures int           `yaml:"breaker_failures"` // consecutive failed requests to open circuit breaker
+	BreakerCooldown time.Duration `yaml:"breaker_cooldown"`
+}
+
+func (c *STTMClientConfig) Setup() {
+	if c.BatchSize <= 0 {
+		c.BatchSize = 50
+	}
+	if c.Parallel <= 0 {
+		c.Parallel = 4
+	}
+	if c.MaxRetries <= 0 {
+		c.MaxRetries = 5
+	}
+	if c.MaxWait <= 0 {
+		c.MaxWait = 30 * time.Minute
+	}
+	if c.RetryDelay <= 0 {
+		c.RetryDelay = 5 * time.Second
+	}
+	if c.BreakerFailures <= 0 {
+		c.BreakerFailures = 5
+	}
+	if c.BreakerCooldown <= 0 {
+		c.BreakerCooldown = time.Minute
+	}
 }
 
 const (
@@ -80,6 +116,7 @@ func (c *STTMConfig) Setup() error {
 	if c.STTMHyperparameters.Threshold <= 0 {
 		c.STTMHyperparameters.Threshold = _thresholdDefault
 	}
+	c.Client.Setup()
 
 	return nil
 }
@@ -92,6 +129,8 @@ const (
 	StopLoss   OrderType = "stopLoss"
 	StopLimit  OrderType = "stopLimit"
 	TakeProfit OrderType = "takeProfit"
+	// TrailingStop sells when price falls by TrailPercent from the running high since entry
+	TrailingStop OrderType = "trailingStop"
 )
 
 func (o OrderType) ToInvestType() investapi.OrderType {
@@ -105,13 +144,22 @@ func (o OrderType) ToInvestType() investapi.OrderType {
 	}
 }
 
+func (o OrderType) IsStop() bool {
+	switch o {
+	case StopLoss, StopLimit, TakeProfit, TrailingStop:
+		return true
+	default:
+		return false
+	}
+}
+
 func (o OrderType) ToInvestStopType() investapi.StopOrderType {
 	switch o {
 	case StopLoss:
 		return investapi.StopOrderType_STOP_ORDER_TYPE_STOP_LOSS
 	case StopLimit:
 		return investapi.StopOrderType_STOP_ORDER_TYPE_STOP_LIMIT
-	case TakeProfit:
+	case TakeProfit, TrailingStop: // broker trailing is take profit with trailing data
 		return investapi.StopOrderType_STOP_ORDER_TYPE_TAKE_PROFIT
 	default:
 		return investapi.StopOrderType_STOP_ORDER_TYPE_UNSPECIFIED
@@ -123,6 +171,41 @@ type OrderConfig struct {
 	ProfitPercentIndent  float64       `yaml:"max_percent_indent"`
 	DefencePercentIndent float64       `yaml:"min_percent_indent"`
 	Timeout              time.Duration `yaml:"timeout"`
+	TrailPercent         float64       `yaml:"trail_percent"` // for trailing stop
+	TrailRepost          bool          `yaml:"trail_repost"`  // bot re-posts stop loss as price rises instead of broker trailing
+}
+
+// LimitPricingConfig places limit orders relative to the best bid and ask instead of last price
+type LimitPricingConfig struct {
+	Enabled       bool    `yaml:"enabled"`
+	Depth         int32   `yaml:"depth"`           // order book depth
+	TickOffset    int     `yaml:"tick_offset"`     // ticks from the best bid for buy and from the best ask for sell into the spread
+	MaxDepthShare float64 `yaml:"max_depth_share"` // quantity is capped by share of opposite side lots within depth
+	RepriceTicks  int     `yaml:"reprice_ticks"`   // resting order is re-priced when the touch moves away by ticks
+}
+
+// RiskConfig limits orders before they are sent, weights are shares of account equity
+type RiskConfig struct {
+	Enabled             bool    `yaml:"enabled"`
+	MaxInstrumentWeight float64 `yaml:"max_instrument_weight"`
+	MaxSectorWeight     float64 `yaml:"max_sector_weight"`
+}
+
+type ExecutionAlgo string
+
+const (
+	TWAP    ExecutionAlgo = "twap"
+	Iceberg ExecutionAlgo = "iceberg"
+)
+
+// ExecutionAlgoConfig slices large market and limit orders into child orders
+type ExecutionAlgoConfig struct {
+	Type           ExecutionAlgo `yaml:"type"`             // empty for one order
+	MinLots        float64       `yaml:"min_lots"`         // smaller orders are sent as one
+	Window         time.Duration `yaml:"window"`           // time to execute all child orders
+	Slices         int           `yaml:"slices"`           // twap child orders
+	MaxVisibleLots float64       `yaml:"max_visible_lots"` // iceberg child order quantity
+	PollInterval   time.Duration `yaml:"poll_interval"`    // child order state check
 }
 
 type OrdersConfig struct {
@@ -130,6 +213,10 @@ type OrdersConfig struct {
 	SellOrder     OrderConfig `yaml:"sell_order"`      // for instruments that are out of top
 	BuyOrder      OrderConfig `yaml:"buy_order"`       // for buy on rebalance
 	HedgeOrder    OrderConfig `yaml:"hedge_order"`     // places with buying order for hedging
+
+	Pricing LimitPricingConfig  `yaml:"pricing"`
+	Algo    ExecutionAlgoConfig `yaml:"algo"`
+	Risk    RiskConfig          `yaml:"risk"`
 }
 
 func (c *OrdersConfig) Setup(isNotSandbox bool) {
@@ -187,6 +274,102 @@ func (c *OrdersConfig) Setup(isNotSandbox bool) {
 	if c.HedgeOrder.DefencePercentIndent <= 0 {
 		c.HedgeOrder.DefencePercentIndent = 0.5 // stop limit value
 	}
+
+	for _, o := range []*OrderConfig{&c.SellOutProfit, &c.SellOrder, &c.HedgeOrder} {
+		if o.Type == TrailingStop && o.TrailPercent <= 0 {
+			o.TrailPercent = 0.05 // sell on high * (1 - value)
+		}
+	}
+
+	if c.Pricing.Depth <= 0 {
+		c.Pricing.Depth = 10
+	}
+	if c.Pricing.MaxDepthShare <= 0 {
+		c.Pricing.MaxDepthShare = 0.2
+	}
+	if c.Pricing.RepriceTicks <= 0 {
+		c.Pricing.RepriceTicks = 2
+	}
+
+	if c.Algo.Window <= 0 {
+		c.Algo.Window = 1 * time.Hour
+	}
+	if c.Algo.Slices <= 0 {
+		c.Algo.Slices = 6
+	}
+	if c.Algo.MaxVisibleLots <= 0 {
+		c.Algo.MaxVisibleLots = 10
+	}
+	if c.Algo.MinLots <= 0 {
+		c.Algo.MinLots = c.Algo.MaxVisibleLots
+	}
+	if c.Algo.PollInterval <= 0 {
+		c.Algo.PollInterval = 10 * time.Second
+	}
+
+	if c.Risk.MaxInstrumentWeight <= 0 {
+		c.Risk.MaxInstrumentWeight = 0.2
+	}
+	if c.Risk.MaxSectorWeight <= 0 {
+		c.Risk.MaxSectorWeight = 0.4
+	}
+}
+
+// MarginTradingConfig shorts instruments which were above STTMUpperThreshold
+// on previous rebalance and are below STTMThreshold now
+type MarginTradingConfig struct {
+	Enabled            bool                `yaml:"enabled"`
+	STTMTop            float64             `yaml:"sttm_top"`
+	STTMThreshold      float64             `yaml:"sttm_threshold"`
+	STTMUpperThreshold float64             `yaml:"sttm_upper_threshold"`
+	ShortProfitPercent float64             `yaml:"short_profit_percent"` // take profit buy on entry * (1 - value)
+	HedgePercent       float64             `yaml:"hedge_percent"`        // protective buy stop on entry * (1 + value)
+	CoverBeforeClose   time.Duration       `yaml:"cover_before_close"`   // shorts are covered this time before session end
+	MarginTaxes        map[float64]float64 `yaml:"margin_taxes"`
+	RiskRatesFile      string              `yaml:"risk_rates_file"`    // yaml file with risk rates by figi, if empty they're requested from api
+	DefaultRiskRates   model.RiskRates     `yaml:"default_risk_rates"` // for instruments without risk rates
+}
+
+const (
+	_shortProfitPercentDefault = 0.005
+	_hedgePercentDefault       = 0.05
+	_coverBeforeCloseDefault   = time.Hour
+)
+
+func (c *MarginTradingConfig) Setup() {
+	if c.ShortProfitPercent <= 0 {
+		c.ShortProfitPercent = _shortProfitPercentDefault
+	}
+	if c.HedgePercent <= 0 {
+		c.HedgePercent = _hedgePercentDefault
+	}
+	if c.CoverBeforeClose <= 0 {
+		c.CoverBeforeClose = _coverBeforeCloseDefault
+	}
+	if c.MarginTaxes == nil {
+		c.MarginTaxes = model.MarginTaxPerDay
+	}
+}
+
+// PaperConfig runs bot on live market data with simulated matching engine
+type PaperConfig struct {
+	Enabled       bool          `yaml:"enabled"`
+	SlippageBPS   float64       `yaml:"slippage_bps"`
+	CheckInterval time.Duration `yaml:"check_interval"`
+}
+
+const (
+	_paperSlippageBPSDefault   = 5
+	_paperCheckIntervalDefault = time.Minute
+)
+
+func (c *PaperConfig) Setup() {
+	if c.SlippageBPS <= 0 {
+		c.SlippageBPS = _paperSlippageBPSDefault
+	}
+	if c.CheckInterval <= 0 {
+		c.CheckInterval = _paperCheckIntervalDefault
+	}
 }
 
 type TradingBotConfig struct {
@@ -197,6 +380,76 @@ type TradingBotConfig struct {
 	LotsBalanceStrategy LotsBalanceStrategy       `yaml:"lots_balance_strategy"`
 	Orders              OrdersConfig              `yaml:"orders"`
 	TechnicalIndicators TechnicalIndicatorsConfig `yaml:"technical_indicators"`
+	MarginTradingConfig `yaml:"margin_trading"`
+	Paper               PaperConfig  `yaml:"paper"`
+	Retry               RetryConfig  `yaml:"retry"`
+	Signal              SignalConfig `yaml:"signal"`
+}
+
+type SignalProvider string
+
+const (
+	STTMSignal      SignalProvider = "sttm"
+	FileSignal      SignalProvider = "file"     // precomputed scores
+	MomentumSignal  SignalProvider = "momentum" // price change
+	CompositeSignal SignalProvider = "composite"
+)
+
+// SignalConfig is provider of scores which instruments are ranked by on rebalance
+type SignalConfig struct {
+	Provider SignalProvider `yaml:"provider"`
+	File     string         `yaml:"file"`     // csv with ts,instrument_id,score rows or parquet with such columns
+	Lookback time.Duration  `yaml:"lookback"` // of momentum, zero for rebalance window
+	Weight   float64        `yaml:"weight"`   // in composite
+	Parts    []SignalConfig `yaml:"parts"`    // of composite
+}
+
+func (c *SignalConfig) Setup() {
+	if c.Provider == "" {
+		c.Provider = STTMSignal
+	}
+	for i := range c.Parts {
+		c.Parts[i].Setup()
+		if c.Parts[i].Weight <= 0 {
+			c.Parts[i].Weight = 1
+		}
+	}
+}
+
+type RetryPolicy struct {
+	Attempts  int           `yaml:"attempts"` // 1 for no retries
+	BaseDelay time.Duration `yaml:"base_delay"`
+	MaxDelay  time.Duration `yaml:"max_delay"`
+}
+
+// RetryConfig is retry policy of broker calls, methods override default policy by method name, e.g. Buy
+type RetryConfig struct {
+	RetryPolicy `yaml:",inline"`
+	Methods     map[string]RetryPolicy `yaml:"methods"`
+}
+
+func (c *RetryConfig) Setup() {
+	if c.Attempts <= 0 {
+		c.Attempts = 3
+	}
+	if c.BaseDelay <= 0 {
+		c.BaseDelay = 200 * time.Millisecond
+	}
+	if c.MaxDelay <= 0 {
+		c.MaxDelay = 10 * time.Second
+	}
+	for name, p := range c.Methods {
+		if p.Attempts <= 0 {
+			p.Attempts = c.Attempts
+		}
+		if p.BaseDelay <= 0 {
+			p.BaseDelay = c.BaseDelay
+		}
+		if p.MaxDelay <= 0 {
+			p.MaxDelay = c.MaxDelay
+		}
+		c.Methods[name] = p
+	}
 }
 
 const (
@@ -227,6 +480,10 @@ func (c *TradingBotConfig) ValidateAndSetup() error {
 
 	c.Orders.Setup(c.IsNotSandbox)
 	c.TechnicalIndicators.Setup()
+	c.MarginTradingConfig.Setup()
+	c.Paper.Setup()
+	c.Retry.Setup()
+	c.Signal.Setup()
 
 	return nil
 }
@@ -0,0 +1,131 @@
+package broker
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/russianinvestments/invest-api-go-sdk/investgo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Kind is class of broker error, strategy can react to it
+type Kind int
+
+const (
+	Unknown Kind = iota
+	Retryable
+	RateLimited // retried after x-ratelimit-reset
+	Invalid
+	InsufficientFunds
+	NotTradable
+	Fatal // auth and permission errors
+)
+
+var (
+	ErrRetryable         = errors.New("broker is temporary unavailable")
+	ErrRateLimited       = errors.New("broker rate limit is exceeded")
+	ErrInvalid           = errors.New("invalid broker request")
+	ErrInsufficientFunds = errors.New("not enough funds")
+	ErrNotTradable       = errors.New("instrument isn't tradable")
+	ErrFatal             = errors.New("broker call isn't permitted")
+)
+
+// T-Invest error codes from status message
+var _codeKinds = map[string]Kind{
+	"30034": InsufficientFunds, // not enough balance
+	"30042": InsufficientFunds, // not enough assets for margin trade
+	"30052": NotTradable,       // instrument is forbidden for trading by api
+	"30079": NotTradable,       // instrument isn't available for trading
+	"80002": RateLimited,       // request limit exceeded
+}
+
+// Error is classified error of broker call
+type Error struct {
+	Method     string
+	Kind       Kind
+	Code       codes.Code
+	Message    string // T-Invest error code and message from header
+	ResetAfter time.Duration
+	Err        error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s %s: %s", e.Method, e.Code, e.Message, e.Err)
+}
+
+// Unwrap returns sentinel error of kind, so errors.Is can be used with ErrNotTradable and others
+func (e *Error) Unwrap() []error {
+	var kindErr error
+	switch e.Kind {
+	case Retryable:
+		kindErr = ErrRetryable
+	case RateLimited:
+		kindErr = ErrRateLimited
+	case Invalid:
+		kindErr = ErrInvalid
+	case InsufficientFunds:
+		kindErr = ErrInsufficientFunds
+	case NotTradable:
+		kindErr = ErrNotTradable
+	case Fatal:
+		kindErr = ErrFatal
+	}
+	if kindErr == nil {
+		return []error{e.Err}
+	}
+	return []error{kindErr, e.Err}
+}
+
+func (e *Error) Temporary() bool {
+	return e.Kind == Retryable || e.Kind == RateLimited
+}
+
+// Classify wraps error of broker call into Error, header is response header with message and rate limit reset
+func Classify(method string, err error, header metadata.MD) error {
+	if err == nil {
+		return nil
+	}
+
+	st, _ := status.FromError(err)
+	e := &Error{
+		Method:  method,
+		Code:    st.Code(),
+		Message: strings.TrimSpace(st.Message() + " " + investgo.MessageFromHeader(header)),
+		Err:     err,
+	}
+
+	if kind, ok := _codeKinds[strings.TrimSpace(st.Message())]; ok {
+		e.Kind = kind
+	} else {
+		e.Kind = kindOf(st.Code())
+	}
+
+	if e.Kind == RateLimited {
+		if v := header.Get("x-ratelimit-reset"); len(v) > 0 {
+			if sec, err := strconv.Atoi(v[0]); err == nil {
+				e.ResetAfter = time.Duration(sec) * time.Second
+			}
+		}
+	}
+	return e
+}
+
+func kindOf(code codes.Code) Kind {
+	switch code {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Internal, codes.Aborted:
+		return Retryable
+	case codes.ResourceExhausted:
+		return RateLimited
+	case codes.InvalidArgument, codes.NotFound, codes.AlreadyExists, codes.FailedPrecondition, codes.OutOfRange:
+		return Invalid
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return Fatal
+	default:
+		return Unknown
+	}
+}
@@ -0,0 +1,36 @@
+package broker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestClassify(t *testing.T) {
+	err := Classify("Buy", status.Error(codes.InvalidArgument, "30079"), nil)
+	if !errors.Is(err, ErrNotTradable) {
+		t.Errorf("expected not tradable, got %s", err)
+	}
+
+	err = Classify("Buy", status.Error(codes.ResourceExhausted, ""), metadata.Pairs("x-ratelimit-reset", "3"))
+	var e *Error
+	if !errors.As(err, &e) || !e.Temporary() || e.ResetAfter != 3*time.Second {
+		t.Errorf("expected rate limit with reset, got %s", err)
+	}
+
+	if err := Classify("Buy", status.Error(codes.Unauthenticated, ""), nil); !errors.Is(err, ErrFatal) {
+		t.Errorf("expected fatal, got %s", err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt := range 10 {
+		if d := Backoff(attempt, 100*time.Millisecond, time.Second); d <= 0 || d > time.Second {
+			t.Errorf("delay %s is out of bounds on attempt %d", d, attempt)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package broker
+
+import (
+	"errors"
+	"math/rand/v2"
+	"reflect"
+	"time"
+
+	"github.com/STTM-NSU/trading-bot/internal/config"
+	"github.com/STTM-NSU/trading-bot/internal/logger"
+	"google.golang.org/grpc/metadata"
+)
+
+// Retrier retries temporary errors of broker calls with exponential backoff and jitter,
+// attempts and delays of every call are taken from policy of its method
+type Retrier struct {
+	cfg    config.RetryConfig
+	logger logger.Logger // nil for no logs
+}
+
+func NewRetrier(cfg config.RetryConfig, logger logger.Logger) *Retrier {
+	cfg.Setup()
+	return &Retrier{
+		cfg:    cfg,
+		logger: logger,
+	}
+}
+
+// policy of nil retrier makes one attempt
+func (r *Retrier) policy(method string) config.RetryPolicy {
+	if r == nil {
+		return config.RetryPolicy{}
+	}
+	if p, ok := r.cfg.Methods[method]; ok {
+		return p
+	}
+	return r.cfg.RetryPolicy
+}
+
+// Call calls broker method with retrier, error is classified into Error.
+// Orders are safe to retry, because they are deduplicated by order id
+func Call[T any](r *Retrier, method string, f func() (T, error)) (T, error) {
+	p := r.policy(method)
+
+	var (
+		resp T
+		err  error
+	)
+	for attempt := 0; attempt < max(p.Attempts, 1); attempt++ {
+		if attempt > 0 {
+			delay := Backoff(attempt-1, p.BaseDelay, p.MaxDelay)
+			var e *Error
+			if errors.As(err, &e) && e.ResetAfter > 0 {
+				delay = e.ResetAfter
+			}
+			if r.logger != nil {
+				r.logger.Warnf("%s: retry %s in %s, attempt %d", err, method, delay, attempt+1)
+			}
+			time.Sleep(delay)
+		}
+
+		resp, err = f()
+		if err == nil {
+			return resp, nil
+		}
+		err = Classify(method, err, headerOf(resp))
+
+		var e *Error
+		if !errors.As(err, &e) || !e.Temporary() {
+			return resp, err
+		}
+	}
+	return resp, err
+}
+
+// Backoff returns random delay up to base * 2^attempt capped by max
+func Backoff(attempt int, base, maxDelay time.Duration) time.Duration {
+	d := base << min(attempt, 30)
+	if maxDelay > 0 && (d <= 0 || d > maxDelay) {
+		d = maxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(d))) + 1
+}
+
+var _headerType = reflect.TypeOf(metadata.MD{})
+
+// headerOf returns Header field of investgo response, which has message and rate limit reset on errors
+func headerOf(resp any) metadata.MD {
+	v := reflect.ValueOf(resp)
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	h := v.FieldByName("Header")
+	if !h.IsValid() || h.Type() != _headerType {
+		return nil
+	}
+	return h.Interface().(metadata.MD)
+}
@@ -0,0 +1,383 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/STTM-NSU/trading-bot/internal/config"
+	"github.com/STTM-NSU/trading-bot/internal/invest/broker"
+	"github.com/STTM-NSU/trading-bot/internal/model"
+	"github.com/google/uuid"
+	"github.com/russianinvestments/invest-api-go-sdk/investgo"
+	investapi "github.com/russianinvestments/invest-api-go-sdk/proto"
+)
+
+type ChildOrder struct {
+	OrderRequestID string
+	OrderID        string
+	Quantity       float64 // lots
+	Executed       float64
+	Price          float64 // average price of one instrument
+	Done           bool
+}
+
+// ParentOrder is buy or sell intent executed by child orders of TWAP or iceberg algorithm
+type ParentOrder struct {
+	ID         string
+	Instrument model.PortfolioInstrument
+	Buy        bool
+	Children   []ChildOrder
+	Done       bool // no more child orders are placed
+
+	cancel context.CancelFunc
+}
+
+// Executed returns executed lots and average price over child orders
+func (p ParentOrder) Executed() (float64, float64) {
+	var lots, amount float64
+	for _, c := range p.Children {
+		lots += c.Executed
+		amount += c.Executed * c.Price
+	}
+	if lots == 0 {
+		return 0, 0
+	}
+	return lots, amount / lots
+}
+
+func (p ParentOrder) finished() bool {
+	if !p.Done {
+		return false
+	}
+	for _, c := range p.Children {
+		if !c.Done {
+			return false
+		}
+	}
+	return true
+}
+
+// SliceQuantity splits lots into equal slices, remainder goes to the first ones, empty slices are dropped
+func SliceQuantity(quantity float64, slices int) []float64 {
+	quantity = math.Floor(quantity)
+	if slices <= 0 || quantity <= 0 {
+		return nil
+	}
+	slices = min(slices, int(quantity))
+	base, rest := math.Floor(quantity/float64(slices)), int(quantity)%slices
+
+	res := make([]float64, slices)
+	for k := range res {
+		res[k] = base
+		if k < rest {
+			res[k]++
+		}
+	}
+	return res
+}
+
+func (e *Executor) useAlgo(i model.PortfolioInstrument, cfg config.OrderConfig) bool {
+	return e.cfg.Algo.Type != "" && (cfg.Type == config.Market || cfg.Type == config.Limit) && i.Quantity > e.cfg.Algo.MinLots
+}
+
+// startAlgo registers parent order and places child orders in background,
+// parent id is returned as both order request id and order id
+func (e *Executor) startAlgo(price float64, i model.PortfolioInstrument, cfg config.OrderConfig, buy bool) (string, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), e.cfg.Algo.Window+e.cfg.Algo.PollInterval)
+	p := ParentOrder{
+		ID:         _orderIdPrefix + uuid.NewString(),
+		Instrument: i,
+		Buy:        buy,
+		cancel:     cancel,
+	}
+
+	e.mu.Lock()
+	e.parents[p.ID] = p
+	e.mu.Unlock()
+
+	switch e.cfg.Algo.Type {
+	case config.TWAP:
+		go e.runTWAP(ctx, p.ID, price, i, cfg, buy)
+	case config.Iceberg:
+		go e.runIceberg(ctx, p.ID, price, i, cfg, buy)
+	default:
+		cancel()
+		e.mu.Lock()
+		delete(e.parents, p.ID)
+		e.mu.Unlock()
+		return "", "", fmt.Errorf("unknown execution algorithm: %s", e.cfg.Algo.Type)
+	}
+
+	e.logger.Infof("%s %s started for %s: %f lots", e.cfg.Algo.Type, p.ID, i.InstrumentID, i.Quantity)
+	return p.ID, p.ID, nil
+}
+
+// runTWAP places equal slices over the window, not filled rest of previous slice is moved to the next one.
+// The last slice is cancelled at the end of window, so parent is done with its rest left
+func (e *Executor) runTWAP(ctx context.Context, parentID string, price float64, i model.PortfolioInstrument, cfg config.OrderConfig, buy bool) {
+	defer e.finishAlgo(parentID)
+
+	slices := SliceQuantity(i.Quantity, e.cfg.Algo.Slices)
+	interval := e.cfg.Algo.Window / time.Duration(max(len(slices), 1))
+
+	var (
+		prev    ChildOrder
+		planned float64 // lots of previous slice with moved rest, child could be capped by order book depth
+		rest    float64
+	)
+	for k, q := range slices {
+		if k > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+			if prev = e.refreshChild(parentID, prev); !prev.Done {
+				e.cancelChild(i, prev)
+				prev = e.refreshChild(parentID, prev)
+			}
+			rest = planned - prev.Executed
+		}
+
+		planned = q + rest
+		child, err := e.placeChild(parentID, price, i, planned, cfg, buy, k == len(slices)-1)
+		if err != nil {
+			e.logger.Errorf("%s: can't place twap child order of %s", err, parentID)
+			return
+		}
+		prev = child
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(interval):
+	}
+	if prev = e.refreshChild(parentID, prev); !prev.Done {
+		e.cancelChild(i, prev)
+		prev = e.refreshChild(parentID, prev)
+	}
+	if left := planned - prev.Executed; left > 0 {
+		e.logger.Warnf("twap %s isn't filled in window: %f lots left", parentID, left)
+	}
+}
+
+// runIceberg shows at most MaxVisibleLots at once, the next child order is placed after previous one is filled
+func (e *Executor) runIceberg(ctx context.Context, parentID string, price float64, i model.PortfolioInstrument, cfg config.OrderConfig, buy bool) {
+	defer e.finishAlgo(parentID)
+
+	remaining := math.Floor(i.Quantity)
+	for remaining > 0 {
+		q := min(remaining, e.cfg.Algo.MaxVisibleLots)
+		child, err := e.placeChild(parentID, price, i, q, cfg, buy, q == remaining)
+		if err != nil {
+			e.logger.Errorf("%s: can't place iceberg child order of %s", err, parentID)
+			return
+		}
+
+		for !child.Done {
+			select {
+			case <-ctx.Done(): // window is over
+				e.cancelChild(i, child)
+				return
+			case <-time.After(e.cfg.Algo.PollInterval):
+			}
+			child = e.refreshChild(parentID, child)
+		}
+		if child.Executed < child.Quantity { // cancelled or rejected
+			return
+		}
+		remaining -= child.Executed
+	}
+}
+
+// placeChild registers child by order request id before it is sent, so its fill reported before response
+// is folded into parent and isn't taken for fill of other order
+func (e *Executor) placeChild(parentID string, price float64, i model.PortfolioInstrument, quantity float64,
+	cfg config.OrderConfig, buy, last bool) (ChildOrder, error) {
+	i.Quantity = quantity
+	child := ChildOrder{
+		OrderRequestID: _orderIdPrefix + uuid.NewString(),
+		Quantity:       quantity,
+	}
+
+	e.mu.Lock()
+	p := e.parents[parentID]
+	p.Children = append(p.Children, child)
+	p.Done = last
+	e.parents[parentID] = p
+	e.children[child.OrderRequestID] = parentID
+	e.mu.Unlock()
+
+	var (
+		orderId string
+		err     error
+	)
+	if buy {
+		_, orderId, err = e.buyMarket(child.OrderRequestID, price, i, cfg)
+	} else {
+		_, orderId, err = e.sellMarket(child.OrderRequestID, price, i, cfg)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	p = e.parents[parentID]
+	if err != nil {
+		p.Children = slices.DeleteFunc(p.Children, func(c ChildOrder) bool { return c.OrderRequestID == child.OrderRequestID })
+		p.Done = false
+		e.parents[parentID] = p
+		delete(e.children, child.OrderRequestID)
+		return ChildOrder{}, err
+	}
+	if r, ok := e.resting[child.OrderRequestID]; ok { // rest of child is placed by algorithm
+		delete(e.resting, child.OrderRequestID)
+		if r.Remaining > 0 {
+			quantity -= r.Remaining
+			p.Done = false
+		}
+	}
+
+	for k, c := range p.Children {
+		if c.OrderRequestID == child.OrderRequestID {
+			p.Children[k].OrderID, p.Children[k].Quantity = orderId, quantity
+			child = p.Children[k]
+		}
+	}
+	e.parents[parentID] = p
+	e.children[orderId] = parentID
+
+	return child, nil
+}
+
+// refreshChild requests child order state
+func (e *Executor) refreshChild(parentID string, child ChildOrder) ChildOrder {
+	resp, err := broker.Call(e.retrier, "GetOrderState", func() (*investgo.GetOrderStateResponse, error) {
+		e.ordersRateLimiter.Take()
+		return e.ordersService.GetOrderState(e.accountOf(parentID), child.OrderID, investapi.PriceType_PRICE_TYPE_CURRENCY, nil)
+	})
+	if err != nil {
+		e.logger.Warnf("%s: can't get child order state %s", err, child.OrderID)
+		return child
+	}
+
+	status := resp.GetExecutionReportStatus()
+	child.Executed = float64(resp.GetLotsExecuted())
+	child.Price = resp.GetAveragePositionPrice().ToFloat()
+	child.Done = status == investapi.OrderExecutionReportStatus_EXECUTION_REPORT_STATUS_FILL ||
+		status == investapi.OrderExecutionReportStatus_EXECUTION_REPORT_STATUS_REJECTED ||
+		status == investapi.OrderExecutionReportStatus_EXECUTION_REPORT_STATUS_CANCELLED
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.updateChild(parentID, child)
+	return child
+}
+
+func (e *Executor) updateChild(parentID string, child ChildOrder) {
+	p, ok := e.parents[parentID]
+	if !ok {
+		return
+	}
+	for k, c := range p.Children {
+		if c.OrderRequestID == child.OrderRequestID {
+			p.Children[k].Executed = max(c.Executed, child.Executed)
+			p.Children[k].Price = child.Price
+			p.Children[k].Done = c.Done || child.Done
+		}
+	}
+	e.parents[parentID] = p
+}
+
+func (e *Executor) cancelChild(i model.PortfolioInstrument, child ChildOrder) {
+	i.OrderRequestID, i.OrderID = child.OrderRequestID, child.OrderID
+	if err := e.cancelMarketOrder(i); err != nil {
+		e.logger.Warnf("%s: can't cancel child order %s", err, child.OrderID)
+	}
+}
+
+func (e *Executor) accountOf(parentID string) string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.parents[parentID].Instrument.AccountID
+}
+
+// finishAlgo marks parent done when algorithm stops earlier, e.g. after cancel
+func (e *Executor) finishAlgo(parentID string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	p, ok := e.parents[parentID]
+	if !ok {
+		return
+	}
+	p.Done = true
+	p.cancel()
+	e.parents[parentID] = p
+	e.logger.Infof("%s %s finished", e.cfg.Algo.Type, parentID)
+}
+
+// cancelParent stops placing child orders and cancels active ones
+func (e *Executor) cancelParent(parentID string) bool {
+	e.mu.Lock()
+	p, ok := e.parents[parentID]
+	e.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	p.cancel()
+	for _, c := range p.Children {
+		if !c.Done {
+			e.cancelChild(p.Instrument, c)
+		}
+	}
+	return true
+}
+
+// ParentState folds child order state into the state of its parent, so placed parent order
+// is tracked as a single order. It returns false for orders which aren't children of algorithm
+func (e *Executor) ParentState(s model.OrderState) (model.OrderState, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	parentID, ok := e.children[s.OrderID]
+	if !ok {
+		if parentID, ok = e.children[s.OrderRequestID]; !ok {
+			return s, false
+		}
+	}
+	p, ok := e.parents[parentID]
+	if !ok {
+		return s, false
+	}
+
+	for _, c := range p.Children {
+		if c.OrderID == s.OrderID || c.OrderRequestID == s.OrderRequestID {
+			c.Executed, c.Price, c.Done = s.LotsExecuted, s.ExecutedPrice, s.Done
+			e.updateChild(parentID, c)
+		}
+	}
+	p = e.parents[parentID]
+
+	lots, price := p.Executed()
+	done := p.finished()
+	if done {
+		for _, c := range p.Children {
+			delete(e.children, c.OrderID)
+			delete(e.children, c.OrderRequestID)
+		}
+		delete(e.parents, parentID)
+	}
+
+	return model.OrderState{
+		OrderID:        parentID,
+		OrderRequestID: parentID,
+		InstrumentID:   p.Instrument.InstrumentID,
+		Buy:            p.Buy,
+		LotsExecuted:   lots,
+		LotsLeft:       p.Instrument.Quantity - lots,
+		ExecutedPrice:  price,
+		Done:           done,
+	}, true
+}
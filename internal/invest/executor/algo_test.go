@@ -0,0 +1,32 @@
+package executor
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSliceQuantity(t *testing.T) {
+	if s := SliceQuantity(10, 3); !slices.Equal(s, []float64{4, 3, 3}) {
+		t.Errorf("unexpected slices %v", s)
+	}
+	// not more slices than lots
+	if s := SliceQuantity(2, 5); !slices.Equal(s, []float64{1, 1}) {
+		t.Errorf("unexpected slices %v", s)
+	}
+	if s := SliceQuantity(0, 5); len(s) != 0 {
+		t.Errorf("unexpected slices %v", s)
+	}
+}
+
+func TestParentOrderExecuted(t *testing.T) {
+	p := ParentOrder{Children: []ChildOrder{
+		{Quantity: 5, Executed: 5, Price: 100, Done: true},
+		{Quantity: 5, Executed: 5, Price: 110},
+	}}
+	if lots, price := p.Executed(); lots != 10 || price != 105 {
+		t.Errorf("unexpected executed %f %f", lots, price)
+	}
+	if p.finished() {
+		t.Errorf("parent with active child isn't finished")
+	}
+}
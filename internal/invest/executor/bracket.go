@@ -0,0 +1,95 @@
+package executor
+
+import (
+	"fmt"
+
+	"github.com/STTM-NSU/trading-bot/internal/invest/broker"
+	"github.com/STTM-NSU/trading-bot/internal/model"
+	"github.com/russianinvestments/invest-api-go-sdk/investgo"
+	investapi "github.com/russianinvestments/invest-api-go-sdk/proto"
+)
+
+// HasBracket reports whether position has exit stop or protective hedge. Broker doesn't link these legs,
+// so one firing leaves the other live and it can open unintended short
+func HasBracket(i model.PortfolioInstrument) bool {
+	return i.ExitOrderID != "" || i.HedgeOrderID != ""
+}
+
+// GetStopOrders returns active stop orders of account
+func (e *Executor) GetStopOrders(accountID string) ([]model.StopOrder, error) {
+	resp, err := broker.Call(e.retrier, "GetStopOrders", func() (*investgo.GetStopOrdersResponse, error) {
+		e.stopOrdersRateLimiter.Take()
+		return e.stopOrdersService.GetStopOrders(accountID)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: can't get stop orders", err)
+	}
+
+	res := make([]model.StopOrder, 0, len(resp.GetStopOrders()))
+	for _, o := range resp.GetStopOrders() {
+		res = append(res, model.StopOrder{
+			ID:           o.GetStopOrderId(),
+			InstrumentID: o.GetInstrumentUid(),
+			Buy:          o.GetDirection() == investapi.StopOrderDirection_STOP_ORDER_DIRECTION_BUY,
+		})
+	}
+	return res, nil
+}
+
+func (e *Executor) CancelStop(accountID, stopOrderID string) error {
+	if _, err := broker.Call(e.retrier, "CancelStopOrder", func() (*investgo.CancelStopOrderResponse, error) {
+		e.stopOrdersRateLimiter.Take()
+		return e.stopOrdersService.CancelStopOrder(accountID, stopOrderID)
+	}); err != nil {
+		return fmt.Errorf("%w: can't cancel stop order %s", err, stopOrderID)
+	}
+	return nil
+}
+
+// CancelBracket cancels both legs of position, the leg which already fired can't be cancelled,
+// so errors are only logged
+func (e *Executor) CancelBracket(i model.PortfolioInstrument) {
+	for _, id := range []string{i.ExitOrderID, i.HedgeOrderID} {
+		if id == "" {
+			continue
+		}
+		if err := e.CancelStop(i.AccountID, id); err != nil {
+			e.logger.Infof("%s: bracket leg of %s isn't cancelled", err, i.InstrumentID)
+		}
+	}
+
+	e.mu.Lock()
+	delete(e.trailing, i.InstrumentID)
+	e.mu.Unlock()
+}
+
+// OrphanedLegs returns active sell stops which must be cancelled: stops of positions that are gone
+// and siblings of legs that already fired
+func OrphanedLegs(active []model.StopOrder, instruments map[string]model.PortfolioInstrument) []string {
+	activeIDs := make(map[string]struct{}, len(active))
+	for _, o := range active {
+		activeIDs[o.ID] = struct{}{}
+	}
+
+	referenced := make(map[string]struct{})
+	for _, i := range instruments {
+		_, exitActive := activeIDs[i.ExitOrderID]
+		_, hedgeActive := activeIDs[i.HedgeOrderID]
+		if i.ExitOrderID != "" && i.HedgeOrderID != "" && exitActive != hedgeActive {
+			continue // sibling fired, active leg isn't referenced
+		}
+		referenced[i.ExitOrderID] = struct{}{}
+		referenced[i.HedgeOrderID] = struct{}{}
+	}
+
+	var res []string
+	for _, o := range active {
+		if o.Buy { // short cover stops
+			continue
+		}
+		if _, ok := referenced[o.ID]; !ok {
+			res = append(res, o.ID)
+		}
+	}
+	return res
+}
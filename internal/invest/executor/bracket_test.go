@@ -0,0 +1,29 @@
+package executor
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/STTM-NSU/trading-bot/internal/model"
+)
+
+func TestOrphanedLegs(t *testing.T) {
+	active := []model.StopOrder{
+		{ID: "tp1", InstrumentID: "a"},
+		{ID: "hedge1", InstrumentID: "a"},
+		{ID: "hedge2", InstrumentID: "b"}, // take profit of b fired
+		{ID: "hedge3", InstrumentID: "c"}, // position c is gone
+		{ID: "cover", InstrumentID: "d", Buy: true},
+	}
+	instruments := map[string]model.PortfolioInstrument{
+		"a": {InstrumentID: "a", ExitOrderID: "tp1", HedgeOrderID: "hedge1"},
+		"b": {InstrumentID: "b", ExitOrderID: "tp2", HedgeOrderID: "hedge2"},
+		"e": {InstrumentID: "e", HedgeOrderID: "hedge5"},
+	}
+
+	res := OrphanedLegs(active, instruments)
+	slices.Sort(res)
+	if !slices.Equal(res, []string{"hedge2", "hedge3"}) {
+		t.Errorf("unexpected orphaned legs %v", res)
+	}
+}
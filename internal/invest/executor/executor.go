@@ -2,9 +2,11 @@ package executor
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/STTM-NSU/trading-bot/internal/config"
+	"github.com/STTM-NSU/trading-bot/internal/invest/broker"
 	"github.com/STTM-NSU/trading-bot/internal/logger"
 	"github.com/STTM-NSU/trading-bot/internal/model"
 	"github.com/STTM-NSU/trading-bot/internal/tools"
@@ -27,16 +29,40 @@ type Executor struct {
 
 	stopOrdersService *investgo.StopOrdersServiceClient
 	ordersService     *investgo.OrdersServiceClient
+
+	pricer  *Pricer      // nil if limit orders are priced from last price
+	risk    *RiskChecker // nil if orders aren't checked
+	retrier *broker.Retrier
+
+	mu       sync.Mutex
+	shorts   map[string]ShortPosition // instrument id -> short
+	trailing map[string]TrailingOrder // instrument id -> stop loss re-posted by bot
+	parents  map[string]ParentOrder   // parent id -> order of execution algorithm
+	children map[string]string        // child order id and request id -> parent id
+	resting  map[string]RestingOrder  // order request id -> limit order priced by order book
 }
 
-func NewExecutor(c *investgo.Client, cfg config.OrdersConfig, logger logger.Logger) *Executor {
+func NewExecutor(c *investgo.Client, cfg config.OrdersConfig, books OrderBookSource, risk *RiskChecker,
+	retrier *broker.Retrier, logger logger.Logger) *Executor {
+	var pricer *Pricer
+	if cfg.Pricing.Enabled {
+		pricer = NewPricer(books, cfg.Pricing)
+	}
 	return &Executor{
+		pricer:                pricer,
+		risk:                  risk,
+		retrier:               retrier,
 		stopOrdersService:     c.NewStopOrdersServiceClient(),
 		ordersService:         c.NewOrdersServiceClient(),
 		stopOrdersRateLimiter: ratelimit.New(50, ratelimit.Per(time.Minute)),
 		ordersRateLimiter:     ratelimit.New(100, ratelimit.Per(time.Minute)),
 		cfg:                   cfg,
 		logger:                logger,
+		shorts:                make(map[string]ShortPosition),
+		trailing:              make(map[string]TrailingOrder),
+		parents:               make(map[string]ParentOrder),
+		children:              make(map[string]string),
+		resting:               make(map[string]RestingOrder),
 	}
 }
 
@@ -52,7 +78,10 @@ func (e *Executor) Buy(price float64, i model.PortfolioInstrument) (string, stri
 			return "", "", fmt.Errorf("%w: buyStop err", err)
 		}
 	case config.Market, config.Limit:
-		orderRequestId, orderId, err = e.buyMarket(price, i, e.cfg.BuyOrder)
+		if e.useAlgo(i, e.cfg.BuyOrder) {
+			return e.startAlgo(price, i, e.cfg.BuyOrder, true)
+		}
+		orderRequestId, orderId, err = e.buyMarket(_orderIdPrefix+uuid.NewString(), price, i, e.cfg.BuyOrder)
 		if err != nil {
 			return "", "", fmt.Errorf("%w: buyMarket err", err)
 		}
@@ -61,26 +90,57 @@ func (e *Executor) Buy(price float64, i model.PortfolioInstrument) (string, stri
 	return orderRequestId, orderId, err
 }
 
-func (e *Executor) buyMarket(price float64, i model.PortfolioInstrument, cfg config.OrderConfig) (string, string, error) {
-	orderRequestId := _orderIdPrefix + uuid.NewString()
+func (e *Executor) buyMarket(orderRequestId string, price float64, i model.PortfolioInstrument, cfg config.OrderConfig) (string, string, error) {
+	limitPrice := price * (1 - cfg.ProfitPercentIndent)
+	priced := cfg.Type == config.Limit && e.pricer != nil
+	var remaining float64
+	if priced {
+		quantity := i.Quantity
+		var err error
+		if limitPrice, i.Quantity, err = e.pricer.Price(i, true); err != nil {
+			return "", "", fmt.Errorf("%w: can't price limit order", err)
+		}
+		if remaining = quantity - i.Quantity; remaining > 0 {
+			e.logger.Infof("quantity of %s is capped by order book depth: %f of %f", i.InstrumentID, i.Quantity, quantity)
+		}
+	}
 
-	e.ordersRateLimiter.Take()
-	resp, err := e.ordersService.Buy(&investgo.PostOrderRequestShort{
-		InstrumentId: i.InstrumentID,
-		Quantity:     int64(i.Quantity),
-		Price:        tools.FloatToQuotation(price*(1-cfg.ProfitPercentIndent), i.MinPriceIncrement), // limit order price
-		AccountId:    i.AccountID,
-		OrderType:    cfg.Type.ToInvestType(),
-		OrderId:      orderRequestId,
+	o, limitPrice, err := e.checkOrderRisk(i, limitPrice, cfg, true)
+	if err != nil {
+		return "", "", err
+	}
+	i = o.Instrument
+
+	resp, err := broker.Call(e.retrier, "Buy", func() (*investgo.PostOrderResponse, error) {
+		e.ordersRateLimiter.Take()
+		return e.ordersService.Buy(&investgo.PostOrderRequestShort{
+			InstrumentId: i.InstrumentID,
+			Quantity:     int64(i.Quantity),
+			Price:        tools.FloatToQuotation(limitPrice, i.MinPriceIncrement), // limit order price
+			AccountId:    i.AccountID,
+			OrderType:    cfg.Type.ToInvestType(),
+			OrderId:      orderRequestId,
+		})
 	})
 	if err != nil {
+		e.releaseRisk(o)
 		return "", "", fmt.Errorf("%w: can't buy market", err)
 	}
 
+	if priced {
+		i.OrderRequestID, i.OrderID = orderRequestId, resp.GetOrderId()
+		e.addResting(RestingOrder{Instrument: i, Buy: true, Price: limitPrice, Remaining: remaining})
+	}
 	return orderRequestId, resp.GetOrderId(), nil
 }
 
 func (e *Executor) buyStop(price float64, i model.PortfolioInstrument, cfg config.OrderConfig) (string, string, error) {
+	o, err := e.checkStopRisk(i, true)
+	if err != nil {
+		return "", "", err
+	}
+	i = o.Instrument
+
 	orderRequestId := _orderIdPrefix + uuid.NewString()
 	req := &investgo.PostStopOrderRequest{
 		InstrumentId:   i.InstrumentID,
@@ -105,9 +165,12 @@ func (e *Executor) buyStop(price float64, i model.PortfolioInstrument, cfg confi
 		req.TakeProfitType = investapi.TakeProfitType_TAKE_PROFIT_TYPE_REGULAR
 	}
 
-	e.stopOrdersRateLimiter.Take()
-	resp, err := e.stopOrdersService.PostStopOrder(req)
+	resp, err := broker.Call(e.retrier, "PostStopOrder", func() (*investgo.PostStopOrderResponse, error) {
+		e.stopOrdersRateLimiter.Take()
+		return e.stopOrdersService.PostStopOrder(req)
+	})
 	if err != nil {
+		e.releaseRisk(o)
 		return "", "", fmt.Errorf("%w: can't buy stop", err)
 	}
 
@@ -132,13 +195,28 @@ func (e *Executor) Sell(price float64, i model.PortfolioInstrument, cfg config.O
 		err                     error
 	)
 	switch cfg.Type {
+	case config.TrailingStop:
+		if cfg.TrailRepost {
+			orderRequestId, orderId, err = e.sellTrailing(price, i, cfg)
+			if err != nil {
+				return "", "", fmt.Errorf("%w: sellTrailing err", err)
+			}
+			break
+		}
+		orderRequestId, orderId, err = e.sellStop(price, i, cfg)
+		if err != nil {
+			return "", "", fmt.Errorf("%w: sellStop err", err)
+		}
 	case config.TakeProfit, config.StopLoss, config.StopLimit:
 		orderRequestId, orderId, err = e.sellStop(price, i, cfg)
 		if err != nil {
 			return "", "", fmt.Errorf("%w: sellStop err", err)
 		}
 	case config.Market, config.Limit:
-		orderRequestId, orderId, err = e.sellMarket(price, i, cfg)
+		if cfg.Type == config.Limit && e.useAlgo(i, cfg) { // market sells are for closing positions at once
+			return e.startAlgo(price, i, cfg, false)
+		}
+		orderRequestId, orderId, err = e.sellMarket(_orderIdPrefix+uuid.NewString(), price, i, cfg)
 		if err != nil {
 			return "", "", fmt.Errorf("%w: sellMarket err", err)
 		}
@@ -147,26 +225,56 @@ func (e *Executor) Sell(price float64, i model.PortfolioInstrument, cfg config.O
 	return orderRequestId, orderId, err
 }
 
-func (e *Executor) sellMarket(price float64, i model.PortfolioInstrument, cfg config.OrderConfig) (string, string, error) {
-	orderRequestId := _orderIdPrefix + uuid.NewString()
+func (e *Executor) sellMarket(orderRequestId string, price float64, i model.PortfolioInstrument, cfg config.OrderConfig) (string, string, error) {
+	limitPrice := price * (1 + cfg.ProfitPercentIndent)
+	priced := cfg.Type == config.Limit && e.pricer != nil
+	var remaining float64
+	if priced {
+		quantity := i.Quantity
+		var err error
+		if limitPrice, i.Quantity, err = e.pricer.Price(i, false); err != nil {
+			return "", "", fmt.Errorf("%w: can't price limit order", err)
+		}
+		if remaining = quantity - i.Quantity; remaining > 0 {
+			e.logger.Infof("quantity of %s is capped by order book depth: %f of %f", i.InstrumentID, i.Quantity, quantity)
+		}
+	}
 
-	e.ordersRateLimiter.Take()
-	resp, err := e.ordersService.Sell(&investgo.PostOrderRequestShort{
-		InstrumentId: i.InstrumentID,
-		Quantity:     int64(i.Quantity),
-		Price:        tools.FloatToQuotation(price*(1+cfg.ProfitPercentIndent), i.MinPriceIncrement), // limit order price
-		AccountId:    i.AccountID,
-		OrderType:    cfg.Type.ToInvestType(),
-		OrderId:      orderRequestId,
+	o, limitPrice, err := e.checkOrderRisk(i, limitPrice, cfg, false)
+	if err != nil {
+		return "", "", err
+	}
+	i = o.Instrument
+
+	resp, err := broker.Call(e.retrier, "Sell", func() (*investgo.PostOrderResponse, error) {
+		e.ordersRateLimiter.Take()
+		return e.ordersService.Sell(&investgo.PostOrderRequestShort{
+			InstrumentId: i.InstrumentID,
+			Quantity:     int64(i.Quantity),
+			Price:        tools.FloatToQuotation(limitPrice, i.MinPriceIncrement), // limit order price
+			AccountId:    i.AccountID,
+			OrderType:    cfg.Type.ToInvestType(),
+			OrderId:      orderRequestId,
+		})
 	})
 	if err != nil {
 		return "", "", fmt.Errorf("%w: can't sell market", err)
 	}
 
+	if priced {
+		i.OrderRequestID, i.OrderID = orderRequestId, resp.GetOrderId()
+		e.addResting(RestingOrder{Instrument: i, Buy: false, Price: limitPrice, Remaining: remaining})
+	}
 	return orderRequestId, resp.GetOrderId(), nil
 }
 
 func (e *Executor) sellStop(price float64, i model.PortfolioInstrument, cfg config.OrderConfig) (string, string, error) {
+	o, err := e.checkStopRisk(i, false)
+	if err != nil {
+		return "", "", err
+	}
+	i = o.Instrument
+
 	orderRequestId := _orderIdPrefix + uuid.NewString()
 	req := &investgo.PostStopOrderRequest{
 		InstrumentId:   i.InstrumentID,
@@ -189,10 +297,20 @@ func (e *Executor) sellStop(price float64, i model.PortfolioInstrument, cfg conf
 		req.StopPrice = tools.FloatToQuotation(price*(1+cfg.ProfitPercentIndent), i.MinPriceIncrement)
 		req.ExchangeOrderType = investapi.ExchangeOrderType_EXCHANGE_ORDER_TYPE_MARKET
 		req.TakeProfitType = investapi.TakeProfitType_TAKE_PROFIT_TYPE_REGULAR
+	case config.TrailingStop: // activated at entry, so trailing starts from entry as in backtest
+		req.StopPrice = tools.FloatToQuotation(price, i.MinPriceIncrement)
+		req.ExchangeOrderType = investapi.ExchangeOrderType_EXCHANGE_ORDER_TYPE_MARKET
+		req.TakeProfitType = investapi.TakeProfitType_TAKE_PROFIT_TYPE_TRAILING
+		req.TrailingData = &investapi.PostStopOrderRequest_TrailingData{
+			Indent:     tools.FloatToQuotation(cfg.TrailPercent*100, 0.01), // in percents
+			IndentType: investapi.TrailingValueType_TRAILING_VALUE_RELATIVE,
+		}
 	}
 
-	e.stopOrdersRateLimiter.Take()
-	resp, err := e.stopOrdersService.PostStopOrder(req)
+	resp, err := broker.Call(e.retrier, "PostStopOrder", func() (*investgo.PostStopOrderResponse, error) {
+		e.stopOrdersRateLimiter.Take()
+		return e.stopOrdersService.PostStopOrder(req)
+	})
 	if err != nil {
 		return "", "", fmt.Errorf("%w: can't sell stop", err)
 	}
@@ -204,15 +322,33 @@ func (e *Executor) CancelOrder(i model.PortfolioInstrument, t config.OrderType)
 	switch t {
 	case config.StopLimit, config.StopLoss, config.TakeProfit:
 		return e.cancelStopOrder(i)
+	case config.TrailingStop:
+		e.mu.Lock()
+		o, ok := e.trailing[i.InstrumentID]
+		if ok { // stop could be re-posted with new id
+			i = o.Instrument
+			delete(e.trailing, i.InstrumentID)
+		}
+		e.mu.Unlock()
+		if i.OrderID == "" { // re-post failed, there is no active stop
+			return nil
+		}
+		return e.cancelStopOrder(i)
 	case config.Market, config.Limit:
+		if e.cancelParent(i.OrderRequestID) {
+			return nil
+		}
+		e.TakeResting(i.OrderRequestID)
 		return e.cancelMarketOrder(i)
 	}
 	return fmt.Errorf("unknown order type: %s", t)
 }
 
 func (e *Executor) cancelStopOrder(i model.PortfolioInstrument) error {
-	e.stopOrdersRateLimiter.Take()
-	_, err := e.stopOrdersService.CancelStopOrder(i.AccountID, i.OrderID)
+	_, err := broker.Call(e.retrier, "CancelStopOrder", func() (*investgo.CancelStopOrderResponse, error) {
+		e.stopOrdersRateLimiter.Take()
+		return e.stopOrdersService.CancelStopOrder(i.AccountID, i.OrderID)
+	})
 	if err != nil {
 		return fmt.Errorf("%w: can't cancel stop order", err)
 	}
@@ -220,7 +356,6 @@ func (e *Executor) cancelStopOrder(i model.PortfolioInstrument) error {
 }
 
 func (e *Executor) cancelMarketOrder(i model.PortfolioInstrument) error {
-	e.ordersRateLimiter.Take()
 	var (
 		orderIdType = new(investapi.OrderIdType)
 		id          string
@@ -235,7 +370,10 @@ func (e *Executor) cancelMarketOrder(i model.PortfolioInstrument) error {
 		return fmt.Errorf("empty orders id")
 	}
 
-	_, err := e.ordersService.CancelOrder(i.AccountID, id, orderIdType)
+	_, err := broker.Call(e.retrier, "CancelOrder", func() (*investgo.CancelOrderResponse, error) {
+		e.ordersRateLimiter.Take()
+		return e.ordersService.CancelOrder(i.AccountID, id, orderIdType)
+	})
 	if err != nil {
 		return fmt.Errorf("%w: can't cancel order", err)
 	}
@@ -0,0 +1,77 @@
+package executor
+
+import (
+	"fmt"
+
+	"github.com/STTM-NSU/trading-bot/internal/config"
+	"github.com/STTM-NSU/trading-bot/internal/invest/broker"
+	"github.com/STTM-NSU/trading-bot/internal/model"
+	"github.com/STTM-NSU/trading-bot/internal/tools"
+	"github.com/google/uuid"
+	"github.com/russianinvestments/invest-api-go-sdk/investgo"
+	investapi "github.com/russianinvestments/invest-api-go-sdk/proto"
+)
+
+// PostHedge posts protective sell stop for the whole position on price * (1 - HedgeOrder.DefencePercentIndent),
+// nothing is posted if hedge order type isn't stop one, e.g. in sandbox
+func (e *Executor) PostHedge(price float64, i model.PortfolioInstrument) (string, error) {
+	cfg := e.cfg.HedgeOrder
+	if cfg.Type != config.StopLimit && cfg.Type != config.StopLoss {
+		return "", nil
+	}
+
+	o, err := e.checkStopRisk(i, false)
+	if err != nil {
+		return "", err
+	}
+	i = o.Instrument
+
+	stopPrice := tools.FloatToQuotation(price*(1-cfg.DefencePercentIndent), i.MinPriceIncrement)
+	req := &investgo.PostStopOrderRequest{
+		InstrumentId:   i.InstrumentID,
+		Quantity:       int64(i.Quantity),
+		Direction:      investapi.StopOrderDirection_STOP_ORDER_DIRECTION_SELL,
+		AccountId:      i.AccountID,
+		ExpirationType: investapi.StopOrderExpirationType_STOP_ORDER_EXPIRATION_TYPE_GOOD_TILL_CANCEL,
+		StopOrderType:  cfg.Type.ToInvestStopType(),
+		PriceType:      investapi.PriceType_PRICE_TYPE_CURRENCY,
+		StopPrice:      stopPrice,
+		OrderID:        _orderIdPrefix + uuid.NewString(),
+	}
+	if cfg.Type == config.StopLimit {
+		req.Price = stopPrice
+	}
+
+	resp, err := broker.Call(e.retrier, "PostStopOrder", func() (*investgo.PostStopOrderResponse, error) {
+		e.stopOrdersRateLimiter.Take()
+		return e.stopOrdersService.PostStopOrder(req)
+	})
+	if err != nil {
+		return "", fmt.Errorf("%w: can't post hedge", err)
+	}
+	return resp.GetStopOrderId(), nil
+}
+
+func (e *Executor) CancelHedge(i model.PortfolioInstrument) error {
+	if i.HedgeOrderID == "" {
+		return nil
+	}
+	if _, err := broker.Call(e.retrier, "CancelStopOrder", func() (*investgo.CancelStopOrderResponse, error) {
+		e.stopOrdersRateLimiter.Take()
+		return e.stopOrdersService.CancelStopOrder(i.AccountID, i.HedgeOrderID)
+	}); err != nil {
+		return fmt.Errorf("%w: can't cancel hedge", err)
+	}
+	return nil
+}
+
+// ReplaceHedge cancels current hedge of instrument and posts new one for its quantity
+func (e *Executor) ReplaceHedge(price float64, i model.PortfolioInstrument) (string, error) {
+	if err := e.CancelHedge(i); err != nil {
+		e.logger.Warnf("%s: can't cancel hedge %s of %s", err, i.HedgeOrderID, i.InstrumentID)
+	}
+	if i.Quantity <= 0 {
+		return "", nil
+	}
+	return e.PostHedge(price, i)
+}
@@ -0,0 +1,161 @@
+package executor
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/STTM-NSU/trading-bot/internal/config"
+	"github.com/STTM-NSU/trading-bot/internal/invest/broker"
+	"github.com/STTM-NSU/trading-bot/internal/model"
+	"github.com/STTM-NSU/trading-bot/internal/tools"
+	"github.com/google/uuid"
+	"github.com/russianinvestments/invest-api-go-sdk/investgo"
+	investapi "github.com/russianinvestments/invest-api-go-sdk/proto"
+)
+
+type OrderBookSource interface {
+	GetOrderBook(instrumentId string, depth int32) (model.OrderBook, error)
+}
+
+// Pricer places limit orders relative to the best bid and ask
+type Pricer struct {
+	source OrderBookSource
+	cfg    config.LimitPricingConfig
+}
+
+func NewPricer(source OrderBookSource, cfg config.LimitPricingConfig) *Pricer {
+	return &Pricer{
+		source: source,
+		cfg:    cfg,
+	}
+}
+
+// Price returns limit price and quantity capped by order book depth
+func (p *Pricer) Price(i model.PortfolioInstrument, buy bool) (float64, float64, error) {
+	book, err := p.source.GetOrderBook(i.InstrumentID, p.cfg.Depth)
+	if err != nil {
+		return 0, 0, err
+	}
+	price, err := LimitPrice(book, buy, i.MinPriceIncrement, p.cfg.TickOffset)
+	if err != nil {
+		return 0, 0, err
+	}
+	return price, CapQuantity(book, buy, i.Quantity, p.cfg.MaxDepthShare), nil
+}
+
+// LimitPrice moves the best bid for buy or the best ask for sell by offset ticks into the spread,
+// but doesn't cross the opposite side
+func LimitPrice(book model.OrderBook, buy bool, tick float64, offset int) (float64, error) {
+	if len(book.Bids) == 0 || len(book.Asks) == 0 {
+		return 0, fmt.Errorf("empty order book")
+	}
+	bid, ask := book.Bids[0].Price, book.Asks[0].Price
+	if buy {
+		return min(bid+float64(offset)*tick, ask), nil
+	}
+	return max(ask-float64(offset)*tick, bid), nil
+}
+
+// CapQuantity caps quantity in lots by share of lots on the opposite side, at least one lot remains
+func CapQuantity(book model.OrderBook, buy bool, quantity, share float64) float64 {
+	levels := book.Asks
+	if !buy {
+		levels = book.Bids
+	}
+	var depth float64
+	for _, l := range levels {
+		depth += l.Quantity
+	}
+	if depth == 0 || share <= 0 {
+		return quantity
+	}
+	return min(quantity, max(1, math.Floor(depth*share)))
+}
+
+// TouchMovedAway reports whether the best price on order side moved away from order price by ticks
+func TouchMovedAway(book model.OrderBook, buy bool, orderPrice, tick float64, ticks int) bool {
+	if buy {
+		if len(book.Bids) == 0 {
+			return false
+		}
+		return book.Bids[0].Price-orderPrice >= float64(ticks)*tick
+	}
+	if len(book.Asks) == 0 {
+		return false
+	}
+	return orderPrice-book.Asks[0].Price >= float64(ticks)*tick
+}
+
+// RestingOrder is placed limit order that can be re-priced
+type RestingOrder struct {
+	Instrument model.PortfolioInstrument
+	Buy        bool
+	Price      float64
+	Remaining  float64 // lots which weren't placed because of order book depth cap
+}
+
+func (e *Executor) addResting(o RestingOrder) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.resting[o.Instrument.OrderRequestID] = o
+}
+
+// Resting returns limit order priced by order book
+func (e *Executor) Resting(orderRequestId string) (RestingOrder, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	o, ok := e.resting[orderRequestId]
+	return o, ok
+}
+
+// TakeResting stops tracking limit order, e.g. after it is done, remainder of depth cap is left to caller
+func (e *Executor) TakeResting(orderRequestId string) (RestingOrder, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	o, ok := e.resting[orderRequestId]
+	delete(e.resting, orderRequestId)
+	return o, ok
+}
+
+// Reprice replaces resting limit order when the touch moved away, returns updated order and whether it was replaced.
+// Quantity of order must be its not executed lots
+func (e *Executor) Reprice(o RestingOrder) (RestingOrder, bool, error) {
+	if e.pricer == nil {
+		return o, false, nil
+	}
+
+	book, err := e.pricer.source.GetOrderBook(o.Instrument.InstrumentID, e.pricer.cfg.Depth)
+	if err != nil {
+		return o, false, fmt.Errorf("%w: can't get order book", err)
+	}
+	if !TouchMovedAway(book, o.Buy, o.Price, o.Instrument.MinPriceIncrement, e.pricer.cfg.RepriceTicks) {
+		return o, false, nil
+	}
+	price, err := LimitPrice(book, o.Buy, o.Instrument.MinPriceIncrement, e.pricer.cfg.TickOffset)
+	if err != nil {
+		return o, false, err
+	}
+
+	orderRequestId := _orderIdPrefix + uuid.NewString()
+	resp, err := broker.Call(e.retrier, "ReplaceOrder", func() (*investgo.PostOrderResponse, error) {
+		e.ordersRateLimiter.Take()
+		return e.ordersService.ReplaceOrder(&investgo.ReplaceOrderRequest{
+			AccountId:  o.Instrument.AccountID,
+			OrderId:    o.Instrument.OrderID,
+			NewOrderId: orderRequestId,
+			Quantity:   int64(o.Instrument.Quantity),
+			Price:      tools.FloatToQuotation(price, o.Instrument.MinPriceIncrement),
+			PriceType:  investapi.PriceType_PRICE_TYPE_CURRENCY,
+		})
+	})
+	if err != nil {
+		return o, false, fmt.Errorf("%w: can't replace order", err)
+	}
+
+	e.logger.Infof("reprice %s %f -> %f", o.Instrument.InstrumentID, o.Price, price)
+	e.TakeResting(o.Instrument.OrderRequestID)
+	o.Instrument.OrderRequestID, o.Instrument.OrderID = orderRequestId, resp.GetOrderId()
+	o.Price = price
+	e.addResting(o)
+	return o, true, nil
+}
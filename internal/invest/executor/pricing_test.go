@@ -0,0 +1,60 @@
+package executor
+
+import (
+	"testing"
+
+	"github.com/STTM-NSU/trading-bot/internal/model"
+)
+
+func testBook() model.OrderBook {
+	return model.OrderBook{
+		Bids: []model.OrderBookLevel{{Price: 99.9, Quantity: 10}, {Price: 99.8, Quantity: 20}},
+		Asks: []model.OrderBookLevel{{Price: 100.2, Quantity: 5}, {Price: 100.3, Quantity: 5}},
+	}
+}
+
+func TestLimitPrice(t *testing.T) {
+	book := testBook()
+
+	if p, _ := LimitPrice(book, true, 0.1, 1); p != 99.9+0.1 {
+		t.Errorf("unexpected buy price %f", p)
+	}
+	// offset doesn't cross the spread
+	if p, _ := LimitPrice(book, true, 0.1, 10); p != 100.2 {
+		t.Errorf("unexpected buy price %f", p)
+	}
+	if p, _ := LimitPrice(book, false, 0.1, 0); p != 100.2 {
+		t.Errorf("unexpected sell price %f", p)
+	}
+	if _, err := LimitPrice(model.OrderBook{}, true, 0.1, 0); err == nil {
+		t.Errorf("expected error for empty book")
+	}
+}
+
+func TestCapQuantity(t *testing.T) {
+	book := testBook()
+
+	if q := CapQuantity(book, true, 100, 0.5); q != 5 {
+		t.Errorf("unexpected buy quantity %f", q)
+	}
+	if q := CapQuantity(book, false, 100, 0.5); q != 15 {
+		t.Errorf("unexpected sell quantity %f", q)
+	}
+	if q := CapQuantity(book, true, 100, 0.01); q != 1 {
+		t.Errorf("at least one lot expected, got %f", q)
+	}
+}
+
+func TestTouchMovedAway(t *testing.T) {
+	book := testBook()
+
+	if !TouchMovedAway(book, true, 99.6, 0.1, 2) {
+		t.Errorf("bid moved away from buy order")
+	}
+	if TouchMovedAway(book, true, 99.9, 0.1, 2) {
+		t.Errorf("buy order is on the touch")
+	}
+	if !TouchMovedAway(book, false, 100.5, 0.1, 2) {
+		t.Errorf("ask moved away from sell order")
+	}
+}
@@ -0,0 +1,293 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/STTM-NSU/trading-bot/internal/config"
+	"github.com/STTM-NSU/trading-bot/internal/logger"
+	"github.com/STTM-NSU/trading-bot/internal/model"
+)
+
+var ErrRiskRejected = errors.New("order is rejected by risk checks")
+
+type RiskSource interface {
+	GetOrderBook(instrumentId string, depth int32) (model.OrderBook, error)
+	GetTradingStatus(instrumentId string) (model.TradingStatus, error)
+	GetLastPrice(instrumentId string) (float64, error)
+}
+
+type RiskPortfolio interface {
+	GetBalance(currency string) float64
+	GetInstruments() ([]model.PortfolioInstrument, error)
+}
+
+// RiskChecker rejects or adjusts orders before they are sent to broker
+type RiskChecker struct {
+	source    RiskSource
+	portfolio RiskPortfolio
+	cfg       config.RiskConfig
+	qualified bool // account has qualified investor status
+	logger    logger.Logger
+
+	mu          sync.RWMutex
+	instruments map[string]model.Instrument // uid -> instrument
+	reserved    map[string]float64          // currency -> cash of accepted buys which aren't filled yet
+}
+
+func NewRiskChecker(source RiskSource, portfolio RiskPortfolio, qualified bool, cfg config.RiskConfig, logger logger.Logger) *RiskChecker {
+	return &RiskChecker{
+		source:      source,
+		portfolio:   portfolio,
+		cfg:         cfg,
+		qualified:   qualified,
+		logger:      logger,
+		instruments: make(map[string]model.Instrument),
+		reserved:    make(map[string]float64),
+	}
+}
+
+// SetInstruments sets currency, sector and qualified investor flag of instruments for checks
+func (r *RiskChecker) SetInstruments(instruments []model.Instrument) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, i := range instruments {
+		r.instruments[i.UID] = i
+	}
+}
+
+func (r *RiskChecker) instrument(uid string) model.Instrument {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.instruments[uid]
+}
+
+func (r *RiskChecker) reservedCash(currency string) float64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.reserved[currency]
+}
+
+func (r *RiskChecker) reserve(currency string, amount float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reserved[currency] = max(r.reserved[currency]+amount, 0)
+}
+
+// Release returns reserved cash of buy fill, which is taken from portfolio balance now
+func (r *RiskChecker) Release(instrumentId string, amount float64) {
+	r.reserve(r.instrument(instrumentId).Currency, -amount)
+}
+
+// ResetReserved releases cash of all buys, e.g. after not filled buys are cancelled on rebalance
+func (r *RiskChecker) ResetReserved() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reserved = make(map[string]float64)
+}
+
+// RiskOrder is order before it is sent, price is zero for market and stop orders
+type RiskOrder struct {
+	Instrument model.PortfolioInstrument
+	Buy        bool
+	Price      float64
+	Stop       bool    // stop orders can be posted when instrument isn't traded
+	Reducing   bool    // order closes position, e.g. short cover, so only status and price are checked
+	Reserved   float64 // cash reserved for accepted buy, it is released if order isn't posted
+}
+
+// Check returns order with adjusted quantity and price, rejected order error wraps ErrRiskRejected
+func (r *RiskChecker) Check(o RiskOrder) (RiskOrder, error) {
+	id := o.Instrument.InstrumentID
+	info := r.instrument(id)
+
+	if o.Buy && !o.Reducing && info.ForQualInvestor && !r.qualified {
+		return o, fmt.Errorf("%w: %s is for qualified investors only", ErrRiskRejected, id)
+	}
+
+	if !o.Stop {
+		status, err := r.source.GetTradingStatus(id)
+		if err != nil {
+			return o, fmt.Errorf("%w: can't check trading status", err)
+		}
+		if !status.NormalTrading || !status.APITradeAvailable {
+			return o, fmt.Errorf("%w: %s isn't in normal trading", ErrRiskRejected, id)
+		}
+	}
+
+	if o.Price > 0 {
+		book, err := r.source.GetOrderBook(id, 1)
+		if err != nil {
+			return o, fmt.Errorf("%w: can't check price limits", err)
+		}
+		if price := ClampPrice(o.Price, book.LimitDown, book.LimitUp); price != o.Price {
+			r.logger.Infof("risk: price of %s %f is moved into limits [%f, %f]", id, o.Price, book.LimitDown, book.LimitUp)
+			o.Price = price
+		}
+	}
+
+	// sell of held position closes it, sell of not held one opens short
+	if o.Reducing || !o.Buy && r.holds(id) {
+		return o, nil
+	}
+
+	price := o.Price
+	if price == 0 {
+		var err error
+		if price, err = r.source.GetLastPrice(id); err != nil {
+			return o, fmt.Errorf("%w: can't get price for risk checks", err)
+		}
+	}
+	lotValue := price * o.Instrument.Lot
+	if lotValue <= 0 {
+		return o, nil
+	}
+
+	balance := r.portfolio.GetBalance(info.Currency)
+	equity, held, sectorHeld := r.exposure(id, info)
+	equity += balance
+
+	quantity := min(o.Instrument.Quantity, LimitByWeight(lotValue, held, equity, r.cfg.MaxInstrumentWeight))
+	if info.Sector != "" {
+		quantity = min(quantity, LimitByWeight(lotValue, sectorHeld, equity, r.cfg.MaxSectorWeight))
+	}
+	if o.Buy { // margin of short is checked by broker
+		cash := balance - r.reservedCash(info.Currency) // the rest of buys of one rebalance are paid from it
+		quantity = min(quantity, math.Floor(cash/lotValue))
+	}
+	if quantity < 1 {
+		return o, fmt.Errorf("%w: %s exceeds cash or weight limits", ErrRiskRejected, id)
+	}
+	if quantity < o.Instrument.Quantity {
+		r.logger.Infof("risk: quantity of %s is reduced %f -> %f", id, o.Instrument.Quantity, quantity)
+		o.Instrument.Quantity = quantity
+	}
+	if o.Buy {
+		o.Reserved = quantity * lotValue
+		r.reserve(info.Currency, o.Reserved)
+	}
+	return o, nil
+}
+
+// holds reports whether instrument is held, it is assumed to be held if portfolio isn't available,
+// so closing sells aren't rejected
+func (r *RiskChecker) holds(id string) bool {
+	instruments, err := r.portfolio.GetInstruments()
+	if err != nil {
+		r.logger.Warnf("%s: can't get portfolio for risk checks", err)
+		return true
+	}
+	for _, i := range instruments {
+		if i.InstrumentID == id && i.Quantity > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// exposure returns absolute value of positions in instrument currency, value of instrument and of its sector
+func (r *RiskChecker) exposure(id string, info model.Instrument) (float64, float64, float64) {
+	instruments, err := r.portfolio.GetInstruments()
+	if err != nil {
+		r.logger.Warnf("%s: can't get portfolio for risk checks", err)
+		return 0, 0, 0
+	}
+
+	var equity, held, sectorHeld float64
+	for _, i := range instruments {
+		other := r.instrument(i.InstrumentID)
+		if other.Currency != "" && other.Currency != info.Currency {
+			continue
+		}
+		value := math.Abs(i.EntryPrice)
+		if price, err := r.source.GetLastPrice(i.InstrumentID); err == nil {
+			value = math.Abs(price * i.Quantity * i.Lot)
+		}
+		equity += value
+		if i.InstrumentID == id {
+			held += value
+		}
+		if info.Sector != "" && other.Sector == info.Sector {
+			sectorHeld += value
+		}
+	}
+	return equity, held, sectorHeld
+}
+
+// LimitByWeight returns max lots to buy, so value stays within weight of equity, no limit for zero weight
+func LimitByWeight(lotValue, held, equity, maxWeight float64) float64 {
+	if maxWeight <= 0 {
+		return math.Inf(1)
+	}
+	return max(0, math.Floor((maxWeight*equity-held)/lotValue))
+}
+
+// ClampPrice moves price into exchange limits, zero limits are unknown ones
+func ClampPrice(price, limitDown, limitUp float64) float64 {
+	if limitUp > 0 {
+		price = min(price, limitUp)
+	}
+	if limitDown > 0 {
+		price = max(price, limitDown)
+	}
+	return price
+}
+
+// checkRisk is no-op without risk checker
+func (e *Executor) checkRisk(o RiskOrder) (RiskOrder, error) {
+	if e.risk == nil {
+		return o, nil
+	}
+	return e.risk.Check(o)
+}
+
+// checkOrderRisk checks market or limit order, price is checked only for limit ones
+func (e *Executor) checkOrderRisk(i model.PortfolioInstrument, limitPrice float64, cfg config.OrderConfig, buy bool) (RiskOrder, float64, error) {
+	o := RiskOrder{Instrument: i, Buy: buy, Reducing: buy && e.isShort(i.InstrumentID)}
+	if cfg.Type == config.Limit {
+		o.Price = limitPrice
+	}
+	o, err := e.checkRisk(o)
+	if err != nil {
+		return o, limitPrice, err
+	}
+	if cfg.Type == config.Limit {
+		limitPrice = o.Price
+	}
+	return o, limitPrice, nil
+}
+
+// checkStopRisk checks quantity of stop order
+func (e *Executor) checkStopRisk(i model.PortfolioInstrument, buy bool) (RiskOrder, error) {
+	return e.checkRisk(RiskOrder{Instrument: i, Buy: buy, Stop: true, Reducing: buy && e.isShort(i.InstrumentID)})
+}
+
+// releaseRisk releases cash reserved for order which wasn't posted
+func (e *Executor) releaseRisk(o RiskOrder) {
+	if e.risk != nil && o.Reserved > 0 {
+		e.risk.Release(o.Instrument.InstrumentID, o.Reserved)
+	}
+}
+
+// ReleaseCash releases cash reserved by risk checker for buy fill of amount
+func (e *Executor) ReleaseCash(instrumentId string, amount float64) {
+	if e.risk != nil {
+		e.risk.Release(instrumentId, amount)
+	}
+}
+
+// ResetReservedCash releases cash of all buys after they are cancelled
+func (e *Executor) ResetReservedCash() {
+	if e.risk != nil {
+		e.risk.ResetReserved()
+	}
+}
+
+func (e *Executor) isShort(instrumentId string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, ok := e.shorts[instrumentId]
+	return ok
+}
@@ -0,0 +1,110 @@
+package executor
+
+import (
+	"testing"
+
+	"github.com/STTM-NSU/trading-bot/internal/config"
+	"github.com/STTM-NSU/trading-bot/internal/logger"
+	"github.com/STTM-NSU/trading-bot/internal/model"
+)
+
+func TestLimitByWeight(t *testing.T) {
+	// 20% of 10000 is 2000, 500 is held, so 1500 / 100 per lot
+	if q := LimitByWeight(100, 500, 10000, 0.2); q != 15 {
+		t.Errorf("unexpected lots %f", q)
+	}
+	if q := LimitByWeight(100, 3000, 10000, 0.2); q != 0 {
+		t.Errorf("weight is already exceeded, got %f", q)
+	}
+}
+
+func TestClampPrice(t *testing.T) {
+	if p := ClampPrice(120, 90, 110); p != 110 {
+		t.Errorf("unexpected price %f", p)
+	}
+	if p := ClampPrice(80, 90, 110); p != 90 {
+		t.Errorf("unexpected price %f", p)
+	}
+	if p := ClampPrice(80, 0, 0); p != 80 {
+		t.Errorf("unknown limits mustn't change price, got %f", p)
+	}
+}
+
+type testRiskSource struct{}
+
+func (testRiskSource) GetOrderBook(string, int32) (model.OrderBook, error) {
+	return model.OrderBook{}, nil
+}
+
+func (testRiskSource) GetTradingStatus(string) (model.TradingStatus, error) {
+	return model.TradingStatus{NormalTrading: true, APITradeAvailable: true}, nil
+}
+
+func (testRiskSource) GetLastPrice(string) (float64, error) {
+	return 100, nil
+}
+
+type testRiskPortfolio struct{}
+
+func (testRiskPortfolio) GetBalance(string) float64 {
+	return 1000
+}
+
+func (testRiskPortfolio) GetInstruments() ([]model.PortfolioInstrument, error) {
+	return nil, nil
+}
+
+func TestRiskReservesCash(t *testing.T) {
+	l, _, err := logger.NewZapLogger(logger.Error)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewRiskChecker(testRiskSource{}, testRiskPortfolio{}, false, config.RiskConfig{Enabled: true}, l)
+	buy := func(id string) float64 {
+		o, err := r.Check(RiskOrder{Instrument: model.PortfolioInstrument{InstrumentID: id, Lot: 1, Quantity: 6}, Buy: true})
+		if err != nil {
+			return 0
+		}
+		return o.Instrument.Quantity
+	}
+
+	// buys of one rebalance are paid from the same cash
+	if q := buy("a"); q != 6 {
+		t.Errorf("unexpected quantity %f", q)
+	}
+	if q := buy("b"); q != 4 {
+		t.Errorf("unexpected quantity of the second buy %f", q)
+	}
+	if q := buy("c"); q != 0 {
+		t.Errorf("cash is reserved, got %f", q)
+	}
+
+	r.ResetReserved()
+	if q := buy("c"); q != 6 {
+		t.Errorf("unexpected quantity after reset %f", q)
+	}
+}
+
+func TestRiskReleasesAndLimitsShorts(t *testing.T) {
+	l, _, err := logger.NewZapLogger(logger.Error)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewRiskChecker(testRiskSource{}, testRiskPortfolio{}, false, config.RiskConfig{Enabled: true, MaxInstrumentWeight: 0.5}, l)
+
+	// cash of buy which isn't posted is released
+	o, err := r.Check(RiskOrder{Instrument: model.PortfolioInstrument{InstrumentID: "a", Lot: 1, Quantity: 5}, Buy: true})
+	if err != nil || o.Reserved != 500 {
+		t.Fatalf("unexpected reserve %f: %v", o.Reserved, err)
+	}
+	r.Release("a", o.Reserved)
+	if c := r.reservedCash(""); c != 0 {
+		t.Errorf("cash is still reserved: %f", c)
+	}
+
+	// short of not held instrument is limited by weight and reserves nothing
+	o, err = r.Check(RiskOrder{Instrument: model.PortfolioInstrument{InstrumentID: "b", Lot: 1, Quantity: 8}})
+	if err != nil || o.Instrument.Quantity != 5 || o.Reserved != 0 {
+		t.Errorf("unexpected short quantity %f, reserve %f: %v", o.Instrument.Quantity, o.Reserved, err)
+	}
+}
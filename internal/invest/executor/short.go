@@ -0,0 +1,297 @@
+package executor
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/STTM-NSU/trading-bot/internal/config"
+	"github.com/STTM-NSU/trading-bot/internal/invest/broker"
+	"github.com/STTM-NSU/trading-bot/internal/model"
+	"github.com/STTM-NSU/trading-bot/internal/tools"
+	"github.com/google/uuid"
+	"github.com/russianinvestments/invest-api-go-sdk/investgo"
+	investapi "github.com/russianinvestments/invest-api-go-sdk/proto"
+)
+
+// ShortPosition is opened short with its buy-to-cover stop orders
+type ShortPosition struct {
+	Instrument   model.PortfolioInstrument // order ids are of short sell
+	EntryPrice   float64                   // average fill price, zero until short sell is filled
+	HedgeID      string                    // protective buy stop
+	TakeProfitID string
+	CoverID      string // order request id of market cover which isn't filled yet
+
+	cfg config.MarginTradingConfig
+}
+
+func (s ShortPosition) filled() bool {
+	return s.EntryPrice > 0
+}
+
+// CanShort checks that broker allows short for instrument and margin attributes are set
+func CanShort(rates model.RiskRates) error {
+	if !rates.ShortEnabled {
+		return fmt.Errorf("short is disabled for instrument")
+	}
+	if rates.Dshort <= 0 || rates.DshortMin <= 0 || rates.Kshort <= 0 {
+		return fmt.Errorf("empty short margin attributes")
+	}
+	return nil
+}
+
+// SellShort places market short sell, its protective buy stop on fill price * (1 + HedgePercent)
+// and take profit on fill price * (1 - ShortProfitPercent) are posted by OnShortOrder when it is filled
+func (e *Executor) SellShort(price float64, i model.PortfolioInstrument, rates model.RiskRates, cfg config.MarginTradingConfig) (ShortPosition, error) {
+	if err := CanShort(rates); err != nil {
+		return ShortPosition{}, fmt.Errorf("%w: can't short %s", err, i.InstrumentID)
+	}
+
+	limits, err := broker.Call(e.retrier, "GetMaxLots", func() (*investgo.GetMaxLotsResponse, error) {
+		e.ordersRateLimiter.Take()
+		return e.ordersService.GetMaxLots(i.AccountID, i.InstrumentID, tools.FloatToQuotation(price, i.MinPriceIncrement))
+	})
+	if err != nil {
+		return ShortPosition{}, fmt.Errorf("%w: can't get max lots", err)
+	}
+	if maxLots := limits.GetSellMarginLimits().GetSellMaxLots(); int64(i.Quantity) > maxLots {
+		return ShortPosition{}, fmt.Errorf("not enough margin for %s: %d > %d lots", i.InstrumentID, int64(i.Quantity), maxLots)
+	}
+
+	// short is tracked before order is posted, fill can come from stream before post returns
+	i.OrderRequestID = _orderIdPrefix + uuid.NewString()
+	e.mu.Lock()
+	e.shorts[i.InstrumentID] = ShortPosition{Instrument: i, cfg: cfg}
+	e.mu.Unlock()
+
+	_, orderId, err := e.sellMarket(i.OrderRequestID, price, i, config.OrderConfig{Type: config.Market})
+	if err != nil {
+		e.RemoveShort(i.InstrumentID)
+		return ShortPosition{}, fmt.Errorf("%w: can't sell short", err)
+	}
+	i.OrderID = orderId
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s := e.shorts[i.InstrumentID]
+	s.Instrument.OrderID = orderId
+	e.shorts[i.InstrumentID] = s
+	return s, nil
+}
+
+// postCoverStops posts hedge and take profit of short priced from its entry
+func (e *Executor) postCoverStops(s ShortPosition) ShortPosition {
+	var err error
+	s.HedgeID, err = e.postCoverStop(s.EntryPrice*(1+s.cfg.HedgePercent), s.Instrument, config.StopLoss)
+	if err != nil {
+		e.logger.Errorf("%s: can't post hedge for short %s", err, s.Instrument.InstrumentID)
+	}
+	s.TakeProfitID, err = e.postCoverStop(s.EntryPrice*(1-s.cfg.ShortProfitPercent), s.Instrument, config.TakeProfit)
+	if err != nil {
+		e.logger.Errorf("%s: can't post take profit for short %s", err, s.Instrument.InstrumentID)
+	}
+	return s
+}
+
+func (e *Executor) postCoverStop(stopPrice float64, i model.PortfolioInstrument, t config.OrderType) (string, error) {
+	o, err := e.checkRisk(RiskOrder{Instrument: i, Buy: true, Stop: true, Reducing: true})
+	if err != nil {
+		return "", err
+	}
+	i = o.Instrument
+
+	req := &investgo.PostStopOrderRequest{
+		InstrumentId:      i.InstrumentID,
+		Quantity:          int64(i.Quantity),
+		Direction:         investapi.StopOrderDirection_STOP_ORDER_DIRECTION_BUY,
+		AccountId:         i.AccountID,
+		ExpirationType:    investapi.StopOrderExpirationType_STOP_ORDER_EXPIRATION_TYPE_GOOD_TILL_CANCEL,
+		StopOrderType:     t.ToInvestStopType(),
+		PriceType:         investapi.PriceType_PRICE_TYPE_CURRENCY,
+		StopPrice:         tools.FloatToQuotation(stopPrice, i.MinPriceIncrement),
+		ExchangeOrderType: investapi.ExchangeOrderType_EXCHANGE_ORDER_TYPE_MARKET,
+		OrderID:           _orderIdPrefix + uuid.NewString(),
+	}
+	if t == config.TakeProfit {
+		req.TakeProfitType = investapi.TakeProfitType_TAKE_PROFIT_TYPE_REGULAR
+	}
+
+	resp, err := broker.Call(e.retrier, "PostStopOrder", func() (*investgo.PostStopOrderResponse, error) {
+		e.stopOrdersRateLimiter.Take()
+		return e.stopOrdersService.PostStopOrder(req)
+	})
+	if err != nil {
+		return "", fmt.Errorf("%w: can't post cover stop", err)
+	}
+
+	return resp.GetStopOrderId(), nil
+}
+
+func (e *Executor) cancelCoverStops(s ShortPosition) {
+	for _, id := range []string{s.HedgeID, s.TakeProfitID} {
+		if id == "" {
+			continue
+		}
+		if _, err := broker.Call(e.retrier, "CancelStopOrder", func() (*investgo.CancelStopOrderResponse, error) {
+			e.stopOrdersRateLimiter.Take()
+			return e.stopOrdersService.CancelStopOrder(s.Instrument.AccountID, id)
+		}); err != nil {
+			e.logger.Warnf("%s: can't cancel stop order %s", err, id)
+		}
+	}
+}
+
+// CoverShort buys short out by market, its stop orders are cancelled by OnShortOrder when cover is filled,
+// so short stays hedged if cover fails
+func (e *Executor) CoverShort(s ShortPosition) error {
+	if !s.filled() {
+		return fmt.Errorf("short sell of %s isn't filled yet", s.Instrument.InstrumentID)
+	}
+	if s.CoverID != "" {
+		return nil
+	}
+
+	coverID := _orderIdPrefix + uuid.NewString()
+	if !e.setCover(s.Instrument.InstrumentID, coverID) {
+		return nil // covered by stop meanwhile
+	}
+	i := s.Instrument
+	i.OrderRequestID, i.OrderID = "", ""
+	if _, _, err := e.buyMarket(coverID, s.EntryPrice, i, config.OrderConfig{Type: config.Market}); err != nil {
+		e.setCover(s.Instrument.InstrumentID, "")
+		return fmt.Errorf("%w: can't cover short", err)
+	}
+	return nil
+}
+
+func (e *Executor) setCover(instrumentID, coverID string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s, ok := e.shorts[instrumentID]
+	if ok {
+		s.CoverID = coverID
+		e.shorts[instrumentID] = s
+	}
+	return ok
+}
+
+// OnShortOrder handles states of short sells and market covers, it returns false for other orders.
+// Cover stops are posted from fill price when short sell is done and cancelled when cover is done
+func (e *Executor) OnShortOrder(s model.OrderState) bool {
+	e.mu.Lock()
+	short, ok := e.shorts[s.InstrumentID]
+	e.mu.Unlock()
+	if !ok || s.OrderRequestID == "" {
+		return false
+	}
+
+	switch {
+	case !s.Buy && s.OrderRequestID == short.Instrument.OrderRequestID:
+		if !s.Done {
+			return true
+		}
+		if s.LotsExecuted <= 0 {
+			e.RemoveShort(s.InstrumentID)
+			e.logger.Warnf("short sell of %s isn't filled, order %s", s.InstrumentID, s.OrderID)
+			return true
+		}
+		short.Instrument.Quantity, short.EntryPrice = s.LotsExecuted, s.ExecutedPrice
+		e.storeShort(e.postCoverStops(short))
+	case s.Buy && s.OrderRequestID == short.CoverID:
+		if !s.Done {
+			return true
+		}
+		short.CoverID = ""
+		if s.LotsExecuted <= 0 { // stops are kept
+			e.storeShort(short)
+			e.logger.Warnf("cover of short %s isn't filled, order %s", s.InstrumentID, s.OrderID)
+			return true
+		}
+		e.cancelCoverStops(short)
+		short.HedgeID, short.TakeProfitID = "", ""
+		if short.Instrument.Quantity -= s.LotsExecuted; short.Instrument.Quantity <= 0 {
+			e.RemoveShort(s.InstrumentID)
+			e.logger.Infof("short %s is covered, order %s", s.InstrumentID, s.OrderID)
+			return true
+		}
+		e.logger.Warnf("cover of short %s is done with %f lots left", s.InstrumentID, short.Instrument.Quantity)
+		e.storeShort(e.postCoverStops(short))
+	default:
+		return false
+	}
+	return true
+}
+
+// storeShort updates short unless it was removed meanwhile
+func (e *Executor) storeShort(s ShortPosition) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.shorts[s.Instrument.InstrumentID]; ok {
+		e.shorts[s.Instrument.InstrumentID] = s
+	}
+}
+
+// RemoveShort stops tracking short which was covered by one of its stop orders
+func (e *Executor) RemoveShort(instrumentID string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.shorts, instrumentID)
+}
+
+// OnCoverFill handles buy of instrument which isn't bought by bot: if it is short, one of its cover stops fired,
+// so the sibling stop is cancelled on the first fill and short is removed when cover is done.
+// Exchange order of fired stop has its own id, so the fired leg isn't known and both legs are cancelled
+func (e *Executor) OnCoverFill(s model.OrderState) bool {
+	e.mu.Lock()
+	short, ok := e.shorts[s.InstrumentID]
+	if ok {
+		cleared := short
+		cleared.HedgeID, cleared.TakeProfitID = "", ""
+		e.shorts[s.InstrumentID] = cleared
+	}
+	e.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	e.cancelCoverStops(short)
+	if s.Done {
+		e.RemoveShort(s.InstrumentID)
+		e.logger.Infof("short %s is covered by stop order, order %s", s.InstrumentID, s.OrderID)
+	}
+	return true
+}
+
+func (e *Executor) GetShorts() []ShortPosition {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	res := make([]ShortPosition, 0, len(e.shorts))
+	for _, s := range e.shorts {
+		res = append(res, s)
+	}
+	return res
+}
+
+// ShouldCover reports whether shorts must be covered, because session ends in less than before
+func ShouldCover(now time.Time, schedule model.TradingSchedule, before time.Duration) bool {
+	if !schedule.IsTradingDay {
+		return false
+	}
+	return !now.Before(schedule.EndDate.Add(-before))
+}
+
+// CoverShortsBeforeClose covers all shorts when session end is closer than CoverBeforeClose,
+// shorts aren't carried overnight as in backtest
+func (e *Executor) CoverShortsBeforeClose(now time.Time, schedule model.TradingSchedule, cfg config.MarginTradingConfig) {
+	if !ShouldCover(now, schedule, cfg.CoverBeforeClose) {
+		return
+	}
+
+	for _, s := range e.GetShorts() {
+		if err := e.CoverShort(s); err != nil {
+			e.logger.Errorf("%s: can't cover short %s before close", err, s.Instrument.InstrumentID)
+			continue
+		}
+		e.logger.Infof("short %s covered before session end %s", s.Instrument.InstrumentID, schedule.EndDate)
+	}
+}
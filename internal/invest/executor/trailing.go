@@ -0,0 +1,114 @@
+package executor
+
+import (
+	"fmt"
+
+	"github.com/STTM-NSU/trading-bot/internal/config"
+	"github.com/STTM-NSU/trading-bot/internal/model"
+)
+
+// TrailingOrder is sell stop loss which is re-posted by bot as price rises,
+// used where broker trailing stop orders aren't available
+type TrailingOrder struct {
+	Instrument model.PortfolioInstrument
+	High       float64 // running high since entry
+	StopPrice  float64
+	Trail      float64
+}
+
+func (o TrailingOrder) posted() bool {
+	return o.Instrument.OrderID != ""
+}
+
+// TrailStopPrice returns stop price for running high, it is moved only up by at least one tick
+func TrailStopPrice(high, trail, stopPrice, tick float64) (float64, bool) {
+	newStopPrice := high * (1 - trail)
+	if newStopPrice-stopPrice < tick {
+		return stopPrice, false
+	}
+	return newStopPrice, true
+}
+
+func (e *Executor) sellTrailing(price float64, i model.PortfolioInstrument, cfg config.OrderConfig) (string, string, error) {
+	stopPrice := price * (1 - cfg.TrailPercent)
+	orderRequestId, orderId, err := e.postTrailingStop(stopPrice, i)
+	if err != nil {
+		return "", "", err
+	}
+	i.OrderRequestID, i.OrderID = orderRequestId, orderId
+
+	e.mu.Lock()
+	e.trailing[i.InstrumentID] = TrailingOrder{
+		Instrument: i,
+		High:       price,
+		StopPrice:  stopPrice,
+		Trail:      cfg.TrailPercent,
+	}
+	e.mu.Unlock()
+
+	return orderRequestId, orderId, nil
+}
+
+func (e *Executor) postTrailingStop(stopPrice float64, i model.PortfolioInstrument) (string, string, error) {
+	// stop loss with zero indent is posted right on stop price
+	return e.sellStop(stopPrice, i, config.OrderConfig{Type: config.StopLoss})
+}
+
+// Trail re-posts stop loss of instrument when price makes new high, returns updated order and whether stop was moved.
+// Old stop is cancelled before the new one is posted, so two stops never sell the position twice:
+// failed cancel keeps the old stop and failed post is retried on the next call with the last stop price
+func (e *Executor) Trail(instrumentId string, price float64) (TrailingOrder, bool, error) {
+	e.mu.Lock()
+	o, ok := e.trailing[instrumentId]
+	e.mu.Unlock()
+	if !ok {
+		return o, false, nil
+	}
+
+	stopPrice, moved := TrailStopPrice(max(price, o.High), o.Trail, o.StopPrice, o.Instrument.MinPriceIncrement)
+	o.High = max(price, o.High)
+	if !moved && o.posted() {
+		e.storeTrailing(o)
+		return o, false, nil
+	}
+
+	if o.posted() {
+		if err := e.cancelStopOrder(o.Instrument); err != nil { // old stop is kept
+			e.storeTrailing(o)
+			return o, false, fmt.Errorf("%w: can't cancel replaced trailing stop", err)
+		}
+		o.Instrument.OrderRequestID, o.Instrument.OrderID = "", ""
+	}
+	orderRequestId, orderId, err := e.postTrailingStop(stopPrice, o.Instrument)
+	if err != nil {
+		e.storeTrailing(o)
+		return o, false, fmt.Errorf("%w: can't re-post trailing stop", err)
+	}
+	e.logger.Infof("trailing stop %s %f -> %f", instrumentId, o.StopPrice, stopPrice)
+	o.Instrument.OrderRequestID, o.Instrument.OrderID = orderRequestId, orderId
+	o.StopPrice = stopPrice
+	e.storeTrailing(o)
+
+	return o, true, nil
+}
+
+// storeTrailing updates trailing order unless it was cancelled meanwhile
+func (e *Executor) storeTrailing(o TrailingOrder) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.trailing[o.Instrument.InstrumentID]; ok {
+		e.trailing[o.Instrument.InstrumentID] = o
+	}
+}
+
+// GetTrailing returns stop losses re-posted by bot
+func (e *Executor) GetTrailing() []TrailingOrder {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	res := make([]TrailingOrder, 0, len(e.trailing))
+	for _, o := range e.trailing {
+		res = append(res, o)
+	}
+	return res
+}
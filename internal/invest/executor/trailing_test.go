@@ -0,0 +1,17 @@
+package executor
+
+import "testing"
+
+func TestTrailStopPrice(t *testing.T) {
+	if p, moved := TrailStopPrice(110, 0.1, 90, 0.1); !moved || p != 110*0.9 {
+		t.Errorf("stop must be moved to %f, got %f", 110*0.9, p)
+	}
+	// less than one tick
+	if p, moved := TrailStopPrice(100.05, 0.1, 90, 0.1); moved || p != 90 {
+		t.Errorf("stop must stay, got %f", p)
+	}
+	// stop isn't moved down
+	if p, moved := TrailStopPrice(95, 0.1, 90, 0.1); moved || p != 90 {
+		t.Errorf("stop must stay, got %f", p)
+	}
+}
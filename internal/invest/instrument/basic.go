@@ -3,13 +3,17 @@ package instrument
 import (
 	"fmt"
 
+	"github.com/STTM-NSU/trading-bot/internal/invest/broker"
 	"github.com/STTM-NSU/trading-bot/internal/model"
+	"github.com/russianinvestments/invest-api-go-sdk/investgo"
 	investapi "github.com/russianinvestments/invest-api-go-sdk/proto"
 )
 
 func (s *InstrumentsService) GetEtfs() ([]model.Instrument, error) {
-	s.rateLimiter.Take()
-	resp, err := s.instrClient.Etfs(investapi.InstrumentStatus_INSTRUMENT_STATUS_BASE)
+	resp, err := broker.Call(s.retrier, "Etfs", func() (*investgo.EtfsResponse, error) {
+		s.rateLimiter.Take()
+		return s.instrClient.Etfs(investapi.InstrumentStatus_INSTRUMENT_STATUS_BASE)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("%w: can't get currency from instrument", err)
 	}
@@ -34,6 +38,7 @@ func (s *InstrumentsService) GetEtfs() ([]model.Instrument, error) {
 			ExchangeSection:   instrument.GetExchange(),
 			InstrumentType:    model.Etf,
 			MinPriceIncrement: instrument.GetMinPriceIncrement().ToFloat(),
+			Sector:            instrument.GetSector(),
 		})
 	}
 
@@ -41,8 +46,10 @@ func (s *InstrumentsService) GetEtfs() ([]model.Instrument, error) {
 }
 
 func (s *InstrumentsService) GetShares() ([]model.Instrument, error) {
-	s.rateLimiter.Take()
-	resp, err := s.instrClient.Shares(investapi.InstrumentStatus_INSTRUMENT_STATUS_BASE)
+	resp, err := broker.Call(s.retrier, "Shares", func() (*investgo.SharesResponse, error) {
+		s.rateLimiter.Take()
+		return s.instrClient.Shares(investapi.InstrumentStatus_INSTRUMENT_STATUS_BASE)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("%w: can't get currency from instrument", err)
 	}
@@ -67,6 +74,7 @@ func (s *InstrumentsService) GetShares() ([]model.Instrument, error) {
 			ExchangeSection:   instrument.GetExchange(),
 			InstrumentType:    model.Share,
 			MinPriceIncrement: instrument.GetMinPriceIncrement().ToFloat(),
+			Sector:            instrument.GetSector(),
 		})
 	}
 
@@ -74,8 +82,10 @@ func (s *InstrumentsService) GetShares() ([]model.Instrument, error) {
 }
 
 func (s *InstrumentsService) GetBonds() ([]model.Instrument, error) {
-	s.rateLimiter.Take()
-	resp, err := s.instrClient.Bonds(investapi.InstrumentStatus_INSTRUMENT_STATUS_BASE)
+	resp, err := broker.Call(s.retrier, "Bonds", func() (*investgo.BondsResponse, error) {
+		s.rateLimiter.Take()
+		return s.instrClient.Bonds(investapi.InstrumentStatus_INSTRUMENT_STATUS_BASE)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("%w: can't get currency from instrument", err)
 	}
@@ -100,6 +110,7 @@ func (s *InstrumentsService) GetBonds() ([]model.Instrument, error) {
 			ExchangeSection:   instrument.GetExchange(),
 			InstrumentType:    model.Bond,
 			MinPriceIncrement: instrument.GetMinPriceIncrement().ToFloat(),
+			Sector:            instrument.GetSector(),
 		})
 	}
 
@@ -107,8 +118,10 @@ func (s *InstrumentsService) GetBonds() ([]model.Instrument, error) {
 }
 
 func (s *InstrumentsService) GetCurrencies() ([]model.Instrument, error) {
-	s.rateLimiter.Take()
-	resp, err := s.instrClient.Currencies(investapi.InstrumentStatus_INSTRUMENT_STATUS_BASE)
+	resp, err := broker.Call(s.retrier, "Currencies", func() (*investgo.CurrenciesResponse, error) {
+		s.rateLimiter.Take()
+		return s.instrClient.Currencies(investapi.InstrumentStatus_INSTRUMENT_STATUS_BASE)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("%w: can't get currency from instrument", err)
 	}
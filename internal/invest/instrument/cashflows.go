@@ -0,0 +1,105 @@
+package instrument
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/STTM-NSU/trading-bot/internal/invest/broker"
+	"github.com/STTM-NSU/trading-bot/internal/model"
+	"github.com/russianinvestments/invest-api-go-sdk/investgo"
+	"gopkg.in/yaml.v3"
+)
+
+func (s *InstrumentsService) GetDividends(i model.Instrument, from, to time.Time) ([]model.CashFlow, error) {
+	resp, err := broker.Call(s.retrier, "GetDividents", func() (*investgo.GetDividendsResponse, error) {
+		s.rateLimiter.Take()
+		return s.instrClient.GetDividents(i.UID, from, to)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: can't get dividends", err)
+	}
+
+	flows := make([]model.CashFlow, 0, len(resp.GetDividends()))
+	for _, d := range resp.GetDividends() {
+		if d.GetDividendType() == "Cancelled" || d.GetLastBuyDate() == nil {
+			continue
+		}
+		flows = append(flows, model.CashFlow{
+			FIGI:        i.FIGI,
+			Type:        model.Dividend,
+			Value:       d.GetDividendNet().ToFloat(),
+			LastBuyDate: d.GetLastBuyDate().AsTime(),
+			PaymentDate: d.GetPaymentDate().AsTime(),
+		})
+	}
+
+	return flows, nil
+}
+
+func (s *InstrumentsService) GetBondCoupons(i model.Instrument, from, to time.Time) ([]model.CashFlow, error) {
+	resp, err := broker.Call(s.retrier, "GetBondCoupons", func() (*investgo.GetBondCouponsResponse, error) {
+		s.rateLimiter.Take()
+		return s.instrClient.GetBondCoupons(i.UID, from, to)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: can't get bond coupons", err)
+	}
+
+	flows := make([]model.CashFlow, 0, len(resp.GetEvents()))
+	for _, c := range resp.GetEvents() {
+		recordDate := c.GetCouponDate().AsTime()
+		if c.GetFixDate() != nil {
+			recordDate = c.GetFixDate().AsTime()
+		}
+		flows = append(flows, model.CashFlow{
+			FIGI:        i.FIGI,
+			Type:        model.Coupon,
+			Value:       c.GetPayOneBond().ToFloat(),
+			LastBuyDate: recordDate.Add(-24 * time.Hour), // T+1
+			PaymentDate: c.GetCouponDate().AsTime(),
+			PeriodStart: c.GetCouponStartDate().AsTime(),
+			PeriodEnd:   c.GetCouponEndDate().AsTime(),
+		})
+	}
+
+	return flows, nil
+}
+
+// GetCashFlows returns dividends for shares and etfs and coupons for bonds
+func (s *InstrumentsService) GetCashFlows(instruments []model.Instrument, from, to time.Time) ([]model.CashFlow, error) {
+	flows := make([]model.CashFlow, 0, len(instruments))
+	for _, i := range instruments {
+		var (
+			f   []model.CashFlow
+			err error
+		)
+		switch i.InstrumentType {
+		case model.Share, model.Etf:
+			f, err = s.GetDividends(i, from, to)
+		case model.Bond:
+			f, err = s.GetBondCoupons(i, from, to)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: can't get cash flows for %s", err, i.FIGI)
+		}
+		flows = append(flows, f...)
+	}
+	return flows, nil
+}
+
+func LoadCashFlows(filename string) ([]model.CashFlow, error) {
+	input, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("%w: can't read file", err)
+	}
+
+	var flows []model.CashFlow
+	if err := yaml.Unmarshal(input, &flows); err != nil {
+		return nil, fmt.Errorf("%w: can't unmarshal cash flows", err)
+	}
+
+	return flows, nil
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/STTM-NSU/trading-bot/internal/config"
+	"github.com/STTM-NSU/trading-bot/internal/invest/broker"
 	"github.com/STTM-NSU/trading-bot/internal/logger"
 	"github.com/STTM-NSU/trading-bot/internal/model"
 	"github.com/russianinvestments/invest-api-go-sdk/investgo"
@@ -21,15 +22,17 @@ var (
 type InstrumentsService struct {
 	instrClient *investgo.InstrumentsServiceClient
 	rateLimiter ratelimit.Limiter
+	retrier     *broker.Retrier
 	logger      logger.Logger
 
 	queriesInstrumentsCache map[string]*model.Instrument
 }
 
-func NewInstrumentsService(client *investgo.Client, logger logger.Logger) *InstrumentsService {
+func NewInstrumentsService(client *investgo.Client, retrier *broker.Retrier, logger logger.Logger) *InstrumentsService {
 	return &InstrumentsService{
 		instrClient:             client.NewInstrumentsServiceClient(),
 		rateLimiter:             ratelimit.New(200, ratelimit.Per(1*time.Minute)),
+		retrier:                 retrier,
 		logger:                  logger,
 		queriesInstrumentsCache: make(map[string]*model.Instrument),
 	}
@@ -65,8 +68,10 @@ func (s *InstrumentsService) GetInstrument(query string) (*model.Instrument, err
 		return v, nil
 	}
 
-	s.rateLimiter.Take()
-	resp, err := s.instrClient.FindInstrument(query)
+	resp, err := broker.Call(s.retrier, "FindInstrument", func() (*investgo.FindInstrumentResponse, error) {
+		s.rateLimiter.Take()
+		return s.instrClient.FindInstrument(query)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("%w: can't get instrument", err)
 	}
@@ -178,8 +183,10 @@ func (s *InstrumentsService) UpdateInstrumentInfo(instrument model.Instrument) (
 }
 
 func (s *InstrumentsService) GetInstrumentInfo(figi string) (*investapi.Instrument, error) {
-	s.rateLimiter.Take()
-	resp, err := s.instrClient.InstrumentByFigi(figi)
+	resp, err := broker.Call(s.retrier, "InstrumentByFigi", func() (*investgo.InstrumentResponse, error) {
+		s.rateLimiter.Take()
+		return s.instrClient.InstrumentByFigi(figi)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("%w: can't get instrument by figi", err)
 	}
@@ -188,8 +195,8 @@ func (s *InstrumentsService) GetInstrumentInfo(figi string) (*investapi.Instrume
 }
 
 func (s *InstrumentsService) GetInstrumentTradingSchedule(i model.Instrument, from, to time.Time) ([]model.TradingSchedule, error) {
-	if time.Now().UTC().After(from) {
-		return nil, fmt.Errorf("from is in the future")
+	if !to.After(from) {
+		return nil, fmt.Errorf("to must be after from")
 	}
 	if to.Sub(from) >= 7*24*time.Hour {
 		return nil, fmt.Errorf("interval must be at least 7 days")
@@ -198,8 +205,10 @@ func (s *InstrumentsService) GetInstrumentTradingSchedule(i model.Instrument, fr
 		return nil, fmt.Errorf("instrument doesn't have an exchange section")
 	}
 
-	s.rateLimiter.Take()
-	resp, err := s.instrClient.TradingSchedules(i.ExchangeSection, from, to)
+	resp, err := broker.Call(s.retrier, "TradingSchedules", func() (*investgo.TradingSchedulesResponse, error) {
+		s.rateLimiter.Take()
+		return s.instrClient.TradingSchedules(i.ExchangeSection, from, to)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("%w: can't get trading schedules", err)
 	}
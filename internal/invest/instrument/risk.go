@@ -0,0 +1,55 @@
+package instrument
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/STTM-NSU/trading-bot/internal/model"
+	"gopkg.in/yaml.v3"
+)
+
+func (s *InstrumentsService) GetRiskRates(i model.Instrument) (model.RiskRates, error) {
+	info, err := s.GetInstrumentInfo(i.FIGI)
+	if err != nil {
+		return model.RiskRates{}, fmt.Errorf("%w: can't get info for figi", err)
+	}
+
+	return model.RiskRates{
+		Klong:        info.GetKlong().ToFloat(),
+		Kshort:       info.GetKshort().ToFloat(),
+		Dlong:        info.GetDlong().ToFloat(),
+		Dshort:       info.GetDshort().ToFloat(),
+		DlongMin:     info.GetDlongMin().ToFloat(),
+		DshortMin:    info.GetDshortMin().ToFloat(),
+		ShortEnabled: info.GetShortEnabledFlag(),
+	}, nil
+}
+
+// GetInstrumentsRiskRates returns risk rates by figi, instruments with errors are skipped
+func (s *InstrumentsService) GetInstrumentsRiskRates(instruments []model.Instrument) map[string]model.RiskRates {
+	rates := make(map[string]model.RiskRates, len(instruments))
+	for _, i := range instruments {
+		r, err := s.GetRiskRates(i)
+		if err != nil {
+			s.logger.Warnf("%s: can't get risk rates for %s", err, i.FIGI)
+			continue
+		}
+		rates[i.FIGI] = r
+	}
+	return rates
+}
+
+// LoadRiskRates loads yaml file with risk rates by figi
+func LoadRiskRates(filename string) (map[string]model.RiskRates, error) {
+	input, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("%w: can't read file", err)
+	}
+
+	var rates map[string]model.RiskRates
+	if err := yaml.Unmarshal(input, &rates); err != nil {
+		return nil, fmt.Errorf("%w: can't unmarshal risk rates", err)
+	}
+
+	return rates, nil
+}
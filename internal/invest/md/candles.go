@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/STTM-NSU/trading-bot/internal/invest/broker"
 	"github.com/STTM-NSU/trading-bot/internal/logger"
 	"github.com/STTM-NSU/trading-bot/internal/model"
 	"github.com/jmoiron/sqlx"
@@ -17,16 +18,19 @@ type CandlesService struct {
 	logger logger.Logger
 
 	rateLimiter ratelimit.Limiter // 600 T/M но мы сделаем меньше
+	retrier     *broker.Retrier
 
 	mdService          *investgo.MarketDataServiceClient
 	lastPriceCache     map[string]float64
 	lastPriceDateCache map[string]time.Time
+	corporateActions   map[string][]model.CorporateAction // instrument id -> actions sorted by ts
 }
 
-func NewCandlesService(c *investgo.Client, db *sqlx.DB, logger logger.Logger) *CandlesService {
+func NewCandlesService(c *investgo.Client, db *sqlx.DB, retrier *broker.Retrier, logger logger.Logger) *CandlesService {
 	return &CandlesService{
 		mdService:          c.NewMarketDataServiceClient(),
 		rateLimiter:        ratelimit.New(500, ratelimit.Per(1*time.Minute)),
+		retrier:            retrier,
 		db:                 db,
 		logger:             logger,
 		lastPriceCache:     make(map[string]float64),
@@ -97,9 +101,30 @@ func (s *CandlesService) GetLastPriceOn(instrumentId string, from time.Time) (fl
 	return lastCandle, nil
 }
 
+// GetCandleOn returns hour candle with volume on from, volume is zero if unknown
+func (s *CandlesService) GetCandleOn(instrumentId string, from time.Time) (model.Candle, error) {
+	candles, err := s.GetCandlesWithVolumeFromDB(instrumentId, from, from.Add(1*time.Hour))
+	if err != nil || len(candles) == 0 {
+		candles, err = s.GetCandlesFor(instrumentId, from.Add(-1*time.Hour), from.Add(1*time.Hour))
+		if err != nil {
+			return model.Candle{}, err
+		}
+	}
+
+	for _, candle := range candles {
+		if candle.Ts.Equal(from) {
+			return candle, nil
+		}
+	}
+
+	return model.Candle{}, fmt.Errorf("no candle %s %s", instrumentId, from)
+}
+
 func (s *CandlesService) GetLastPrice(instrumentId string) (float64, error) {
-	s.rateLimiter.Take()
-	resp, err := s.mdService.GetLastPrices([]string{instrumentId})
+	resp, err := broker.Call(s.retrier, "GetLastPrices", func() (*investgo.GetLastPricesResponse, error) {
+		s.rateLimiter.Take()
+		return s.mdService.GetLastPrices([]string{instrumentId})
+	})
 	if err != nil {
 		return 0, fmt.Errorf("can't get last price: %w", err)
 	}
@@ -122,8 +147,10 @@ func (s *CandlesService) GetCandlesFor(instrumentId string, from, to time.Time)
 		return dbCandles, nil
 	}
 
-	s.rateLimiter.Take()
-	resp, err := s.mdService.GetCandles(instrumentId, investapi.CandleInterval_CANDLE_INTERVAL_HOUR, from, to, 0, 0)
+	resp, err := broker.Call(s.retrier, "GetCandles", func() (*investgo.GetCandlesResponse, error) {
+		s.rateLimiter.Take()
+		return s.mdService.GetCandles(instrumentId, investapi.CandleInterval_CANDLE_INTERVAL_HOUR, from, to, 0, 0)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("can't get candles from api: %w", err)
 	}
@@ -137,6 +164,7 @@ func (s *CandlesService) GetCandlesFor(instrumentId string, from, to time.Time)
 		candlesApi[i] = model.Candle{
 			Ts:         item.GetTime().AsTime(),
 			ClosePrice: item.GetClose().ToFloat(),
+			Volume:     float64(item.GetVolume()),
 		}
 	}
 
@@ -0,0 +1,94 @@
+package md
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/STTM-NSU/trading-bot/internal/model"
+)
+
+const (
+	// corporate_actions (instrument_id text, type text, ts timestamp, ratio double precision)
+	_queryCorporateActions = "SELECT instrument_id, type, ts, ratio FROM corporate_actions ORDER BY ts"
+)
+
+func (s *CandlesService) loadCorporateActions() error {
+	if s.corporateActions != nil {
+		return nil
+	}
+
+	var actions []model.CorporateAction
+	if err := s.db.Select(&actions, _queryCorporateActions); err != nil {
+		return fmt.Errorf("get corporate actions from database: %w", err)
+	}
+
+	// cached only on success, so failed query is retried on next call
+	corporateActions := make(map[string][]model.CorporateAction)
+	for _, a := range actions {
+		if a.Ratio <= 0 {
+			s.logger.Warnf("invalid corporate action ratio %f for %s", a.Ratio, a.InstrumentID)
+			continue
+		}
+		corporateActions[a.InstrumentID] = append(corporateActions[a.InstrumentID], a)
+	}
+	s.corporateActions = corporateActions
+	return nil
+}
+
+// GetCorporateActions returns actions for all instruments that take effect in (from, to]
+func (s *CandlesService) GetCorporateActions(from, to time.Time) ([]model.CorporateAction, error) {
+	if err := s.loadCorporateActions(); err != nil {
+		return nil, err
+	}
+
+	var res []model.CorporateAction
+	for _, actions := range s.corporateActions {
+		for _, a := range actions {
+			if a.Ts.After(from) && !a.Ts.After(to) {
+				res = append(res, a)
+			}
+		}
+	}
+	slices.SortFunc(res, func(a, b model.CorporateAction) int {
+		return a.Ts.Compare(b.Ts)
+	})
+	return res, nil
+}
+
+// AdjustCandles returns candles with prices and volumes adjusted to the securities existing on to:
+// candles before action have prices divided by ratio and volumes multiplied by it
+func AdjustCandles(candles []model.Candle, actions []model.CorporateAction, to time.Time) []model.Candle {
+	adjusted := make([]model.Candle, len(candles))
+	for i, c := range candles {
+		for _, a := range actions {
+			if c.Ts.Before(a.Ts) && !a.Ts.After(to) {
+				c.ClosePrice /= a.Ratio
+				c.Volume *= a.Ratio
+			}
+		}
+		adjusted[i] = c
+	}
+	return adjusted
+}
+
+// GetAdjustedCandlesFor returns split-adjusted candles for signals and indicators,
+// fills must be simulated on raw prices from GetCandlesFor
+func (s *CandlesService) GetAdjustedCandlesFor(instrumentId string, from, to time.Time) ([]model.Candle, error) {
+	candles, err := s.GetCandlesFor(instrumentId, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.loadCorporateActions(); err != nil {
+		s.logger.Errorf("can't adjust candles: %s", err)
+		return candles, nil
+	}
+
+	actions := s.corporateActions[instrumentId]
+	if len(actions) == 0 {
+		return candles, nil
+	}
+
+	return AdjustCandles(candles, actions, to), nil
+}
@@ -0,0 +1,36 @@
+package md
+
+import (
+	"testing"
+	"time"
+
+	"github.com/STTM-NSU/trading-bot/internal/model"
+)
+
+func TestAdjustCandles(t *testing.T) {
+	ts := time.Date(2024, 7, 1, 10, 0, 0, 0, time.UTC)
+	candles := []model.Candle{
+		{Ts: ts.Add(-2 * time.Hour), ClosePrice: 1000, Volume: 10},
+		{Ts: ts.Add(-1 * time.Hour), ClosePrice: 1010, Volume: 20},
+		{Ts: ts, ClosePrice: 101, Volume: 300},
+	}
+	actions := []model.CorporateAction{{InstrumentID: "a", Type: model.Split, Ts: ts, Ratio: 10}}
+
+	adjusted := AdjustCandles(candles, actions, ts)
+	expected := []model.Candle{
+		{Ts: ts.Add(-2 * time.Hour), ClosePrice: 100, Volume: 100},
+		{Ts: ts.Add(-1 * time.Hour), ClosePrice: 101, Volume: 200},
+		{Ts: ts, ClosePrice: 101, Volume: 300},
+	}
+	for i := range expected {
+		if adjusted[i] != expected[i] {
+			t.Errorf("candle %d: expected %v, got %v", i, expected[i], adjusted[i])
+		}
+	}
+
+	// action after window end doesn't change prices
+	adjusted = AdjustCandles(candles, actions, ts.Add(-time.Hour))
+	if adjusted[0] != candles[0] {
+		t.Errorf("expected raw candle, got %v", adjusted[0])
+	}
+}
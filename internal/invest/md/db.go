@@ -7,10 +7,19 @@ import (
 	"time"
 
 	"github.com/STTM-NSU/trading-bot/internal/model"
+	"github.com/lib/pq"
 )
 
 const (
-	_queryStocks = "SELECT ts, close_price FROM stocks WHERE ts BETWEEN $1::timestamp AND $2::timestamp AND instrument_id = $3 ORDER BY ts DESC"
+	_queryStocks           = "SELECT ts, close_price FROM stocks WHERE ts BETWEEN $1::timestamp AND $2::timestamp AND instrument_id = $3 ORDER BY ts DESC"
+	_queryStocksWithVolume = "SELECT ts, close_price, volume FROM stocks WHERE ts BETWEEN $1::timestamp AND $2::timestamp AND instrument_id = $3 ORDER BY ts DESC"
+	_queryLastPrices       = `SELECT DISTINCT ON (instrument_id) instrument_id, close_price FROM stocks
+								WHERE ts BETWEEN $1::timestamp AND $2::timestamp AND instrument_id = ANY($3)
+								ORDER BY instrument_id, ts DESC`
+)
+
+const (
+	_lastPricesLookback = 7 * 24 * time.Hour
 )
 
 func (s *CandlesService) GetCandlesFromDB(instrumentId string, from, to time.Time) ([]model.Candle, error) {
@@ -23,3 +32,34 @@ func (s *CandlesService) GetCandlesFromDB(instrumentId string, from, to time.Tim
 	}
 	return candles, nil
 }
+
+func (s *CandlesService) GetCandlesWithVolumeFromDB(instrumentId string, from, to time.Time) ([]model.Candle, error) {
+	var candles []model.Candle
+	if err := s.db.Select(&candles, _queryStocksWithVolume, from, to, instrumentId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get candles with volume from database: %w", err)
+	}
+	return candles, nil
+}
+
+// GetLastPricesOnDB returns last close prices on from for all instruments with one query
+func (s *CandlesService) GetLastPricesOnDB(from time.Time, instrumentIds ...string) (map[string]float64, error) {
+	var rows []struct {
+		InstrumentID string  `db:"instrument_id"`
+		ClosePrice   float64 `db:"close_price"`
+	}
+	if err := s.db.Select(&rows, _queryLastPrices, from.Add(-_lastPricesLookback), from, pq.Array(instrumentIds)); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get last prices from database: %w", err)
+	}
+
+	prices := make(map[string]float64, len(rows))
+	for _, r := range rows {
+		prices[r.InstrumentID] = r.ClosePrice
+	}
+	return prices, nil
+}
@@ -0,0 +1,57 @@
+package md
+
+import (
+	"fmt"
+
+	"github.com/STTM-NSU/trading-bot/internal/invest/broker"
+	"github.com/STTM-NSU/trading-bot/internal/model"
+	"github.com/russianinvestments/invest-api-go-sdk/investgo"
+	investapi "github.com/russianinvestments/invest-api-go-sdk/proto"
+)
+
+func (s *CandlesService) GetOrderBook(instrumentId string, depth int32) (model.OrderBook, error) {
+	resp, err := broker.Call(s.retrier, "GetOrderBook", func() (*investgo.GetOrderBookResponse, error) {
+		s.rateLimiter.Take()
+		return s.mdService.GetOrderBook(instrumentId, depth)
+	})
+	if err != nil {
+		return model.OrderBook{}, fmt.Errorf("%w: can't get order book", err)
+	}
+
+	return model.OrderBook{
+		Bids: toOrderBookLevels(resp.GetBids()),
+		Asks: toOrderBookLevels(resp.GetAsks()),
+		Ts:   resp.GetOrderbookTs().AsTime(),
+
+		LimitUp:   resp.GetLimitUp().ToFloat(),
+		LimitDown: resp.GetLimitDown().ToFloat(),
+	}, nil
+}
+
+func (s *CandlesService) GetTradingStatus(instrumentId string) (model.TradingStatus, error) {
+	resp, err := broker.Call(s.retrier, "GetTradingStatus", func() (*investgo.GetTradingStatusResponse, error) {
+		s.rateLimiter.Take()
+		return s.mdService.GetTradingStatus(instrumentId)
+	})
+	if err != nil {
+		return model.TradingStatus{}, fmt.Errorf("%w: can't get trading status", err)
+	}
+
+	return model.TradingStatus{
+		NormalTrading:        resp.GetTradingStatus() == investapi.SecurityTradingStatus_SECURITY_TRADING_STATUS_NORMAL_TRADING,
+		APITradeAvailable:    resp.GetApiTradeAvailableFlag(),
+		LimitOrderAvailable:  resp.GetLimitOrderAvailableFlag(),
+		MarketOrderAvailable: resp.GetMarketOrderAvailableFlag(),
+	}, nil
+}
+
+func toOrderBookLevels(orders []*investapi.Order) []model.OrderBookLevel {
+	levels := make([]model.OrderBookLevel, 0, len(orders))
+	for _, o := range orders {
+		levels = append(levels, model.OrderBookLevel{
+			Price:    o.GetPrice().ToFloat(),
+			Quantity: float64(o.GetQuantity()),
+		})
+	}
+	return levels
+}
@@ -0,0 +1,224 @@
+package md
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/STTM-NSU/trading-bot/internal/logger"
+	"github.com/STTM-NSU/trading-bot/internal/model"
+	"github.com/russianinvestments/invest-api-go-sdk/investgo"
+	investapi "github.com/russianinvestments/invest-api-go-sdk/proto"
+)
+
+const (
+	_streamStaleAfter     = 1 * time.Minute // no messages from stream -> prices are requested by unary calls
+	_streamReconnectDelay = 5 * time.Second
+)
+
+// StreamManager keeps the latest prices and hour candles from market data stream
+// for subscribed instruments, stream is recreated with all subscriptions on errors
+type StreamManager struct {
+	streamClient   *investgo.MarketDataStreamClient
+	candlesService *CandlesService // for unary calls when stream is stale
+	logger         logger.Logger
+
+	mu          sync.RWMutex
+	ids         map[string]struct{}
+	prices      map[string]float64      // figi and instrument uid -> price
+	candles     map[string]model.Candle // figi and instrument uid -> the latest hour candle
+	lastMessage time.Time
+
+	subscribe chan []string
+}
+
+func NewStreamManager(c *investgo.Client, candlesService *CandlesService, logger logger.Logger) *StreamManager {
+	return &StreamManager{
+		streamClient:   c.NewMarketDataStreamClient(),
+		candlesService: candlesService,
+		logger:         logger,
+		ids:            make(map[string]struct{}),
+		prices:         make(map[string]float64),
+		candles:        make(map[string]model.Candle),
+		subscribe:      make(chan []string, 10),
+	}
+}
+
+// Subscribe adds instruments to stream subscriptions, e.g. portfolio and universe instruments
+func (s *StreamManager) Subscribe(instrumentIds ...string) {
+	s.mu.Lock()
+	added := make([]string, 0, len(instrumentIds))
+	for _, id := range instrumentIds {
+		if _, ok := s.ids[id]; !ok {
+			s.ids[id] = struct{}{}
+			added = append(added, id)
+		}
+	}
+	s.mu.Unlock()
+
+	if len(added) == 0 {
+		return
+	}
+	select {
+	case s.subscribe <- added:
+	default: // stream is reconnecting and will subscribe on all ids
+	}
+}
+
+// Run listens stream until ctx is done and reconnects on errors
+func (s *StreamManager) Run(ctx context.Context) {
+	for {
+		if err := s.listen(ctx); err != nil {
+			s.logger.Errorf("%s: market data stream failed, reconnecting", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(_streamReconnectDelay):
+		}
+	}
+}
+
+func (s *StreamManager) listen(ctx context.Context) error {
+	stream, err := s.streamClient.MarketDataStream()
+	if err != nil {
+		return fmt.Errorf("%w: can't create market data stream", err)
+	}
+
+	var wg sync.WaitGroup
+	errCh := make(chan error, 1)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		errCh <- stream.Listen()
+	}()
+	defer func() {
+		stream.Stop()
+		wg.Wait()
+	}()
+
+	s.mu.RLock()
+	ids := slices.Collect(maps.Keys(s.ids))
+	s.mu.RUnlock()
+
+	lastPrices, candles, err := s.subscribeAll(stream, ids)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-errCh:
+			if err == nil {
+				return fmt.Errorf("market data stream closed")
+			}
+			return err
+		case added := <-s.subscribe:
+			if lastPrices, candles, err = s.subscribeAll(stream, added); err != nil {
+				return err
+			}
+		case p, ok := <-lastPrices:
+			if !ok {
+				lastPrices = nil
+				continue
+			}
+			s.setPrice(p.GetPrice().ToFloat(), p.GetFigi(), p.GetInstrumentUid())
+		case c, ok := <-candles:
+			if !ok {
+				candles = nil
+				continue
+			}
+			s.setCandle(model.Candle{
+				Ts:         c.GetTime().AsTime(),
+				ClosePrice: c.GetClose().ToFloat(),
+				Volume:     float64(c.GetVolume()),
+			}, c.GetFigi(), c.GetInstrumentUid())
+		}
+	}
+}
+
+// subscribeAll subscribes on last prices and hour candles, all subscriptions share the same channels
+func (s *StreamManager) subscribeAll(stream *investgo.MarketDataStream, ids []string) (<-chan *investapi.LastPrice, <-chan *investapi.Candle, error) {
+	if len(ids) == 0 {
+		return nil, nil, nil
+	}
+	lastPrices, err := stream.SubscribeLastPrice(ids)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: can't subscribe on last prices", err)
+	}
+	candles, err := stream.SubscribeCandle(ids, investapi.SubscriptionInterval_SUBSCRIPTION_INTERVAL_ONE_HOUR, false, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: can't subscribe on candles", err)
+	}
+	return lastPrices, candles, nil
+}
+
+func (s *StreamManager) setPrice(price float64, ids ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastMessage = time.Now()
+	for _, id := range ids {
+		if id != "" {
+			s.prices[id] = price
+		}
+	}
+}
+
+func (s *StreamManager) setCandle(c model.Candle, ids ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastMessage = time.Now()
+	for _, id := range ids {
+		if id != "" {
+			s.candles[id] = c
+			s.prices[id] = c.ClosePrice
+		}
+	}
+}
+
+// Stale reports whether there were no messages from stream for a while
+func (s *StreamManager) Stale() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return time.Since(s.lastMessage) > _streamStaleAfter
+}
+
+// GetLastPrice returns price from stream, unary call is used if stream is stale or has no price for instrument
+func (s *StreamManager) GetLastPrice(instrumentId string) (float64, error) {
+	if !s.Stale() {
+		s.mu.RLock()
+		price, ok := s.prices[instrumentId]
+		s.mu.RUnlock()
+		if ok {
+			return price, nil
+		}
+	}
+
+	price, err := s.candlesService.GetLastPrice(instrumentId)
+	if err != nil {
+		return 0, fmt.Errorf("%w: can't get last price by unary call", err)
+	}
+	return price, nil
+}
+
+// GetLastPriceOn ignores requested time, so stream can be used as strategy market data
+func (s *StreamManager) GetLastPriceOn(instrumentId string, _ time.Time) (float64, error) {
+	return s.GetLastPrice(instrumentId)
+}
+
+// GetCandle returns the latest hour candle from stream
+func (s *StreamManager) GetCandle(instrumentId string) (model.Candle, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, ok := s.candles[instrumentId]
+	if !ok {
+		return model.Candle{}, fmt.Errorf("no candle in stream for %s", instrumentId)
+	}
+	return c, nil
+}
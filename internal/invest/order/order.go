@@ -1,4 +1,102 @@
 package order
 
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/STTM-NSU/trading-bot/internal/logger"
+	"github.com/STTM-NSU/trading-bot/internal/model"
+	"github.com/russianinvestments/invest-api-go-sdk/investgo"
+	investapi "github.com/russianinvestments/invest-api-go-sdk/proto"
+)
+
+const (
+	_streamPingDelayMs    = 10_000
+	_streamReconnectDelay = 5 * time.Second
+)
+
+// OrdersService listens order state stream of account and passes order states to handler
 type OrdersService struct {
+	streamClient *investgo.OrdersStreamClient
+
+	accountID string
+	logger    logger.Logger
+}
+
+func NewOrdersService(c *investgo.Client, accountID string, logger logger.Logger) *OrdersService {
+	return &OrdersService{
+		streamClient: c.NewOrdersStreamClient(),
+		accountID:    accountID,
+		logger:       logger,
+	}
+}
+
+// Run listens stream until ctx is done and reconnects on errors
+func (s *OrdersService) Run(ctx context.Context, handler func(model.OrderState)) {
+	for {
+		if err := s.listen(ctx, handler); err != nil {
+			s.logger.Errorf("%s: order state stream failed, reconnecting", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(_streamReconnectDelay):
+		}
+	}
+}
+
+func (s *OrdersService) listen(ctx context.Context, handler func(model.OrderState)) error {
+	stream, err := s.streamClient.OrderStateStream([]string{s.accountID}, _streamPingDelayMs)
+	if err != nil {
+		return fmt.Errorf("%w: can't create order state stream", err)
+	}
+
+	var wg sync.WaitGroup
+	errCh := make(chan error, 1)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		errCh <- stream.Listen()
+	}()
+	defer func() {
+		stream.Stop()
+		wg.Wait()
+	}()
+
+	states := stream.OrderState()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-errCh:
+			if err == nil {
+				return fmt.Errorf("order state stream closed")
+			}
+			return err
+		case v, ok := <-states:
+			if !ok {
+				states = nil
+				continue
+			}
+			handler(ToOrderState(v))
+		}
+	}
+}
+
+func ToOrderState(v *investapi.OrderStateStreamResponse_OrderState) model.OrderState {
+	status := v.GetExecutionReportStatus()
+	return model.OrderState{
+		OrderID:        v.GetOrderId(),
+		OrderRequestID: v.GetOrderRequestId(),
+		InstrumentID:   v.GetInstrumentUid(),
+		Buy:            v.GetDirection() == investapi.OrderDirection_ORDER_DIRECTION_BUY,
+		LotsExecuted:   float64(v.GetLotsExecuted()),
+		LotsLeft:       float64(v.GetLotsLeft()),
+		ExecutedPrice:  v.GetExecutedOrderPrice().ToFloat(),
+		Done: status == investapi.OrderExecutionReportStatus_EXECUTION_REPORT_STATUS_FILL ||
+			status == investapi.OrderExecutionReportStatus_EXECUTION_REPORT_STATUS_REJECTED ||
+			status == investapi.OrderExecutionReportStatus_EXECUTION_REPORT_STATUS_CANCELLED,
+	}
 }
@@ -0,0 +1,91 @@
+package techan
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/STTM-NSU/trading-bot/internal/config"
+	"github.com/STTM-NSU/trading-bot/internal/model"
+)
+
+// warmUp is number of indicator lengths loaded before check, so ema and rsi smoothing forget their seed
+const warmUp = 4
+
+type AdjustedCandles interface {
+	GetAdjustedCandlesFor(instrumentId string, from, to time.Time) ([]model.Candle, error)
+}
+
+// AdjustedAnalyseService calculates indicators on split-adjusted hour candles instead of broker tech analysis,
+// which is calculated on raw prices, so splits don't look like crash in backtest
+type AdjustedAnalyseService struct {
+	candles AdjustedCandles
+	cfg     config.TechnicalIndicatorsConfig
+}
+
+func NewAdjustedAnalyseService(candles AdjustedCandles, cfg config.TechnicalIndicatorsConfig) *AdjustedAnalyseService {
+	return &AdjustedAnalyseService{
+		candles: candles,
+		cfg:     cfg,
+	}
+}
+
+// closes returns closes of unit intervals up to from, false if there is no candle on from
+func (t *AdjustedAnalyseService) closes(figi string, from time.Time, unit time.Duration, length float64) ([]float64, bool, error) {
+	candles, err := t.candles.GetAdjustedCandlesFor(figi, from.Add(-time.Duration(warmUp*length)*unit).UTC(), from.Add(1*time.Hour).UTC())
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: can't get adjusted candles", err)
+	}
+
+	k := len(candles)
+	for k > 0 && candles[k-1].Ts.After(from) {
+		k--
+	}
+	if k == 0 || !candles[k-1].Ts.Truncate(1*time.Hour).Equal(from) {
+		return nil, false, nil
+	}
+	return Closes(candles[:k], unit), true, nil
+}
+
+func (t *AdjustedAnalyseService) GetRSIBBSignal(i model.PortfolioInstrument, price float64, from time.Time) (bool, error) {
+	closes, ok, err := t.closes(i.FIGI, from, t.cfg.RSI.TimeUnit, t.cfg.RSI.Length)
+	if err != nil || !ok {
+		return false, err
+	}
+	rsi, ok := RSI(closes, int(t.cfg.RSI.Length))
+	if !ok {
+		return false, nil
+	}
+
+	closes, ok, err = t.closes(i.FIGI, from, t.cfg.BollingerBands.TimeUnit, t.cfg.BollingerBands.Length)
+	if err != nil || !ok {
+		return false, err
+	}
+	bbL, bbU, ok := BollingerBands(closes, int(t.cfg.BollingerBands.Length), t.cfg.BollingerBands.Deviation)
+	if !ok {
+		return false, nil
+	}
+
+	return rsiBBSignal(t.cfg, rsi, bbL, bbU, price), nil
+}
+
+func (t *AdjustedAnalyseService) GetEMAMACDSignal(i model.PortfolioInstrument, _ float64, from time.Time) (bool, error) {
+	closes, ok, err := t.closes(i.FIGI, from, t.cfg.EMA.TimeUnit, t.cfg.EMA.SlowLength)
+	if err != nil || !ok {
+		return false, err
+	}
+	emaSlow, emaFast := EMA(closes, int(t.cfg.EMA.SlowLength)), EMA(closes, int(t.cfg.EMA.FastLength))
+	if len(emaSlow) == 0 || len(emaFast) == 0 {
+		return false, nil
+	}
+
+	closes, ok, err = t.closes(i.FIGI, from, t.cfg.MACD.TimeUnit, t.cfg.MACD.SlowLength)
+	if err != nil || !ok {
+		return false, err
+	}
+	macd, ok := MACD(closes, int(t.cfg.MACD.FastLength), int(t.cfg.MACD.SlowLength))
+	if !ok {
+		return false, nil
+	}
+
+	return emaMACDSignal(emaSlow[len(emaSlow)-1], emaFast[len(emaFast)-1], macd), nil
+}
@@ -0,0 +1,99 @@
+package techan
+
+import (
+	"math"
+	"time"
+
+	"github.com/STTM-NSU/trading-bot/internal/model"
+)
+
+// Closes returns close price of the last candle of every unit interval, candles must be sorted by ts
+func Closes(candles []model.Candle, unit time.Duration) []float64 {
+	closes := make([]float64, 0, len(candles))
+	var last time.Time
+	for _, c := range candles {
+		ts := c.Ts.Truncate(unit)
+		if len(closes) > 0 && ts.Equal(last) {
+			closes[len(closes)-1] = c.ClosePrice
+			continue
+		}
+		closes = append(closes, c.ClosePrice)
+		last = ts
+	}
+	return closes
+}
+
+// EMA returns exponential moving average series seeded by simple average of the first length values,
+// series is empty if there are less values than length
+func EMA(values []float64, length int) []float64 {
+	if length <= 0 || len(values) < length {
+		return nil
+	}
+
+	var sum float64
+	for _, v := range values[:length] {
+		sum += v
+	}
+	ema := make([]float64, 0, len(values)-length+1)
+	ema = append(ema, sum/float64(length))
+
+	k := 2 / float64(length+1)
+	for _, v := range values[length:] {
+		ema = append(ema, v*k+ema[len(ema)-1]*(1-k))
+	}
+	return ema
+}
+
+// RSI returns the last value of relative strength index with Wilder smoothing
+func RSI(values []float64, length int) (float64, bool) {
+	if length <= 0 || len(values) <= length {
+		return 0, false
+	}
+
+	var gain, loss float64
+	for i := 1; i <= length; i++ {
+		gain += max(values[i]-values[i-1], 0)
+		loss += max(values[i-1]-values[i], 0)
+	}
+	gain, loss = gain/float64(length), loss/float64(length)
+	for i := length + 1; i < len(values); i++ {
+		gain = (gain*float64(length-1) + max(values[i]-values[i-1], 0)) / float64(length)
+		loss = (loss*float64(length-1) + max(values[i-1]-values[i], 0)) / float64(length)
+	}
+
+	if loss == 0 {
+		return 100, true
+	}
+	return 100 - 100/(1+gain/loss), true
+}
+
+// BollingerBands returns lower and upper bands of the last length values
+func BollingerBands(values []float64, length int, deviation float64) (float64, float64, bool) {
+	if length <= 0 || len(values) < length {
+		return 0, 0, false
+	}
+
+	window := values[len(values)-length:]
+	var mean float64
+	for _, v := range window {
+		mean += v
+	}
+	mean /= float64(length)
+
+	var variance float64
+	for _, v := range window {
+		variance += (v - mean) * (v - mean)
+	}
+	std := math.Sqrt(variance / float64(length))
+
+	return mean - deviation*std, mean + deviation*std, true
+}
+
+// MACD returns the last value of difference between fast and slow ema
+func MACD(values []float64, fast, slow int) (float64, bool) {
+	fastEMA, slowEMA := EMA(values, fast), EMA(values, slow)
+	if len(fastEMA) == 0 || len(slowEMA) == 0 {
+		return 0, false
+	}
+	return fastEMA[len(fastEMA)-1] - slowEMA[len(slowEMA)-1], true
+}
@@ -0,0 +1,44 @@
+package techan
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/STTM-NSU/trading-bot/internal/model"
+)
+
+func TestCloses(t *testing.T) {
+	day := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	candles := []model.Candle{
+		{Ts: day.Add(10 * time.Hour), ClosePrice: 1},
+		{Ts: day.Add(11 * time.Hour), ClosePrice: 2},
+		{Ts: day.Add(34 * time.Hour), ClosePrice: 3},
+	}
+	closes := Closes(candles, 24*time.Hour)
+	if len(closes) != 2 || closes[0] != 2 || closes[1] != 3 {
+		t.Errorf("unexpected daily closes %v", closes)
+	}
+}
+
+func TestIndicators(t *testing.T) {
+	if ema := EMA([]float64{1, 2, 3, 4}, 3); len(ema) != 2 || ema[0] != 2 || ema[1] != 3 {
+		t.Errorf("unexpected ema %v", ema)
+	}
+
+	if rsi, ok := RSI([]float64{1, 2, 3, 4}, 3); !ok || rsi != 100 {
+		t.Errorf("unexpected rsi of growth %f", rsi)
+	}
+	if rsi, ok := RSI([]float64{1, 2, 1, 2, 1}, 2); !ok || math.Abs(rsi-37.5) > 1e-9 {
+		t.Errorf("unexpected rsi %f", rsi)
+	}
+
+	lower, upper, ok := BollingerBands([]float64{5, 1, 3}, 2, 2)
+	if !ok || lower != 0 || upper != 4 {
+		t.Errorf("unexpected bands %f %f", lower, upper)
+	}
+
+	if _, ok := MACD([]float64{1, 2}, 2, 3); ok {
+		t.Errorf("macd without enough values")
+	}
+}
@@ -1,9 +1,29 @@
 package techan
 
-import "time"
+import (
+	"time"
 
-func (t *TechAnalyseService) GetRSIBBSignal(instrumentId string, price float64, from time.Time) (bool, error) {
-	rsiResp, err := t.GetRSI(instrumentId, from.UTC(), from.Add(1*time.Hour).UTC())
+	"github.com/STTM-NSU/trading-bot/internal/config"
+	"github.com/STTM-NSU/trading-bot/internal/model"
+)
+
+func rsiBBSignal(cfg config.TechnicalIndicatorsConfig, rsi, bbL, bbU, price float64) bool {
+	if rsi > cfg.RSI.UpperBound && price > bbU {
+		return true
+	}
+	if rsi < cfg.RSI.LowerBound && price < bbL {
+		return false
+	}
+
+	return false
+}
+
+func emaMACDSignal(emaSlow, emaFast, macd float64) bool {
+	return emaSlow > emaFast && macd < 0
+}
+
+func (t *TechAnalyseService) GetRSIBBSignal(i model.PortfolioInstrument, price float64, from time.Time) (bool, error) {
+	rsiResp, err := t.GetRSI(i.InstrumentID, from.UTC(), from.Add(1*time.Hour).UTC())
 	if err != nil {
 		return false, err
 	}
@@ -14,7 +34,7 @@ func (t *TechAnalyseService) GetRSIBBSignal(instrumentId string, price float64,
 
 	rsi := rsiResp[0].Value
 
-	bbResp, err := t.GetBB(instrumentId, from.UTC(), from.Add(1*time.Hour).UTC())
+	bbResp, err := t.GetBB(i.InstrumentID, from.UTC(), from.Add(1*time.Hour).UTC())
 	if err != nil {
 		return false, err
 	}
@@ -23,20 +43,11 @@ func (t *TechAnalyseService) GetRSIBBSignal(instrumentId string, price float64,
 		return false, nil
 	}
 
-	bbU, bbL := bbResp[0].UpperBand, bbResp[0].LowerBand
-
-	if rsi > t.cfg.RSI.UpperBound && price > bbU {
-		return true, nil
-	}
-	if rsi < t.cfg.RSI.LowerBound && price < bbL {
-		return false, nil
-	}
-
-	return false, nil
+	return rsiBBSignal(t.cfg, rsi, bbResp[0].LowerBand, bbResp[0].UpperBand, price), nil
 }
 
-func (t *TechAnalyseService) GetEMAMACDSignal(instrumentId string, price float64, from time.Time) (bool, error) {
-	emaResp, err := t.GetEMA(instrumentId, from.UTC(), from.Add(1*time.Hour).UTC())
+func (t *TechAnalyseService) GetEMAMACDSignal(i model.PortfolioInstrument, price float64, from time.Time) (bool, error) {
+	emaResp, err := t.GetEMA(i.InstrumentID, from.UTC(), from.Add(1*time.Hour).UTC())
 	if err != nil {
 		return false, err
 	}
@@ -46,7 +57,7 @@ func (t *TechAnalyseService) GetEMAMACDSignal(instrumentId string, price float64
 
 	emaSlow, emaFast := emaResp[0].SlowValue, emaResp[0].FastValue
 
-	macdResp, err := t.GetMACD(instrumentId, from.UTC(), from.Add(1*time.Hour).UTC())
+	macdResp, err := t.GetMACD(i.InstrumentID, from.UTC(), from.Add(1*time.Hour).UTC())
 	if err != nil {
 		return false, err
 	}
@@ -55,11 +66,5 @@ func (t *TechAnalyseService) GetEMAMACDSignal(instrumentId string, price float64
 		return false, nil
 	}
 
-	macd := macdResp[0].Value
-
-	if emaSlow > emaFast && macd < 0 {
-		return true, nil
-	}
-
-	return false, nil
+	return emaMACDSignal(emaSlow, emaFast, macdResp[0].Value), nil
 }
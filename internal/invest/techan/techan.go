@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/STTM-NSU/trading-bot/internal/config"
+	"github.com/STTM-NSU/trading-bot/internal/invest/broker"
 	"github.com/STTM-NSU/trading-bot/internal/logger"
 	"github.com/STTM-NSU/trading-bot/internal/tools"
 	"github.com/russianinvestments/invest-api-go-sdk/investgo"
@@ -16,15 +17,17 @@ type TechAnalyseService struct {
 	logger      logger.Logger
 	mdService   *investgo.MarketDataServiceClient
 	rateLimiter ratelimit.Limiter
+	retrier     *broker.Retrier
 
 	cfg config.TechnicalIndicatorsConfig
 }
 
-func NewTechAnalyseService(c *investgo.Client, cfg config.TechnicalIndicatorsConfig, logger logger.Logger) *TechAnalyseService {
+func NewTechAnalyseService(c *investgo.Client, cfg config.TechnicalIndicatorsConfig, retrier *broker.Retrier, logger logger.Logger) *TechAnalyseService {
 	return &TechAnalyseService{
 		logger:      logger,
 		cfg:         cfg,
 		rateLimiter: ratelimit.New(600, ratelimit.Per(1*time.Minute)),
+		retrier:     retrier,
 		mdService:   c.NewMarketDataServiceClient(),
 	}
 }
@@ -68,8 +71,10 @@ func (t *TechAnalyseService) GetRSI(instrumentId string, from, to time.Time) ([]
 		Length:        int32(t.cfg.RSI.Length),
 	}
 
-	t.rateLimiter.Take()
-	resp, err := t.mdService.GetTechAnalysis(req)
+	resp, err := broker.Call(t.retrier, "GetTechAnalysis", func() (*investgo.GetTechAnalysisResponse, error) {
+		t.rateLimiter.Take()
+		return t.mdService.GetTechAnalysis(req)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("GetRSI: %w", err)
 	}
@@ -100,8 +105,10 @@ func (t *TechAnalyseService) GetBB(instrumentId string, from, to time.Time) ([]T
 		},
 	}
 
-	t.rateLimiter.Take()
-	resp, err := t.mdService.GetTechAnalysis(req)
+	resp, err := broker.Call(t.retrier, "GetTechAnalysis", func() (*investgo.GetTechAnalysisResponse, error) {
+		t.rateLimiter.Take()
+		return t.mdService.GetTechAnalysis(req)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("GetRSI: %w", err)
 	}
@@ -140,14 +147,18 @@ func (t *TechAnalyseService) GetEMA(instrumentId string, from, to time.Time) ([]
 		Length:        int32(t.cfg.EMA.FastLength),
 	}
 
-	t.rateLimiter.Take()
-	respFast, err := t.mdService.GetTechAnalysis(reqFast)
+	respFast, err := broker.Call(t.retrier, "GetTechAnalysis", func() (*investgo.GetTechAnalysisResponse, error) {
+		t.rateLimiter.Take()
+		return t.mdService.GetTechAnalysis(reqFast)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("GetRSI: %w", err)
 	}
 
-	t.rateLimiter.Take()
-	respSlow, err := t.mdService.GetTechAnalysis(reqSlow)
+	respSlow, err := broker.Call(t.retrier, "GetTechAnalysis", func() (*investgo.GetTechAnalysisResponse, error) {
+		t.rateLimiter.Take()
+		return t.mdService.GetTechAnalysis(reqSlow)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("GetRSI: %w", err)
 	}
@@ -197,8 +208,10 @@ func (t *TechAnalyseService) GetMACD(instrumentId string, from, to time.Time) ([
 		},
 	}
 
-	t.rateLimiter.Take()
-	resp, err := t.mdService.GetTechAnalysis(req)
+	resp, err := broker.Call(t.retrier, "GetTechAnalysis", func() (*investgo.GetTechAnalysisResponse, error) {
+		t.rateLimiter.Take()
+		return t.mdService.GetTechAnalysis(req)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("GetRSI: %w", err)
 	}
@@ -5,4 +5,5 @@ import "time"
 type Candle struct {
 	Ts         time.Time `db:"ts"`
 	ClosePrice float64   `db:"close_price"`
+	Volume     float64   `db:"volume"` // in lots
 }
@@ -0,0 +1,28 @@
+package model
+
+import "time"
+
+type CashFlowType string
+
+const (
+	Dividend CashFlowType = "dividend"
+	Coupon   CashFlowType = "coupon"
+)
+
+// CashFlow is dividend or coupon payment for one security before tax
+type CashFlow struct {
+	FIGI        string       `json:"figi" yaml:"figi"`
+	Type        CashFlowType `json:"type" yaml:"type"`
+	Value       float64      `json:"value" yaml:"value"`
+	LastBuyDate time.Time    `json:"last_buy_date" yaml:"last_buy_date"` // holders on the end of this day get payment
+	PaymentDate time.Time    `json:"payment_date" yaml:"payment_date"`
+
+	// coupon period for accrued interest
+	PeriodStart time.Time `json:"period_start" yaml:"period_start"`
+	PeriodEnd   time.Time `json:"period_end" yaml:"period_end"`
+}
+
+// ExDate is the first day when buyer doesn't get payment
+func (c CashFlow) ExDate() time.Time {
+	return c.LastBuyDate.Truncate(24 * time.Hour).Add(24 * time.Hour)
+}
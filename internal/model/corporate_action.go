@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+type CorporateActionType string
+
+const (
+	Split        CorporateActionType = "split"
+	ReverseSplit CorporateActionType = "reverse_split"
+)
+
+type CorporateAction struct {
+	InstrumentID string              `db:"instrument_id"` // figi as in stocks table
+	Type         CorporateActionType `db:"type"`
+	Ts           time.Time           `db:"ts"`    // first candle with new prices
+	Ratio        float64             `db:"ratio"` // new securities for one old, 10 for 1:10 split and 0.1 for 10:1 reverse split
+}
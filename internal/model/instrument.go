@@ -20,6 +20,7 @@ type Instrument struct {
 	ExchangeSection   string         `json:"exchange_section" db:"exchange_section"`
 	InstrumentType    InstrumentType `json:"instrument_type" db:"instrument_type"`
 	MinPriceIncrement float64        `json:"min_price_increment" db:"min_price_increment"`
+	Sector            string         `json:"sector" db:"sector"`
 }
 
 func (p Instrument) GetUID() string {
@@ -76,6 +77,17 @@ func (i InstrumentType) ToAssetType() investapi.AssetType {
 	}
 }
 
+// RiskRates are margin rates of instrument, d* rates are for initial margin and d*Min for minimal margin
+type RiskRates struct {
+	Klong        float64 `yaml:"klong"`
+	Kshort       float64 `yaml:"kshort"`
+	Dlong        float64 `yaml:"dlong"`
+	Dshort       float64 `yaml:"dshort"`
+	DlongMin     float64 `yaml:"dlong_min"`
+	DshortMin    float64 `yaml:"dshort_min"`
+	ShortEnabled bool    `yaml:"short_enabled"`
+}
+
 type TradingSchedule struct {
 	Date         time.Time `json:"date"`
 	IsTradingDay bool      `json:"is_trading_day"`
@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+type JournalDirection string
+
+const (
+	JournalBuy   JournalDirection = "buy"
+	JournalSell  JournalDirection = "sell"
+	JournalShort JournalDirection = "short"
+	JournalCover JournalDirection = "cover"
+)
+
+// JournalEntry is executed trade, paper trades are stored in the same table with paper flag
+type JournalEntry struct {
+	AccountID    string           `db:"account_id"`
+	InstrumentID string           `db:"instrument_id"`
+	Direction    JournalDirection `db:"direction"`
+	Quantity     float64          `db:"quantity"` // in lots
+	Price        float64          `db:"price"`
+	Amount       float64          `db:"amount"` // with commission
+	Commission   float64          `db:"commission"`
+	Paper        bool             `db:"paper"`
+	Ts           time.Time        `db:"ts"`
+}
@@ -0,0 +1,20 @@
+package model
+
+// OrderState is exchange order state from order state stream, quantities are cumulative
+type OrderState struct {
+	OrderID        string
+	OrderRequestID string
+	InstrumentID   string // uid
+	Buy            bool
+	LotsExecuted   float64
+	LotsLeft       float64
+	ExecutedPrice  float64 // average price of one instrument
+	Done           bool    // order is filled, cancelled or rejected
+}
+
+// StopOrder is active stop order of account
+type StopOrder struct {
+	ID           string
+	InstrumentID string // uid
+	Buy          bool
+}
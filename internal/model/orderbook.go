@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+type OrderBookLevel struct {
+	Price    float64
+	Quantity float64 // in lots
+}
+
+// OrderBook levels are sorted from the best price
+type OrderBook struct {
+	Bids []OrderBookLevel
+	Asks []OrderBookLevel
+	Ts   time.Time
+
+	// price limits of exchange, zero if unknown
+	LimitUp   float64
+	LimitDown float64
+}
+
+type TradingStatus struct {
+	NormalTrading        bool
+	APITradeAvailable    bool
+	LimitOrderAvailable  bool
+	MarketOrderAvailable bool
+}
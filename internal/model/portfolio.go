@@ -11,10 +11,13 @@ type Balance struct {
 	AccountID string  `db:"account_id"`
 }
 
+// DirectionShort marks short position of paper portfolio, its EntryPrice is received money
+const DirectionShort = "short"
+
 type PortfolioInstrument struct {
 	OrderRequestID    string  `db:"order_request_id"`
 	OrderID           string  `db:"order_id"`
-	Direction         string  `db:"direction"`
+	Direction         string  `db:"direction"` // empty for long position
 	InstrumentType    string  `db:"instrument_type"`
 	EntryPrice        float64 `db:"entry_price"`
 	Quantity          float64 `db:"quantity"`
@@ -23,8 +26,14 @@ type PortfolioInstrument struct {
 	InstrumentID      string  `db:"instrument_id"`
 	FIGI              string  `db:"figi"`
 	AccountID         string  `db:"account_id"`
+	HedgeOrderID      string  `db:"hedge_order_id"` // protective stop posted after buy fill
+	ExitOrderID       string  `db:"exit_order_id"`  // take profit or other sell stop, bracketed with hedge
 }
 
 func (p PortfolioInstrument) GetUID() string {
 	return p.InstrumentID
 }
+
+func (p PortfolioInstrument) IsShort() bool {
+	return p.Direction == DirectionShort
+}
@@ -2,8 +2,16 @@ package model
 
 import "time"
 
+// STTMResponse has indexes either keyed by instrument id or in the order of requested ids for old service versions
 type STTMResponse struct {
-	Indexes []float64 `json:"indexes"`
+	Indexes []float64            `json:"indexes"`
+	Results map[string]STTMIndex `json:"results"` // instrument id -> index
+}
+
+type STTMIndex struct {
+	Index     float64 `json:"index"`
+	PValue    float64 `json:"p_value"`
+	NewsCount int     `json:"news_count"` // news used for index
 }
 
 type STTMErrorResponse struct {
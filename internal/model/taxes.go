@@ -34,3 +34,14 @@ var MarginTaxPerDay = map[float64]float64{
 	5_000_000:  4200,
 	10_000_000: 8200,
 }
+
+type TaxBracket struct {
+	From float64 // annual taxable base in RUB
+	Rate float64
+}
+
+// NDFLBrackets personal income tax for realized investment profit per calendar year
+var NDFLBrackets = []TaxBracket{
+	{From: 0, Rate: 0.13},
+	{From: 5_000_000, Rate: 0.15},
+}
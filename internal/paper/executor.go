@@ -0,0 +1,390 @@
+package paper
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/STTM-NSU/trading-bot/internal/backtest"
+	"github.com/STTM-NSU/trading-bot/internal/config"
+	"github.com/STTM-NSU/trading-bot/internal/invest/executor"
+	"github.com/STTM-NSU/trading-bot/internal/logger"
+	"github.com/STTM-NSU/trading-bot/internal/model"
+	"github.com/STTM-NSU/trading-bot/internal/portfolio"
+)
+
+type PriceFeed interface {
+	GetLastPrice(instrumentId string) (float64, error)
+}
+
+type Journal interface {
+	Write(ctx context.Context, e model.JournalEntry) error
+}
+
+type direction int
+
+const (
+	buy direction = iota
+	sell
+	newShort
+	short
+)
+
+type order struct {
+	instrument model.PortfolioInstrument
+	direction  direction
+	market     bool
+	origPrice  float64 // paid money for sell and received money for short
+	profit     float64 // multipliers of orig price
+	hedge      float64
+	trail      float64 // trailing stop from the running high
+	high       float64
+}
+
+// Executor is strategy.Execution with simulated matching engine over live prices,
+// fills and commissions are calculated as in backtest
+type Executor struct {
+	logger    logger.Logger
+	prices    PriceFeed
+	portfolio *portfolio.Portfolio // shorts are held there with short direction
+	journal   Journal
+
+	accountID string // paper account id
+	currency  string
+	taxes     map[model.InstrumentType]float64
+	slippage  float64
+
+	mu     sync.Mutex
+	orders map[string]order // instrument uid -> order
+}
+
+func NewExecutor(
+	logger logger.Logger,
+	prices PriceFeed,
+	portfolio *portfolio.Portfolio,
+	journal Journal,
+	accountID, currency string,
+	taxes map[model.InstrumentType]float64,
+	cfg config.PaperConfig,
+) *Executor {
+	return &Executor{
+		logger:    logger,
+		prices:    prices,
+		portfolio: portfolio,
+		journal:   journal,
+		accountID: accountID,
+		currency:  currency,
+		taxes:     taxes,
+		slippage:  cfg.SlippageBPS / 10_000,
+		orders:    make(map[string]order),
+	}
+}
+
+// RestoreShorts places cover orders of shorts loaded with portfolio
+func (e *Executor) RestoreShorts(cfg config.MarginTradingConfig) {
+	instruments, err := e.portfolio.GetInstruments()
+	if err != nil {
+		e.logger.Errorf("%s: can't get paper portfolio", err)
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, i := range instruments {
+		if !i.IsShort() {
+			continue
+		}
+		e.orders[i.InstrumentID] = order{
+			instrument: i,
+			direction:  short,
+			origPrice:  i.EntryPrice,
+			profit:     1 - cfg.ShortProfitPercent,
+			hedge:      1 + cfg.HedgePercent,
+		}
+	}
+}
+
+// Run checks orders on every interval until ctx is done
+func (e *Executor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			e.Check(ctx, now)
+		}
+	}
+}
+
+func (e *Executor) Buy(quantity, _ float64, i model.Instrument) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if v, ok := e.orders[i.UID]; ok {
+		if v.direction == buy {
+			v.instrument.Quantity += quantity
+			e.orders[i.UID] = v
+		}
+		return
+	}
+	e.orders[i.UID] = order{
+		instrument: model.PortfolioInstrument{
+			InstrumentType:    string(i.InstrumentType),
+			Quantity:          quantity,
+			Lot:               float64(i.Lot),
+			MinPriceIncrement: i.MinPriceIncrement,
+			InstrumentID:      i.UID,
+			FIGI:              i.FIGI,
+			AccountID:         e.accountID,
+		},
+		direction: buy,
+		market:    true,
+	}
+}
+
+func (e *Executor) Sell(_ float64, i model.PortfolioInstrument, cfg config.OrderConfig) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if v, ok := e.orders[i.InstrumentID]; ok && v.direction != sell {
+		return
+	}
+	o := order{
+		instrument: i,
+		direction:  sell,
+		market:     cfg.Type == config.Market,
+		origPrice:  i.EntryPrice,
+		profit:     1 + cfg.ProfitPercentIndent,
+		hedge:      1 - cfg.DefencePercentIndent,
+	}
+	if cfg.Type == config.TrailingStop && i.Quantity > 0 && i.Lot > 0 {
+		o.trail, o.high = cfg.TrailPercent, i.EntryPrice/(i.Quantity*i.Lot)
+	}
+	e.orders[i.InstrumentID] = o
+}
+
+func (e *Executor) Short(quantity, _ float64, i model.Instrument, cfg config.MarginTradingConfig) {
+	if quantity <= 0 {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, ok := e.orders[i.UID]; ok {
+		return
+	}
+	if _, ok := e.held(i.UID); ok { // portfolio holds one position of instrument
+		return
+	}
+	e.orders[i.UID] = order{
+		instrument: model.PortfolioInstrument{
+			InstrumentType: string(i.InstrumentType),
+			Quantity:       quantity,
+			Lot:            float64(i.Lot),
+			InstrumentID:   i.UID,
+			FIGI:           i.FIGI,
+			AccountID:      e.accountID,
+			Direction:      model.DirectionShort,
+		},
+		direction: newShort,
+		profit:    1 - cfg.ShortProfitPercent,
+		hedge:     1 + cfg.HedgePercent,
+	}
+}
+
+func (e *Executor) CancelBuys() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for id, o := range e.orders {
+		if o.direction == buy {
+			delete(e.orders, id)
+		}
+	}
+}
+
+func (e *Executor) CoverShorts() {
+	e.setMarket(short)
+}
+
+// CoverShortsBeforeClose covers shorts by market when session end of schedule is closer than cfg.CoverBeforeClose
+func (e *Executor) CoverShortsBeforeClose(now time.Time, schedule model.TradingSchedule, cfg config.MarginTradingConfig) {
+	if executor.ShouldCover(now, schedule, cfg.CoverBeforeClose) {
+		e.CoverShorts()
+	}
+}
+
+func (e *Executor) SellOut() {
+	e.setMarket(sell)
+}
+
+func (e *Executor) Liquidate() {
+	instruments, err := e.portfolio.GetInstruments()
+	if err != nil {
+		e.logger.Errorf("%s: can't get paper portfolio", err)
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, i := range instruments {
+		if i.IsShort() { // shorts are covered by CoverShorts
+			continue
+		}
+		e.orders[i.InstrumentID] = order{
+			instrument: i,
+			direction:  sell,
+			market:     true,
+			origPrice:  i.EntryPrice,
+		}
+	}
+}
+
+func (e *Executor) setMarket(d direction) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for id, o := range e.orders {
+		if o.direction == d {
+			o.market = true
+			e.orders[id] = o
+		}
+	}
+}
+
+// Check matches orders with the latest prices
+func (e *Executor) Check(ctx context.Context, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for id, o := range e.orders {
+		price, err := e.prices.GetLastPrice(o.instrument.FIGI)
+		if err != nil {
+			continue
+		}
+
+		switch o.direction {
+		case buy:
+			e.checkBuy(ctx, id, o, price, now)
+		case sell:
+			e.checkSell(ctx, id, o, price, now)
+		case newShort:
+			e.checkNewShort(ctx, id, o, price, now)
+		case short:
+			e.checkShort(ctx, id, o, price, now)
+		}
+	}
+}
+
+func (e *Executor) fill(o order, price, slippage float64, isBuy bool) (float64, float64) {
+	amount, _, commission := backtest.FillOn(price, o.instrument.Quantity*o.instrument.Lot, slippage,
+		e.taxes[model.InstrumentType(o.instrument.InstrumentType)], isBuy)
+	return amount, commission
+}
+
+func (e *Executor) checkBuy(ctx context.Context, id string, o order, price float64, now time.Time) {
+	amount, commission := e.fill(o, price, e.slippage, true)
+	if amount > e.portfolio.GetBalance(e.currency) {
+		e.logger.Infof("paper buy %s: not enough money %f", id, amount)
+		delete(e.orders, id)
+		return
+	}
+
+	instr := o.instrument
+	if v, ok := e.held(id); ok {
+		if v.IsShort() {
+			e.logger.Infof("paper buy %s: instrument is held short", id)
+			delete(e.orders, id)
+			return
+		}
+		instr.Quantity += v.Quantity
+		instr.EntryPrice += v.EntryPrice
+	}
+	instr.EntryPrice += amount
+	e.portfolio.UpdateInstrument(instr)
+	e.portfolio.UpdateBalance(model.Balance{Value: -amount, Currency: e.currency, AccountID: e.accountID})
+	e.record(ctx, o, model.JournalBuy, price, amount, commission, now)
+	delete(e.orders, id)
+}
+
+func (e *Executor) checkSell(ctx context.Context, id string, o order, price float64, now time.Time) {
+	if o.trail > 0 && !o.market {
+		o.high = max(o.high, price)
+		e.orders[id] = o
+		if price > o.high*(1-o.trail) {
+			return
+		}
+		o.market = true
+	}
+	amount, commission := e.fill(o, price, 0, false)
+	if !o.market && o.profit*o.origPrice > amount && o.hedge*o.origPrice <= amount {
+		return
+	}
+	if o.market {
+		amount, commission = e.fill(o, price, e.slippage, false)
+	}
+
+	e.portfolio.RemoveInstrument(o.instrument)
+	e.portfolio.UpdateBalance(model.Balance{Value: amount, Currency: e.currency, AccountID: e.accountID})
+	e.record(ctx, o, model.JournalSell, price, amount, commission, now)
+	delete(e.orders, id)
+}
+
+func (e *Executor) checkNewShort(ctx context.Context, id string, o order, price float64, now time.Time) {
+	amount, commission := e.fill(o, price, e.slippage, false)
+	o.origPrice = amount
+	o.direction = short
+	o.instrument.EntryPrice = amount
+	e.orders[id] = o
+	e.portfolio.UpdateInstrument(o.instrument)
+	e.record(ctx, o, model.JournalShort, price, amount, commission, now)
+}
+
+// checkShort covers short, balance gets only the difference as in backtest
+func (e *Executor) checkShort(ctx context.Context, id string, o order, price float64, now time.Time) {
+	amount, commission := e.fill(o, price, 0, true)
+	if !o.market && amount > o.origPrice*o.profit && amount <= o.origPrice*o.hedge {
+		return
+	}
+	if o.market {
+		amount, commission = e.fill(o, price, e.slippage, true)
+	}
+
+	e.portfolio.RemoveInstrument(o.instrument)
+	e.portfolio.UpdateBalance(model.Balance{Value: o.origPrice - amount, Currency: e.currency, AccountID: e.accountID})
+	e.record(ctx, o, model.JournalCover, price, amount, commission, now)
+	delete(e.orders, id)
+}
+
+func (e *Executor) held(id string) (model.PortfolioInstrument, bool) {
+	instruments, err := e.portfolio.GetInstruments()
+	if err != nil {
+		return model.PortfolioInstrument{}, false
+	}
+	for _, v := range instruments {
+		if v.InstrumentID == id {
+			return v, true
+		}
+	}
+	return model.PortfolioInstrument{}, false
+}
+
+func (e *Executor) record(ctx context.Context, o order, d model.JournalDirection, price, amount, commission float64, now time.Time) {
+	e.logger.Infof("paper %s %s %f %f %f", d, o.instrument.InstrumentID, o.instrument.Quantity, price, amount)
+	if err := e.journal.Write(ctx, model.JournalEntry{
+		AccountID:    e.accountID,
+		InstrumentID: o.instrument.InstrumentID,
+		Direction:    d,
+		Quantity:     o.instrument.Quantity,
+		Price:        price,
+		Amount:       amount,
+		Commission:   commission,
+		Paper:        true,
+		Ts:           now,
+	}); err != nil {
+		e.logger.Errorf("%s: can't write paper journal", err)
+	}
+}
@@ -0,0 +1,104 @@
+package paper
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/STTM-NSU/trading-bot/internal/backtest"
+	"github.com/STTM-NSU/trading-bot/internal/config"
+	"github.com/STTM-NSU/trading-bot/internal/logger"
+	"github.com/STTM-NSU/trading-bot/internal/model"
+	"github.com/STTM-NSU/trading-bot/internal/portfolio"
+)
+
+type testPrices map[string]float64 // figi -> price
+
+func (p testPrices) GetLastPrice(figi string) (float64, error) {
+	return p[figi], nil
+}
+
+type testJournal []model.JournalEntry
+
+func (j *testJournal) Write(_ context.Context, e model.JournalEntry) error {
+	*j = append(*j, e)
+	return nil
+}
+
+func newTestExecutor(t *testing.T, prices testPrices, port *portfolio.Portfolio, journal *testJournal) *Executor {
+	l, _, err := logger.NewZapLogger(logger.Error)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewExecutor(l, prices, port, journal, "paper", "rub", model.InvestorTaxes, config.PaperConfig{SlippageBPS: 10})
+}
+
+func newTestPortfolio(t *testing.T, balance float64) *portfolio.Portfolio {
+	l, _, err := logger.NewZapLogger(logger.Error)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return portfolio.NewPortfolio("paper", nil, nil, []model.Balance{{Value: balance, Currency: "rub"}}, nil, l)
+}
+
+func equal(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestBuyFillWithCommission(t *testing.T) {
+	port, journal := newTestPortfolio(t, 10_000), &testJournal{}
+	e := newTestExecutor(t, testPrices{"f": 100}, port, journal)
+
+	e.Buy(2, 0, model.Instrument{UID: "a", FIGI: "f", Lot: 10, InstrumentType: model.Share})
+	e.Check(context.Background(), time.Now())
+
+	// 20 shares on price with 10 bps slippage and investor tariff
+	amount, _, commission := backtest.FillOn(100, 20, 0.001, 0.003, true)
+	instruments, _ := port.GetInstruments()
+	if len(instruments) != 1 || instruments[0].Quantity != 2 || !equal(instruments[0].EntryPrice, amount) {
+		t.Fatalf("unexpected portfolio %+v", instruments)
+	}
+	if b := port.GetBalance("rub"); !equal(b, 10_000-amount) {
+		t.Errorf("unexpected balance %f", b)
+	}
+	if len(*journal) != 1 || (*journal)[0].Direction != model.JournalBuy || !equal((*journal)[0].Commission, commission) {
+		t.Errorf("unexpected journal %+v", *journal)
+	}
+}
+
+func TestShortIsCoveredAfterRestart(t *testing.T) {
+	cfg := config.MarginTradingConfig{ShortProfitPercent: 0.1, HedgePercent: 0.05}
+	prices, port, journal := testPrices{"f": 100}, newTestPortfolio(t, 10_000), &testJournal{}
+	e := newTestExecutor(t, prices, port, journal)
+
+	e.Short(1, 0, model.Instrument{UID: "a", FIGI: "f", Lot: 10, InstrumentType: model.Share}, cfg)
+	e.Check(context.Background(), time.Now())
+
+	received, _, _ := backtest.FillOn(100, 10, 0.001, 0.003, false)
+	instruments, _ := port.GetInstruments()
+	if len(instruments) != 1 || !instruments[0].IsShort() || !equal(instruments[0].EntryPrice, received) {
+		t.Fatalf("short must be held in portfolio, got %+v", instruments)
+	}
+
+	// executor of restarted bot covers short on hedge price
+	e = newTestExecutor(t, prices, port, journal)
+	e.RestoreShorts(cfg)
+	e.Check(context.Background(), time.Now())
+	if instruments, _ := port.GetInstruments(); len(instruments) != 1 {
+		t.Fatalf("short mustn't be covered between stops, got %+v", instruments)
+	}
+
+	prices["f"] = 110
+	e.Check(context.Background(), time.Now())
+	paid, _, _ := backtest.FillOn(110, 10, 0, 0.003, true)
+	if instruments, _ := port.GetInstruments(); len(instruments) != 0 {
+		t.Errorf("short must be covered, got %+v", instruments)
+	}
+	if b := port.GetBalance("rub"); !equal(b, 10_000+received-paid) {
+		t.Errorf("unexpected balance %f", b)
+	}
+	if d := (*journal)[len(*journal)-1].Direction; d != model.JournalCover {
+		t.Errorf("unexpected last journal entry %s", d)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"maps"
 
 	"github.com/STTM-NSU/trading-bot/internal/model"
 )
@@ -31,11 +32,11 @@ func (p *Portfolio) LoadFromDB(ctx context.Context) (bool, error) {
 	}
 	exists = true
 
-	if err := p.db.SelectContext(ctx, balances, _queryBalance, p.accountID); err != nil {
+	if err := p.db.SelectContext(ctx, &balances, _queryBalance, p.accountID); err != nil {
 		return exists, fmt.Errorf("%w: can't query portfolio balances", err)
 	}
 
-	if err := p.db.SelectContext(ctx, instruments, _queryPortfolioInstruments, p.accountID); err != nil {
+	if err := p.db.SelectContext(ctx, &instruments, _queryPortfolioInstruments, p.accountID); err != nil {
 		return exists, fmt.Errorf("%w: can't query portfolio instruments", err)
 	}
 
@@ -48,6 +49,7 @@ func (p *Portfolio) LoadFromDB(ctx context.Context) (bool, error) {
 	for _, instrument := range instruments {
 		p.instruments[instrument.InstrumentID] = instrument
 	}
+	p.removed = make(map[string]struct{})
 
 	p.profitPercent = portf.ProfitPercent
 	return exists, nil
@@ -55,6 +57,8 @@ func (p *Portfolio) LoadFromDB(ctx context.Context) (bool, error) {
 
 const (
 	_updatePortfolio   = "UPDATE portfolios SET profit_percent = $1 WHERE account_id = $2"
+	_insertPortfolio   = "INSERT INTO portfolios (profit_percent, account_id) VALUES ($1, $2)"
+	_deleteInstrument  = "DELETE FROM portfolio_instruments WHERE account_id = $1 AND instrument_id = $2"
 	_updateInstruments = `INSERT INTO portfolio_instruments (
 								instrument_id,
 								order_request_id,
@@ -64,9 +68,11 @@ const (
 								entry_price,
 								quantity,
 							   	min_price_increment,
-								account_id
-							) VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
-							ON CONFLICT (instrument_id) 
+								account_id,
+								hedge_order_id,
+								exit_order_id
+							) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)
+							ON CONFLICT (account_id, instrument_id)
 							DO UPDATE SET
 								order_request_id = EXCLUDED.order_request_id,
 								order_id = EXCLUDED.order_id,
@@ -75,7 +81,8 @@ const (
 								entry_price = EXCLUDED.entry_price,
 								quantity = EXCLUDED.quantity,
 								min_price_increment = EXCLUDED.min_price_increment,
-								account_id = EXCLUDED.account_id;`
+								hedge_order_id = EXCLUDED.hedge_order_id,
+								exit_order_id = EXCLUDED.exit_order_id;`
 	_updateBalance = `INSERT INTO balances (
 								value, currency, account_id
 							) VALUES ($1,$2,$3)
@@ -85,15 +92,38 @@ const (
 								currency = EXCLUDED.currency;`
 )
 
+// FlushToDB writes portfolio, so it is loaded after restart, sold and covered positions are deleted
 func (p *Portfolio) FlushToDB(ctx context.Context) error {
-	if len(p.instruments) == 0 || len(p.balance) == 0 {
+	p.mu.RLock()
+	profitPercent := p.profitPercent
+	instruments := maps.Clone(p.instruments)
+	removed := maps.Clone(p.removed)
+	balance := maps.Clone(p.balance)
+	p.mu.RUnlock()
+	if len(balance) == 0 {
 		return nil
 	}
 
-	if _, err := p.db.ExecContext(ctx, _updatePortfolio, p.profitPercent, p.accountID); err != nil {
+	res, err := p.db.ExecContext(ctx, _updatePortfolio, profitPercent, p.accountID)
+	if err != nil {
 		return fmt.Errorf("%w: can't update portfolio", err)
 	}
-	for _, instrument := range p.instruments {
+	if rows, err := res.RowsAffected(); err == nil && rows == 0 {
+		if _, err := p.db.ExecContext(ctx, _insertPortfolio, profitPercent, p.accountID); err != nil {
+			return fmt.Errorf("%w: can't insert portfolio", err)
+		}
+	}
+	for id := range removed {
+		if _, err := p.db.ExecContext(ctx, _deleteInstrument, p.accountID, id); err != nil {
+			return fmt.Errorf("%w: can't delete portfolio instrument", err)
+		}
+		p.mu.Lock()
+		if _, ok := p.instruments[id]; !ok {
+			delete(p.removed, id)
+		}
+		p.mu.Unlock()
+	}
+	for _, instrument := range instruments {
 		if _, err := p.db.ExecContext(ctx, _updateInstruments,
 			instrument.InstrumentID,
 			instrument.OrderRequestID,
@@ -104,12 +134,14 @@ func (p *Portfolio) FlushToDB(ctx context.Context) error {
 			instrument.Quantity,
 			instrument.MinPriceIncrement,
 			cmp.Or(instrument.AccountID, p.accountID),
+			instrument.HedgeOrderID,
+			instrument.ExitOrderID,
 		); err != nil {
 			return fmt.Errorf("%w: can't update portfolio instruments", err)
 		}
 	}
 
-	for curr, value := range p.balance {
+	for curr, value := range balance {
 		if _, err := p.db.ExecContext(ctx, _updateBalance, value, curr, p.accountID); err != nil {
 			return fmt.Errorf("%w: can't update portfolio balance", err)
 		}
@@ -0,0 +1,37 @@
+package portfolio
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/STTM-NSU/trading-bot/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	_insertJournal = `INSERT INTO journal (
+							account_id, instrument_id, direction, quantity, price, amount, commission, paper, ts
+						) VALUES (
+							:account_id, :instrument_id, :direction, :quantity, :price, :amount, :commission, :paper, :ts
+						)`
+)
+
+type Journal struct {
+	db *sqlx.DB
+}
+
+func NewJournal(db *sqlx.DB) *Journal {
+	return &Journal{db: db}
+}
+
+func (j *Journal) Write(ctx context.Context, e model.JournalEntry) error {
+	if _, err := j.db.NamedExecContext(ctx, _insertJournal, e); err != nil {
+		return fmt.Errorf("%w: can't insert journal entry", err)
+	}
+	return nil
+}
+
+// PaperAccountID tags account of paper trading, so its portfolio is stored apart from the real one
+func PaperAccountID(accountID string) string {
+	return "paper-" + accountID
+}
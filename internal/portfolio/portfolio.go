@@ -29,6 +29,7 @@ type Portfolio struct {
 	accountID     string
 	profitPercent float64
 	instruments   map[string]model.PortfolioInstrument
+	removed       map[string]struct{} // instruments removed since the last flush
 	balance       map[string]float64
 }
 
@@ -52,6 +53,7 @@ func NewPortfolio(
 		accountID:          accountID,
 		balance:            balances,
 		instruments:        make(map[string]model.PortfolioInstrument),
+		removed:            make(map[string]struct{}),
 	}
 }
 
@@ -104,12 +106,14 @@ func (p *Portfolio) UpdateInstrument(i model.PortfolioInstrument) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	p.instruments[i.InstrumentID] = i
+	delete(p.removed, i.InstrumentID)
 }
 
 func (p *Portfolio) RemoveInstrument(i model.PortfolioInstrument) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	delete(p.instruments, i.InstrumentID)
+	p.removed[i.InstrumentID] = struct{}{}
 }
 
 func (p *Portfolio) GetProfit() float64 {
@@ -0,0 +1,66 @@
+package signals
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type Weighted struct {
+	Provider Provider
+	Weight   float64
+}
+
+// Composite scores instruments by weighted sum of normalized scores of providers,
+// weights are renormalized over providers which scored instrument
+type Composite struct {
+	parts []Weighted
+}
+
+func NewComposite(parts ...Weighted) Composite {
+	return Composite{parts: parts}
+}
+
+func (p Composite) Scores(ctx context.Context, from, to time.Time, instrumentIds ...string) (Scores, error) {
+	var (
+		sum     = make(map[string]float64, len(instrumentIds))
+		weights = make(map[string]float64, len(instrumentIds))
+		errs    = make(map[string]error)
+		lastErr error
+	)
+	for k, part := range p.parts {
+		scores, err := part.Provider.Scores(ctx, from, to, instrumentIds...)
+		if err != nil {
+			lastErr = fmt.Errorf("%w: provider %d failed", err, k)
+			continue
+		}
+		for id, v := range Normalize(scores.Values) {
+			sum[id] += part.Weight * v
+			weights[id] += part.Weight
+		}
+		for id, err := range scores.Errors {
+			errs[id] = err
+		}
+	}
+
+	res := newScores(len(instrumentIds))
+	for _, id := range instrumentIds {
+		if w := weights[id]; w > 0 {
+			res.Values[id] = sum[id] / w
+			continue
+		}
+		if err, ok := errs[id]; ok {
+			res.Errors[id] = err
+		} else {
+			res.Errors[id] = fmt.Errorf("%w: %s", ErrNoScore, id)
+		}
+	}
+
+	if len(res.Values) == 0 && len(instrumentIds) > 0 {
+		if lastErr == nil {
+			lastErr = ErrNoScore
+		}
+		return res, fmt.Errorf("%w: can't get composite scores", lastErr)
+	}
+	return res, nil
+}
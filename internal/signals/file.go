@@ -0,0 +1,105 @@
+package signals
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+)
+
+type point struct {
+	ts    time.Time
+	score float64
+}
+
+// File serves precomputed scores from csv with ts,instrument_id,score rows or parquet with the same columns,
+// instrument gets the latest score which isn't after the end of window
+type File struct {
+	scores map[string][]point // instrument id -> points sorted by ts
+}
+
+// LoadFile reads parquet scores file if it starts with parquet magic and csv otherwise
+func LoadFile(path string) (File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return File{}, fmt.Errorf("%w: can't read scores file", err)
+	}
+	if bytes.HasPrefix(data, parquetMagic) {
+		return ReadParquet(data)
+	}
+	return ReadFile(bytes.NewReader(data))
+}
+
+// ReadFile reads csv scores, header row is optional, ts is RFC3339 or date
+func ReadFile(r io.Reader) (File, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return File{}, fmt.Errorf("%w: can't read scores csv", err)
+	}
+
+	file := File{scores: make(map[string][]point)}
+	for k, row := range rows {
+		if len(row) != 3 {
+			return File{}, fmt.Errorf("row %d: expected ts,instrument_id,score", k+1)
+		}
+		if k == 0 && row[0] == "ts" {
+			continue
+		}
+		ts, err := parseTs(row[0])
+		if err != nil {
+			return File{}, fmt.Errorf("%w: row %d: invalid ts", err, k+1)
+		}
+		score, err := strconv.ParseFloat(row[2], 64)
+		if err != nil {
+			return File{}, fmt.Errorf("%w: row %d: invalid score", err, k+1)
+		}
+		file.scores[row[1]] = append(file.scores[row[1]], point{ts: ts, score: score})
+	}
+
+	file.sort()
+	return file, nil
+}
+
+func (p File) sort() {
+	for _, points := range p.scores {
+		slices.SortFunc(points, func(a, b point) int {
+			return a.ts.Compare(b.ts)
+		})
+	}
+}
+
+func parseTs(s string) (time.Time, error) {
+	if ts, err := time.Parse(time.RFC3339, s); err == nil {
+		return ts, nil
+	}
+	return time.Parse(time.DateOnly, s)
+}
+
+func (p File) Scores(_ context.Context, _, to time.Time, instrumentIds ...string) (Scores, error) {
+	res := newScores(len(instrumentIds))
+	for _, id := range instrumentIds {
+		points := p.scores[id]
+		// the first point after to
+		k, _ := slices.BinarySearchFunc(points, to, func(p point, t time.Time) int {
+			if p.ts.After(t) {
+				return 1
+			}
+			return -1
+		})
+		if k == 0 {
+			res.Errors[id] = fmt.Errorf("%w: no score of %s before %s", ErrNoScore, id, to)
+			continue
+		}
+		res.Values[id] = points[k-1].score
+	}
+
+	if len(res.Values) == 0 && len(instrumentIds) > 0 {
+		return res, fmt.Errorf("%w: no scores in file before %s", ErrNoScore, to)
+	}
+	return res, nil
+}
@@ -0,0 +1,76 @@
+package signals
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/STTM-NSU/trading-bot/internal/model"
+)
+
+// priceGap is how long before start of window the start price is looked for, so weekends and holidays are covered
+const priceGap = 7 * 24 * time.Hour
+
+type PriceSource interface {
+	GetAdjustedCandlesFor(instrumentId string, from, to time.Time) ([]model.Candle, error)
+}
+
+// Momentum scores instruments by split-adjusted price change over lookback before rebalance,
+// the whole window for zero lookback
+type Momentum struct {
+	prices   PriceSource
+	lookback time.Duration
+}
+
+func NewMomentum(prices PriceSource, lookback time.Duration) Momentum {
+	return Momentum{
+		prices:   prices,
+		lookback: lookback,
+	}
+}
+
+// lastClose returns close of the last candle which isn't after ts
+func lastClose(candles []model.Candle, ts time.Time) (float64, bool) {
+	for k := len(candles) - 1; k >= 0; k-- {
+		if !candles[k].Ts.After(ts) {
+			return candles[k].ClosePrice, true
+		}
+	}
+	return 0, false
+}
+
+func (p Momentum) Scores(_ context.Context, from, to time.Time, instrumentIds ...string) (Scores, error) {
+	if p.lookback > 0 {
+		from = to.Add(-p.lookback)
+	}
+
+	res := newScores(len(instrumentIds))
+	for _, id := range instrumentIds {
+		// both prices are taken from one request, so they are adjusted to the same date
+		candles, err := p.prices.GetAdjustedCandlesFor(id, from.Add(-priceGap).UTC(), to.UTC())
+		if err != nil {
+			res.Errors[id] = fmt.Errorf("%w: can't get adjusted candles", err)
+			continue
+		}
+		start, ok := lastClose(candles, from)
+		if !ok {
+			res.Errors[id] = fmt.Errorf("%w: no start price of %s", ErrNoScore, id)
+			continue
+		}
+		end, ok := lastClose(candles, to)
+		if !ok {
+			res.Errors[id] = fmt.Errorf("%w: no end price of %s", ErrNoScore, id)
+			continue
+		}
+		if start <= 0 {
+			res.Errors[id] = fmt.Errorf("%w: zero start price of %s", ErrNoScore, id)
+			continue
+		}
+		res.Values[id] = end/start - 1
+	}
+
+	if len(res.Values) == 0 && len(instrumentIds) > 0 {
+		return res, fmt.Errorf("%w: no prices for momentum", ErrNoScore)
+	}
+	return res, nil
+}
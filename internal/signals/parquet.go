@@ -0,0 +1,645 @@
+package signals
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/golang/snappy"
+)
+
+// minimal parquet reader of flat scores files as written by pandas, pyarrow or spark:
+// plain and dictionary encodings, v1 and v2 data pages, uncompressed, snappy and gzip codecs
+
+var (
+	parquetMagic = []byte("PAR1")
+
+	errParquet = errors.New("invalid parquet file")
+)
+
+// thrift compact protocol types
+const (
+	tBoolTrue  = 1
+	tBoolFalse = 2
+	tByte      = 3
+	tI16       = 4
+	tI32       = 5
+	tI64       = 6
+	tDouble    = 7
+	tBinary    = 8
+	tList      = 9
+	tSet       = 10
+	tMap       = 11
+	tStruct    = 12
+)
+
+// parquet format enums used by reader
+const (
+	pqBoolean   = 0
+	pqInt32     = 1
+	pqInt64     = 2
+	pqInt96     = 3
+	pqFloat     = 4
+	pqDouble    = 5
+	pqByteArray = 6
+
+	pqOptional = 1
+
+	pqDate            = 6
+	pqTimestampMillis = 9
+	pqTimestampMicros = 10
+
+	pqPlain          = 0
+	pqPlainDict      = 2
+	pqRLEDictionary  = 8
+	pqUncompressed   = 0
+	pqSnappy         = 1
+	pqGzip           = 2
+	pqDataPage       = 0
+	pqDictionaryPage = 2
+	pqDataPageV2     = 3
+)
+
+// thriftStruct is decoded struct by field id, ints are int64, binaries are []byte
+type thriftStruct map[int16]any
+
+func (s thriftStruct) int(id int16) int64 {
+	v, _ := s[id].(int64)
+	return v
+}
+
+func (s thriftStruct) str(id int16) string {
+	v, _ := s[id].([]byte)
+	return string(v)
+}
+
+func (s thriftStruct) strct(id int16) thriftStruct {
+	v, _ := s[id].(thriftStruct)
+	return v
+}
+
+func (s thriftStruct) list(id int16) []any {
+	v, _ := s[id].([]any)
+	return v
+}
+
+type thriftReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *thriftReader) byte() (byte, error) {
+	if r.pos >= len(r.buf) {
+		return 0, fmt.Errorf("%w: unexpected end of thrift data", errParquet)
+	}
+	r.pos++
+	return r.buf[r.pos-1], nil
+}
+
+func (r *thriftReader) bytes(n int) ([]byte, error) {
+	if n < 0 || n > len(r.buf)-r.pos {
+		return nil, fmt.Errorf("%w: unexpected end of thrift data", errParquet)
+	}
+	r.pos += n
+	return r.buf[r.pos-n : r.pos], nil
+}
+
+func (r *thriftReader) varint() (uint64, error) {
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	if n <= 0 {
+		return 0, fmt.Errorf("%w: invalid varint", errParquet)
+	}
+	r.pos += n
+	return v, nil
+}
+
+func (r *thriftReader) zigzag() (int64, error) {
+	v, err := r.varint()
+	return int64(v>>1) ^ -int64(v&1), err
+}
+
+func (r *thriftReader) readStruct() (thriftStruct, error) {
+	s := make(thriftStruct)
+	var id int16
+	for {
+		h, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		if h == 0 {
+			return s, nil
+		}
+
+		if delta := int16(h >> 4); delta != 0 {
+			id += delta
+		} else {
+			v, err := r.zigzag()
+			if err != nil {
+				return nil, err
+			}
+			id = int16(v)
+		}
+
+		// struct bools are stored in field type
+		switch typ := h & 0x0f; typ {
+		case tBoolTrue, tBoolFalse:
+			s[id] = typ == tBoolTrue
+		default:
+			if s[id], err = r.readValue(typ); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (r *thriftReader) readValue(typ byte) (any, error) {
+	switch typ {
+	case tBoolTrue, tBoolFalse:
+		b, err := r.byte()
+		return b == tBoolTrue, err
+	case tByte:
+		b, err := r.byte()
+		return int64(int8(b)), err
+	case tI16, tI32, tI64:
+		return r.zigzag()
+	case tDouble:
+		b, err := r.bytes(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+	case tBinary:
+		n, err := r.varint()
+		if err != nil {
+			return nil, err
+		}
+		return r.bytes(int(min(n, math.MaxInt32)))
+	case tList, tSet:
+		h, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		size := uint64(h >> 4)
+		if size == 15 {
+			if size, err = r.varint(); err != nil {
+				return nil, err
+			}
+		}
+		// every element takes at least one byte
+		if size > uint64(len(r.buf)-r.pos) {
+			return nil, fmt.Errorf("%w: invalid list size", errParquet)
+		}
+		list := make([]any, 0, size)
+		for ; size > 0; size-- {
+			v, err := r.readValue(h & 0x0f)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	case tMap:
+		// maps aren't used by reader, they are skipped
+		size, err := r.varint()
+		if err != nil || size == 0 {
+			return nil, err
+		}
+		kv, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		for ; size > 0; size-- {
+			if _, err := r.readValue(kv >> 4); err != nil {
+				return nil, err
+			}
+			if _, err := r.readValue(kv & 0x0f); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	case tStruct:
+		return r.readStruct()
+	}
+	return nil, fmt.Errorf("%w: unknown thrift type %d", errParquet, typ)
+}
+
+type parquetColumn struct {
+	name     string
+	typ      int64
+	optional bool
+	date     bool          // int32 days since epoch
+	unit     time.Duration // of int64 timestamp
+}
+
+func parquetColumns(schema []any) ([]parquetColumn, error) {
+	if len(schema) == 0 {
+		return nil, fmt.Errorf("%w: empty schema", errParquet)
+	}
+
+	columns := make([]parquetColumn, 0, len(schema)-1)
+	for _, v := range schema[1:] {
+		el, _ := v.(thriftStruct)
+		if el.int(5) > 0 {
+			return nil, fmt.Errorf("nested parquet column %s isn't supported", el.str(4))
+		}
+
+		c := parquetColumn{
+			name:     el.str(4),
+			typ:      el.int(1),
+			optional: el.int(3) == pqOptional,
+		}
+		// logical type is preferred over legacy converted one
+		logical := el.strct(10)
+		switch {
+		case logical[6] != nil || el.int(6) == pqDate:
+			c.date = true
+		case logical[8] != nil:
+			switch unit := logical.strct(8).strct(2); {
+			case unit[1] != nil:
+				c.unit = time.Millisecond
+			case unit[2] != nil:
+				c.unit = time.Microsecond
+			default:
+				c.unit = time.Nanosecond
+			}
+		case el.int(6) == pqTimestampMillis:
+			c.unit = time.Millisecond
+		case el.int(6) == pqTimestampMicros:
+			c.unit = time.Microsecond
+		}
+		columns = append(columns, c)
+	}
+	return columns, nil
+}
+
+// ReadParquet reads scores from parquet file with ts, instrument_id and score columns,
+// ts is timestamp, date or string as in csv
+func ReadParquet(data []byte) (File, error) {
+	if len(data) < 12 || !bytes.HasPrefix(data, parquetMagic) || !bytes.HasSuffix(data, parquetMagic) {
+		return File{}, fmt.Errorf("%w: no magic", errParquet)
+	}
+	footer := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	if footer <= 0 || footer > len(data)-12 {
+		return File{}, fmt.Errorf("%w: invalid footer length", errParquet)
+	}
+	meta, err := (&thriftReader{buf: data[len(data)-8-footer : len(data)-8]}).readStruct()
+	if err != nil {
+		return File{}, fmt.Errorf("%w: can't read parquet metadata", err)
+	}
+
+	columns, err := parquetColumns(meta.list(2))
+	if err != nil {
+		return File{}, err
+	}
+	idx := map[string]int{"ts": -1, "instrument_id": -1, "score": -1}
+	for k, c := range columns {
+		if _, ok := idx[c.name]; ok {
+			idx[c.name] = k
+		}
+	}
+	for name, k := range idx {
+		if k < 0 {
+			return File{}, fmt.Errorf("%w: no %s column", errParquet, name)
+		}
+	}
+
+	file := File{scores: make(map[string][]point)}
+	for g, v := range meta.list(4) {
+		chunks := v.(thriftStruct).list(1)
+		if len(chunks) != len(columns) {
+			return File{}, fmt.Errorf("%w: row group %d has %d columns instead of %d", errParquet, g, len(chunks), len(columns))
+		}
+
+		values := make(map[string][]any, len(idx))
+		for name, k := range idx {
+			chunk, _ := chunks[k].(thriftStruct)
+			if values[name], err = readParquetColumn(data, chunk.strct(3), columns[k]); err != nil {
+				return File{}, fmt.Errorf("%w: row group %d: can't read %s", err, g, name)
+			}
+		}
+
+		ts, ids, scores := values["ts"], values["instrument_id"], values["score"]
+		if len(ts) != len(ids) || len(ts) != len(scores) {
+			return File{}, fmt.Errorf("%w: row group %d has columns of different length", errParquet, g)
+		}
+		for k := range ts {
+			// row without score doesn't score instrument
+			if ts[k] == nil || ids[k] == nil || scores[k] == nil {
+				continue
+			}
+			p, id, err := parquetPoint(ts[k], ids[k], scores[k], columns[idx["ts"]])
+			if err != nil {
+				return File{}, fmt.Errorf("%w: row group %d: row %d", err, g, k+1)
+			}
+			file.scores[id] = append(file.scores[id], p)
+		}
+	}
+
+	file.sort()
+	return file, nil
+}
+
+func parquetPoint(ts, id, score any, tsColumn parquetColumn) (point, string, error) {
+	var p point
+	switch v := ts.(type) {
+	case time.Time:
+		p.ts = v
+	case string:
+		t, err := parseTs(v)
+		if err != nil {
+			return point{}, "", fmt.Errorf("%w: invalid ts", err)
+		}
+		p.ts = t
+	case int64:
+		switch {
+		case tsColumn.date:
+			p.ts = time.Unix(v*24*60*60, 0).UTC()
+		case tsColumn.unit == time.Millisecond:
+			p.ts = time.UnixMilli(v).UTC()
+		case tsColumn.unit == time.Microsecond:
+			p.ts = time.UnixMicro(v).UTC()
+		case tsColumn.unit == time.Nanosecond:
+			p.ts = time.Unix(0, v).UTC()
+		default:
+			return point{}, "", fmt.Errorf("%w: ts column isn't timestamp", errParquet)
+		}
+	default:
+		return point{}, "", fmt.Errorf("%w: invalid ts type", errParquet)
+	}
+
+	switch v := score.(type) {
+	case float64:
+		p.score = v
+	case int64:
+		p.score = float64(v)
+	default:
+		return point{}, "", fmt.Errorf("%w: invalid score type", errParquet)
+	}
+
+	instrumentId, ok := id.(string)
+	if !ok {
+		return point{}, "", fmt.Errorf("%w: invalid instrument_id type", errParquet)
+	}
+	return p, instrumentId, nil
+}
+
+// readParquetColumn returns values of column chunk, nil for nulls
+func readParquetColumn(data []byte, meta thriftStruct, c parquetColumn) ([]any, error) {
+	start, size := meta.int(9), meta.int(7)
+	if dict := meta.int(11); dict > 0 && dict < start {
+		start = dict
+	}
+	if start < 0 || size < 0 || start+size > int64(len(data)) {
+		return nil, fmt.Errorf("%w: column chunk is out of file", errParquet)
+	}
+
+	var (
+		r      = &thriftReader{buf: data[start : start+size]}
+		codec  = meta.int(4)
+		total  = int(meta.int(5))
+		values = make([]any, 0, min(total, len(r.buf)))
+		dict   []any
+	)
+	for len(values) < total {
+		header, err := r.readStruct()
+		if err != nil {
+			return nil, fmt.Errorf("%w: can't read page header", err)
+		}
+		page, err := r.bytes(int(header.int(3)))
+		if err != nil {
+			return nil, err
+		}
+
+		switch header.int(1) {
+		case pqDictionaryPage:
+			raw, err := decompress(codec, page)
+			if err != nil {
+				return nil, err
+			}
+			if dict, err = decodePlain(raw, c.typ, int(header.strct(7).int(1))); err != nil {
+				return nil, fmt.Errorf("%w: can't read dictionary", err)
+			}
+		case pqDataPage:
+			raw, err := decompress(codec, page)
+			if err != nil {
+				return nil, err
+			}
+			h := header.strct(5)
+			var defs []int64
+			if c.optional {
+				if len(raw) < 4 {
+					return nil, fmt.Errorf("%w: no definition levels", errParquet)
+				}
+				n := int(binary.LittleEndian.Uint32(raw))
+				if n > len(raw)-4 {
+					return nil, fmt.Errorf("%w: invalid definition levels length", errParquet)
+				}
+				if defs, err = decodeHybrid(raw[4:4+n], 1, int(h.int(1))); err != nil {
+					return nil, err
+				}
+				raw = raw[4+n:]
+			}
+			if values, err = appendPage(values, raw, h.int(2), c.typ, dict, defs, int(h.int(1))); err != nil {
+				return nil, err
+			}
+		case pqDataPageV2:
+			h := header.strct(8)
+			repLen, defLen := int(h.int(6)), int(h.int(5))
+			if repLen < 0 || defLen < 0 || repLen+defLen > len(page) {
+				return nil, fmt.Errorf("%w: invalid levels length", errParquet)
+			}
+			// levels of v2 page are never compressed
+			raw := page[repLen+defLen:]
+			if compressed, ok := h[7].(bool); !ok || compressed {
+				if raw, err = decompress(codec, raw); err != nil {
+					return nil, err
+				}
+			}
+			var defs []int64
+			if c.optional {
+				if defs, err = decodeHybrid(page[repLen:repLen+defLen], 1, int(h.int(1))); err != nil {
+					return nil, err
+				}
+			}
+			if values, err = appendPage(values, raw, h.int(4), c.typ, dict, defs, int(h.int(1))); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return values, nil
+}
+
+// appendPage appends n page values, values are placed by definition levels if there are any
+func appendPage(values []any, raw []byte, encoding, typ int64, dict []any, defs []int64, n int) ([]any, error) {
+	defined := n
+	if defs != nil {
+		defined = 0
+		for _, d := range defs {
+			defined += int(d)
+		}
+	}
+
+	var (
+		vals []any
+		err  error
+	)
+	switch encoding {
+	case pqPlain:
+		vals, err = decodePlain(raw, typ, defined)
+	case pqPlainDict, pqRLEDictionary:
+		if len(raw) == 0 {
+			return nil, fmt.Errorf("%w: empty dictionary indexes", errParquet)
+		}
+		var indexes []int64
+		if indexes, err = decodeHybrid(raw[1:], int(raw[0]), defined); err != nil {
+			break
+		}
+		vals = make([]any, len(indexes))
+		for k, i := range indexes {
+			if i < 0 || i >= int64(len(dict)) {
+				return nil, fmt.Errorf("%w: dictionary index is out of range", errParquet)
+			}
+			vals[k] = dict[i]
+		}
+	default:
+		return nil, fmt.Errorf("unsupported parquet encoding %d", encoding)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if defs == nil {
+		return append(values, vals...), nil
+	}
+	for _, d := range defs {
+		if d == 0 {
+			values = append(values, nil)
+			continue
+		}
+		values = append(values, vals[0])
+		vals = vals[1:]
+	}
+	return values, nil
+}
+
+func decodePlain(raw []byte, typ int64, n int) ([]any, error) {
+	var width int
+	switch typ {
+	case pqInt32, pqFloat:
+		width = 4
+	case pqInt64, pqDouble:
+		width = 8
+	case pqInt96:
+		width = 12
+	case pqByteArray:
+	default:
+		return nil, fmt.Errorf("unsupported parquet type %d", typ)
+	}
+	if width > 0 && len(raw) < n*width {
+		return nil, fmt.Errorf("%w: page is shorter than values", errParquet)
+	}
+
+	values := make([]any, 0, min(n, len(raw)))
+	for ; n > 0; n-- {
+		switch typ {
+		case pqInt32:
+			values = append(values, int64(int32(binary.LittleEndian.Uint32(raw))))
+		case pqInt64:
+			values = append(values, int64(binary.LittleEndian.Uint64(raw)))
+		case pqInt96:
+			// legacy timestamp: nanoseconds of day and julian day
+			nanos, day := int64(binary.LittleEndian.Uint64(raw)), int64(binary.LittleEndian.Uint32(raw[8:]))
+			values = append(values, time.Unix((day-2_440_588)*24*60*60, nanos).UTC())
+		case pqFloat:
+			values = append(values, float64(math.Float32frombits(binary.LittleEndian.Uint32(raw))))
+		case pqDouble:
+			values = append(values, math.Float64frombits(binary.LittleEndian.Uint64(raw)))
+		case pqByteArray:
+			if len(raw) < 4 {
+				return nil, fmt.Errorf("%w: page is shorter than values", errParquet)
+			}
+			l := int(binary.LittleEndian.Uint32(raw))
+			if l > len(raw)-4 {
+				return nil, fmt.Errorf("%w: page is shorter than values", errParquet)
+			}
+			values = append(values, string(raw[4:4+l]))
+			width = 4 + l
+		}
+		raw = raw[width:]
+	}
+	return values, nil
+}
+
+// decodeHybrid decodes n values of rle and bit-packing hybrid encoding
+func decodeHybrid(buf []byte, bitWidth, n int) ([]int64, error) {
+	if bitWidth > 32 {
+		return nil, fmt.Errorf("%w: invalid bit width %d", errParquet, bitWidth)
+	}
+
+	values := make([]int64, 0, n)
+	byteWidth := (bitWidth + 7) / 8
+	for len(values) < n {
+		header, k := binary.Uvarint(buf)
+		if k <= 0 {
+			return nil, fmt.Errorf("%w: levels or indexes are shorter than values", errParquet)
+		}
+		buf = buf[k:]
+
+		if header&1 == 0 {
+			if len(buf) < byteWidth {
+				return nil, fmt.Errorf("%w: invalid rle run", errParquet)
+			}
+			var v int64
+			for i := range byteWidth {
+				v |= int64(buf[i]) << (8 * i)
+			}
+			buf = buf[byteWidth:]
+			for run := header >> 1; run > 0 && len(values) < n; run-- {
+				values = append(values, v)
+			}
+			continue
+		}
+
+		// groups of 8 values packed from the least significant bit
+		groups := int(min(header>>1, uint64(len(buf))))
+		if len(buf) < groups*bitWidth {
+			return nil, fmt.Errorf("%w: invalid bit-packed run", errParquet)
+		}
+		for i := 0; i < groups*8 && len(values) < n; i++ {
+			var v int64
+			for b := range bitWidth {
+				bit := i*bitWidth + b
+				v |= int64(buf[bit/8]>>(bit%8)&1) << b
+			}
+			values = append(values, v)
+		}
+		buf = buf[groups*bitWidth:]
+	}
+	return values, nil
+}
+
+func decompress(codec int64, buf []byte) ([]byte, error) {
+	switch codec {
+	case pqUncompressed:
+		return buf, nil
+	case pqSnappy:
+		raw, err := snappy.Decode(nil, buf)
+		if err != nil {
+			return nil, fmt.Errorf("%w: can't read snappy page", err)
+		}
+		return raw, nil
+	case pqGzip:
+		r, err := gzip.NewReader(bytes.NewReader(buf))
+		if err != nil {
+			return nil, fmt.Errorf("%w: can't read gzip page", err)
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	}
+	return nil, fmt.Errorf("unsupported parquet codec %d, write scores with snappy, gzip or without compression", codec)
+}
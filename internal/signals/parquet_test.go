@@ -0,0 +1,261 @@
+package signals
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+)
+
+// thrift compact writer of parquet metadata for tests
+type tfield struct {
+	id int16
+	v  any
+}
+
+type tlist struct {
+	typ   byte
+	items []any
+}
+
+func writeThrift(buf *bytes.Buffer, fields ...tfield) {
+	var last int16
+	for _, f := range fields {
+		var typ byte
+		switch v := f.v.(type) {
+		case bool:
+			// struct bools are stored in field type
+			typ = tBoolFalse
+			if v {
+				typ = tBoolTrue
+			}
+		case int16:
+			typ = tI16
+		case int32:
+			typ = tI32
+		case int64:
+			typ = tI64
+		case string:
+			typ = tBinary
+		case tlist:
+			typ = tList
+		case []tfield:
+			typ = tStruct
+		}
+		buf.WriteByte(byte(f.id-last)<<4 | typ)
+		last = f.id
+		writeThriftValue(buf, f.v)
+	}
+	buf.WriteByte(0)
+}
+
+func writeThriftValue(buf *bytes.Buffer, v any) {
+	switch v := v.(type) {
+	case int16:
+		buf.Write(binary.AppendUvarint(nil, uint64(int64(v)<<1^int64(v)>>63)))
+	case int32:
+		buf.Write(binary.AppendUvarint(nil, uint64(int64(v)<<1^int64(v)>>63)))
+	case int64:
+		buf.Write(binary.AppendUvarint(nil, uint64(v<<1^v>>63)))
+	case string:
+		buf.Write(binary.AppendUvarint(nil, uint64(len(v))))
+		buf.WriteString(v)
+	case tlist:
+		buf.WriteByte(byte(len(v.items))<<4 | v.typ)
+		for _, item := range v.items {
+			writeThriftValue(buf, item)
+		}
+	case []tfield:
+		writeThrift(buf, v...)
+	}
+}
+
+type testPage struct {
+	typ      int32
+	n        int32
+	encoding int32
+	raw      []byte
+}
+
+// writeChunk writes pages of column and returns its metadata
+func writeChunk(file *bytes.Buffer, typ int32, name string, codec int32, pages ...testPage) []tfield {
+	start := int64(file.Len())
+	var n int64
+	for _, p := range pages {
+		data := p.raw
+		if codec == pqSnappy {
+			data = snappy.Encode(nil, p.raw)
+		}
+		header := []tfield{{1, p.typ}, {2, int32(len(p.raw))}, {3, int32(len(data))}}
+		if p.typ == pqDictionaryPage {
+			header = append(header, tfield{7, []tfield{{1, p.n}, {2, int32(pqPlain)}}})
+		} else {
+			header = append(header, tfield{5, []tfield{{1, p.n}, {2, p.encoding}, {3, int32(3)}, {4, int32(3)}}})
+			n += int64(p.n)
+		}
+		writeThrift(file, header...)
+		file.Write(data)
+	}
+
+	size := int64(file.Len()) - start
+	meta := []tfield{
+		{1, typ}, {2, tlist{tI32, []any{int32(pqPlain)}}}, {3, tlist{tBinary, []any{name}}}, {4, codec},
+		{5, n}, {6, size}, {7, size}, {9, start},
+	}
+	if pages[0].typ == pqDictionaryPage {
+		meta = append(meta, tfield{11, start})
+	}
+	return []tfield{{2, start}, {3, meta}}
+}
+
+func TestParquet(t *testing.T) {
+	file := bytes.NewBufferString("PAR1")
+
+	ts := binary.LittleEndian.AppendUint64(nil, uint64(time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC).UnixMilli()))
+	ts = binary.LittleEndian.AppendUint64(ts, uint64(time.Date(2024, 1, 12, 0, 0, 0, 0, time.UTC).UnixMilli()))
+	ts = binary.LittleEndian.AppendUint64(ts, uint64(time.Date(2024, 1, 12, 0, 0, 0, 0, time.UTC).UnixMilli()))
+	tsChunk := writeChunk(file, pqInt64, "ts", pqUncompressed, testPage{typ: pqDataPage, n: 3, raw: ts})
+
+	// dictionary a, b and bit-packed indexes 0, 0, 1
+	dict := append(binary.LittleEndian.AppendUint32(nil, 1), 'a')
+	dict = append(binary.LittleEndian.AppendUint32(dict, 1), 'b')
+	idChunk := writeChunk(file, pqByteArray, "instrument_id", pqUncompressed,
+		testPage{typ: pqDictionaryPage, n: 2, raw: dict},
+		testPage{typ: pqDataPage, n: 3, encoding: pqRLEDictionary, raw: []byte{1, 3, 0b100}})
+
+	// definition levels 1, 1, 0, so score of b is null
+	scores := append(binary.LittleEndian.AppendUint32(nil, 2), 3, 0b011)
+	scores = binary.LittleEndian.AppendUint64(scores, math.Float64bits(1))
+	scores = binary.LittleEndian.AppendUint64(scores, math.Float64bits(2))
+	scoreChunk := writeChunk(file, pqDouble, "score", pqSnappy, testPage{typ: pqDataPage, n: 3, raw: scores})
+
+	var meta bytes.Buffer
+	writeThrift(&meta,
+		tfield{1, int32(1)},
+		tfield{2, tlist{tStruct, []any{
+			[]tfield{{4, "schema"}, {5, int32(3)}},
+			[]tfield{{1, int32(pqInt64)}, {3, int32(0)}, {4, "ts"}, {10, []tfield{{8, []tfield{{2, []tfield{{1, []tfield{}}}}}}}}},
+			[]tfield{{1, int32(pqByteArray)}, {3, int32(0)}, {4, "instrument_id"}, {6, int32(0)}},
+			[]tfield{{1, int32(pqDouble)}, {3, int32(pqOptional)}, {4, "score"}},
+		}}},
+		tfield{3, int64(3)},
+		tfield{4, tlist{tStruct, []any{
+			[]tfield{{1, tlist{tStruct, []any{tsChunk, idChunk, scoreChunk}}}, {2, int64(file.Len())}, {3, int64(3)}},
+		}}},
+	)
+	file.Write(meta.Bytes())
+	file.Write(binary.LittleEndian.AppendUint32(nil, uint32(meta.Len())))
+	file.WriteString("PAR1")
+
+	checkScores(t, file.Bytes())
+}
+
+// checkScores checks file with scores 1 and 2 of a on 2024-01-05 and 2024-01-12 and null score of b on 2024-01-12
+func checkScores(t *testing.T, data []byte) {
+	t.Helper()
+	f, err := ReadParquet(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := f.Scores(context.Background(), time.Time{}, time.Date(2024, 1, 10, 20, 0, 0, 0, time.UTC), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Values["a"] != 1 {
+		t.Errorf("the latest score before window end is expected, got %v", res.Values["a"])
+	}
+
+	res, err = f.Scores(context.Background(), time.Time{}, time.Date(2024, 1, 13, 0, 0, 0, 0, time.UTC), "a", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Values["a"] != 2 {
+		t.Errorf("unexpected score of a %v", res.Values["a"])
+	}
+	if !errors.Is(res.Errors["b"], ErrNoScore) {
+		t.Errorf("null score mustn't score instrument, got %v", res.Values["b"])
+	}
+}
+
+// optional column of 3 rows, definition levels are rle run of 3 ones unless given
+func optionalPage(encoding int32, defs, raw []byte) testPage {
+	if defs == nil {
+		defs = []byte{3 << 1, 1}
+	}
+	data := append(binary.LittleEndian.AppendUint32(nil, uint32(len(defs))), defs...)
+	return testPage{typ: pqDataPage, n: 3, encoding: encoding, raw: append(data, raw...)}
+}
+
+// TestParquetPyarrowLayout reads file laid out as pandas to_parquet with pyarrow defaults writes it:
+// nullable columns, every column dictionary encoded and snappy compressed, nanosecond timestamps,
+// statistics, arrow schema metadata and index column
+func TestParquetPyarrowLayout(t *testing.T) {
+	file := bytes.NewBufferString("PAR1")
+
+	day1, day2 := time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC), time.Date(2024, 1, 12, 0, 0, 0, 0, time.UTC)
+	dict := binary.LittleEndian.AppendUint64(nil, uint64(day1.UnixNano()))
+	dict = binary.LittleEndian.AppendUint64(dict, uint64(day2.UnixNano()))
+	tsChunk := writeChunk(file, pqInt64, "ts", pqSnappy,
+		testPage{typ: pqDictionaryPage, n: 2, raw: dict},
+		optionalPage(pqRLEDictionary, nil, []byte{1, 1<<1 | 1, 0b110}))
+
+	dict = append(binary.LittleEndian.AppendUint32(nil, 1), 'a')
+	dict = append(binary.LittleEndian.AppendUint32(dict, 1), 'b')
+	idChunk := writeChunk(file, pqByteArray, "instrument_id", pqSnappy,
+		testPage{typ: pqDictionaryPage, n: 2, raw: dict},
+		optionalPage(pqRLEDictionary, nil, []byte{1, 1<<1 | 1, 0b100}))
+
+	dict = binary.LittleEndian.AppendUint64(nil, math.Float64bits(1))
+	dict = binary.LittleEndian.AppendUint64(dict, math.Float64bits(2))
+	scoreChunk := writeChunk(file, pqDouble, "score", pqSnappy,
+		testPage{typ: pqDictionaryPage, n: 2, raw: dict},
+		optionalPage(pqRLEDictionary, []byte{1<<1 | 1, 0b011}, []byte{1, 1<<1 | 1, 0b10}))
+
+	var index []byte
+	for _, v := range []uint64{10, 11, 12} {
+		index = binary.LittleEndian.AppendUint64(index, v)
+	}
+	indexChunk := writeChunk(file, pqInt64, "__index_level_0__", pqSnappy, optionalPage(pqPlain, nil, index))
+
+	// statistics and encoding stats of chunk aren't used by reader
+	for _, c := range [][]tfield{tsChunk, idChunk, scoreChunk, indexChunk} {
+		c[1].v = append(c[1].v.([]tfield),
+			tfield{12, []tfield{{3, int64(0)}, {5, "\x02"}, {6, "\x01"}}},
+			tfield{13, tlist{tStruct, []any{[]tfield{{1, int32(pqDataPage)}, {2, int32(pqRLEDictionary)}, {3, int32(1)}}}}},
+		)
+	}
+
+	var meta bytes.Buffer
+	writeThrift(&meta,
+		tfield{1, int32(2)},
+		tfield{2, tlist{tStruct, []any{
+			[]tfield{{4, "schema"}, {5, int32(4)}},
+			[]tfield{{1, int32(pqInt64)}, {3, int32(pqOptional)}, {4, "ts"}, {10, []tfield{{8, []tfield{{1, false}, {2, []tfield{{3, []tfield{}}}}}}}}},
+			[]tfield{{1, int32(pqByteArray)}, {3, int32(pqOptional)}, {4, "instrument_id"}, {6, int32(0)}, {10, []tfield{{1, []tfield{}}}}},
+			[]tfield{{1, int32(pqDouble)}, {3, int32(pqOptional)}, {4, "score"}},
+			[]tfield{{1, int32(pqInt64)}, {3, int32(pqOptional)}, {4, "__index_level_0__"}, {10, []tfield{{10, []tfield{{1, int32(64)}, {2, true}}}}}},
+		}}},
+		tfield{3, int64(3)},
+		tfield{4, tlist{tStruct, []any{
+			[]tfield{{1, tlist{tStruct, []any{tsChunk, idChunk, scoreChunk, indexChunk}}}, {2, int64(file.Len())}, {3, int64(3)}, {5, int64(4)}, {7, int16(0)}},
+		}}},
+		// long arrow schema takes multibyte length
+		tfield{5, tlist{tStruct, []any{
+			[]tfield{{1, "pandas"}, {2, `{"index_columns": ["__index_level_0__"], "column_indexes": [], "columns": []}`}},
+			[]tfield{{1, "ARROW:schema"}, {2, string(bytes.Repeat([]byte("/////w=="), 64))}},
+		}}},
+		tfield{6, "parquet-cpp-arrow version 15.0.2"},
+		tfield{7, tlist{tStruct, []any{[]tfield{{1, []tfield{}}}, []tfield{{1, []tfield{}}}, []tfield{{1, []tfield{}}}, []tfield{{1, []tfield{}}}}}},
+	)
+	file.Write(meta.Bytes())
+	file.Write(binary.LittleEndian.AppendUint32(nil, uint32(meta.Len())))
+	file.WriteString("PAR1")
+
+	checkScores(t, file.Bytes())
+}
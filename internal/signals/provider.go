@@ -0,0 +1,39 @@
+package signals
+
+import (
+	"fmt"
+
+	"github.com/STTM-NSU/trading-bot/internal/config"
+	"github.com/STTM-NSU/trading-bot/internal/sttm"
+)
+
+// NewProvider builds provider from config, sttm service is used by sttm providers only
+func NewProvider(cfg config.SignalConfig, s *sttm.STTMService, prices PriceSource) (Provider, error) {
+	cfg.Setup()
+
+	switch cfg.Provider {
+	case config.STTMSignal:
+		return NewSTTM(s), nil
+	case config.FileSignal:
+		if cfg.File == "" {
+			return nil, fmt.Errorf("empty scores file")
+		}
+		return LoadFile(cfg.File)
+	case config.MomentumSignal:
+		return NewMomentum(prices, cfg.Lookback), nil
+	case config.CompositeSignal:
+		if len(cfg.Parts) == 0 {
+			return nil, fmt.Errorf("empty composite parts")
+		}
+		parts := make([]Weighted, 0, len(cfg.Parts))
+		for _, partCfg := range cfg.Parts {
+			p, err := NewProvider(partCfg, s, prices)
+			if err != nil {
+				return nil, fmt.Errorf("%w: can't build %s part", err, partCfg.Provider)
+			}
+			parts = append(parts, Weighted{Provider: p, Weight: partCfg.Weight})
+		}
+		return NewComposite(parts...), nil
+	}
+	return nil, fmt.Errorf("unknown signal provider: %s", cfg.Provider)
+}
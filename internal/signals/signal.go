@@ -0,0 +1,54 @@
+package signals
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+)
+
+var ErrNoScore = errors.New("instrument isn't scored")
+
+// Provider scores instruments over rebalance window, instruments with higher scores are ranked higher
+type Provider interface {
+	Scores(ctx context.Context, from, to time.Time, instrumentIds ...string) (Scores, error)
+}
+
+// Scores are scores by instrument id, not scored instruments have errors instead
+type Scores struct {
+	Values map[string]float64
+	Errors map[string]error
+}
+
+func newScores(n int) Scores {
+	return Scores{
+		Values: make(map[string]float64, n),
+		Errors: make(map[string]error),
+	}
+}
+
+// Normalize returns z-scores of values, so scores of different providers have the same scale
+func Normalize(values map[string]float64) map[string]float64 {
+	if len(values) == 0 {
+		return nil
+	}
+	var mean, sq float64
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+	for _, v := range values {
+		sq += (v - mean) * (v - mean)
+	}
+	std := math.Sqrt(sq / float64(len(values)))
+
+	res := make(map[string]float64, len(values))
+	for id, v := range values {
+		if std == 0 {
+			res[id] = 0
+			continue
+		}
+		res[id] = (v - mean) / std
+	}
+	return res
+}
@@ -0,0 +1,99 @@
+package signals
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/STTM-NSU/trading-bot/internal/model"
+)
+
+type fixed map[string]float64
+
+func (f fixed) Scores(_ context.Context, _, _ time.Time, _ ...string) (Scores, error) {
+	return Scores{Values: f}, nil
+}
+
+func TestNormalize(t *testing.T) {
+	z := Normalize(map[string]float64{"a": 1, "b": 3})
+	if z["a"] != -1 || z["b"] != 1 {
+		t.Errorf("unexpected z-scores %v", z)
+	}
+	if z := Normalize(map[string]float64{"a": 5}); z["a"] != 0 {
+		t.Errorf("single value must be zero, got %v", z)
+	}
+}
+
+func TestFile(t *testing.T) {
+	f, err := ReadFile(strings.NewReader("ts,instrument_id,score\n2024-01-05,a,1\n2024-01-12,a,2\n2024-01-12,b,3\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scores, err := f.Scores(context.Background(), time.Time{}, time.Date(2024, 1, 10, 20, 0, 0, 0, time.UTC), "a", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scores.Values["a"] != 1 {
+		t.Errorf("the latest score before window end is expected, got %v", scores.Values["a"])
+	}
+	if !errors.Is(scores.Errors["b"], ErrNoScore) {
+		t.Errorf("future score mustn't be used, got %v", scores.Values["b"])
+	}
+}
+
+func TestComposite(t *testing.T) {
+	c := NewComposite(
+		Weighted{Provider: fixed{"a": 100, "b": -100}, Weight: 3},
+		Weighted{Provider: fixed{"a": -0.1, "b": 0.1, "c": 0.3}, Weight: 1},
+	)
+	scores, err := c.Scores(context.Background(), time.Time{}, time.Time{}, "a", "b", "c", "d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scores.Values["a"] <= scores.Values["b"] {
+		t.Errorf("heavier provider must win: %v", scores.Values)
+	}
+	if _, ok := scores.Values["c"]; !ok || math.IsNaN(scores.Values["c"]) {
+		t.Errorf("c must be scored by the second provider only")
+	}
+	if !errors.Is(scores.Errors["d"], ErrNoScore) {
+		t.Errorf("d mustn't be scored, got %v", scores.Errors["d"])
+	}
+}
+
+type testCandles map[string][]model.Candle
+
+func (c testCandles) GetAdjustedCandlesFor(instrumentId string, from, to time.Time) ([]model.Candle, error) {
+	var res []model.Candle
+	for _, candle := range c[instrumentId] {
+		if !candle.Ts.Before(from) && !candle.Ts.After(to) {
+			res = append(res, candle)
+		}
+	}
+	return res, nil
+}
+
+func TestMomentum(t *testing.T) {
+	from := time.Date(2024, 1, 8, 10, 0, 0, 0, time.UTC)
+	to := from.Add(7 * 24 * time.Hour)
+	// a is split 2:1 in window, so its start price is adjusted from 100 to 50
+	m := NewMomentum(testCandles{
+		"a": {{Ts: from.Add(-65 * time.Hour), ClosePrice: 50}, {Ts: to.Add(-time.Hour), ClosePrice: 55}, {Ts: to.Add(time.Hour), ClosePrice: 70}},
+		"b": {{Ts: from.Add(time.Hour), ClosePrice: 10}},
+	}, 0)
+
+	scores, err := m.Scores(context.Background(), from, to, "a", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(scores.Values["a"]-0.1) > 1e-9 {
+		t.Errorf("unexpected momentum of a %v", scores.Values["a"])
+	}
+	if !errors.Is(scores.Errors["b"], ErrNoScore) {
+		t.Errorf("b has no start price, got %v", scores.Values["b"])
+	}
+}
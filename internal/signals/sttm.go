@@ -0,0 +1,26 @@
+package signals
+
+import (
+	"context"
+	"time"
+
+	"github.com/STTM-NSU/trading-bot/internal/sttm"
+)
+
+// STTM scores instruments by sttm index of news
+type STTM struct {
+	s *sttm.STTMService
+}
+
+func NewSTTM(s *sttm.STTMService) STTM {
+	return STTM{s: s}
+}
+
+func (p STTM) Scores(ctx context.Context, from, to time.Time, instrumentIds ...string) (Scores, error) {
+	from, to = sttm.IndexWindow(from, to)
+	indexes, err := p.s.GetIndexes(ctx, from, to, instrumentIds...)
+	if err != nil {
+		return Scores{}, err
+	}
+	return Scores{Values: indexes.Values, Errors: indexes.Errors}, nil
+}
@@ -0,0 +1,58 @@
+package strategy
+
+import (
+	"time"
+
+	"github.com/STTM-NSU/trading-bot/internal/config"
+	"github.com/STTM-NSU/trading-bot/internal/model"
+	"github.com/STTM-NSU/trading-bot/internal/signals"
+)
+
+// MarketData returns price of instrument on ts, live implementations return the latest price
+type MarketData interface {
+	GetLastPriceOn(instrumentId string, ts time.Time) (float64, error)
+}
+
+// Indicators return sell signals of technical indicators
+type Indicators interface {
+	GetEMAMACDSignal(i model.PortfolioInstrument, price float64, from time.Time) (bool, error)
+	GetRSIBBSignal(i model.PortfolioInstrument, price float64, from time.Time) (bool, error)
+}
+
+// Signals are scores for ranking, e.g. sttm indexes, and technical indicators
+type Signals interface {
+	signals.Provider
+	Indicators
+}
+
+// Execution places orders, simulated implementation fills them on candles
+// and live one sends them to the broker
+type Execution interface {
+	Buy(quantity, price float64, i model.Instrument)
+	Sell(price float64, i model.PortfolioInstrument, cfg config.OrderConfig)
+	Short(quantity, price float64, i model.Instrument, cfg config.MarginTradingConfig)
+	CancelBuys()  // partially filled buys stay in portfolio
+	CoverShorts() // buy out all shorts
+	SellOut()     // sell instruments with not filled sell orders by market
+	Liquidate()   // sell the whole portfolio
+}
+
+// NotTradable is optional for Execution, instruments which broker refused to trade are skipped in top
+type NotTradable interface {
+	IsNotTradable(instrumentId string) bool
+}
+
+type Portfolio interface {
+	GetBalance() float64
+	GetInstruments() map[string]model.PortfolioInstrument // instrument uid -> instrument
+}
+
+type Instruments interface {
+	LoadInstruments(cfg config.Instruments) ([]model.Instrument, error)
+}
+
+// CombinedSignals takes scores from provider and indicators from technical analysis service
+type CombinedSignals struct {
+	signals.Provider
+	Indicators
+}
@@ -0,0 +1,385 @@
+package strategy
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/STTM-NSU/trading-bot/internal/config"
+	"github.com/STTM-NSU/trading-bot/internal/logger"
+	"github.com/STTM-NSU/trading-bot/internal/model"
+)
+
+// STTM buys instruments from the top of sttm indexes, sells instruments which left the top
+// and shorts instruments which fell from the top to the bottom if margin trading is enabled
+type STTM struct {
+	logger logger.Logger
+
+	instruments    Instruments
+	cfgInstruments config.Instruments
+
+	marketData MarketData
+	signals    Signals
+	execution  Execution
+	portfolio  Portfolio
+
+	sttmCfg   config.STTMConfig
+	ordersCfg config.OrdersConfig
+	marginCfg config.MarginTradingConfig
+
+	lastRebalanceIndexes map[string]float64
+}
+
+func NewSTTM(logger logger.Logger,
+	instruments Instruments,
+	cfgInstruments config.Instruments,
+	marketData MarketData,
+	signals Signals,
+	execution Execution,
+	portfolio Portfolio,
+	sttmCfg config.STTMConfig,
+	ordersCfg config.OrdersConfig,
+	marginCfg config.MarginTradingConfig,
+) *STTM {
+	return &STTM{
+		logger:         logger,
+		instruments:    instruments,
+		cfgInstruments: cfgInstruments,
+		marketData:     marketData,
+		signals:        signals,
+		execution:      execution,
+		portfolio:      portfolio,
+		sttmCfg:        sttmCfg,
+		ordersCfg:      ordersCfg,
+		marginCfg:      marginCfg,
+	}
+}
+
+// Liquidate cancels buy orders and sells the whole portfolio
+func (t *STTM) Liquidate() {
+	t.execution.CancelBuys()
+	t.execution.Liquidate()
+}
+
+// CloseSession sells instruments with not filled sell orders and covers shorts before the next rebalance
+func (t *STTM) CloseSession() {
+	t.execution.SellOut()
+	t.execution.CoverShorts()
+}
+
+func (t *STTM) lastPrice(figi string, ts time.Time) (float64, bool) {
+	price, err := t.marketData.GetLastPriceOn(figi, ts)
+	if err != nil {
+		t.logger.Errorf("GetLastPriceOn %s: %s", figi, err)
+		return 0, false
+	}
+	return price, true
+}
+
+func (t *STTM) CheckTechIndicators(currentTime time.Time) {
+	instruments := t.portfolio.GetInstruments()
+
+	for _, instr := range instruments {
+		price, err := t.marketData.GetLastPriceOn(instr.FIGI, currentTime)
+		if err != nil {
+			t.logger.Errorf("GetLastPriceOn techan check err: %v", err)
+			continue
+		}
+
+		sellSignalEMAMACD, err := t.signals.GetEMAMACDSignal(instr, price, currentTime)
+		if err != nil {
+			t.logger.Errorf("%s: can't get sell signal ema macd", err)
+			continue
+		}
+		if sellSignalEMAMACD {
+			t.logger.Infof("%s: techan signal ema macd", instr.InstrumentID)
+			t.execution.Sell(price, instr, t.ordersCfg.SellOrder)
+		}
+
+		sellSignalRSIBB, err := t.signals.GetRSIBBSignal(instr, price, currentTime)
+		if err != nil {
+			t.logger.Errorf("%s: can't get sell signal rsi bb", err)
+			continue
+		}
+		if !sellSignalEMAMACD && sellSignalRSIBB {
+			t.logger.Infof("%s: techan signal rsi bb", instr.InstrumentID)
+			t.execution.Sell(price, instr, t.ordersCfg.SellOrder)
+		}
+	}
+}
+
+func toMap[T interface{ GetUID() string }](arr []T) map[string]T {
+	m := make(map[string]T)
+	for _, i := range arr {
+		m[i.GetUID()] = i
+	}
+	return m
+}
+
+func fromMap[T interface{ GetUID() string }](m map[string]T) []T {
+	arr := make([]T, 0, len(m))
+	for _, i := range m {
+		arr = append(arr, i)
+	}
+	return arr
+}
+
+func GetSellProfitSellBuyInstruments(top []model.Instrument, portMap map[string]model.PortfolioInstrument) (
+	[]model.PortfolioInstrument,
+	[]model.PortfolioInstrument,
+	[]model.Instrument,
+) {
+	topMap := toMap(top)
+
+	sellProfit := make([]model.PortfolioInstrument, 0)
+	sell := make([]model.PortfolioInstrument, 0)
+	buy := make([]model.Instrument, 0)
+
+	for id, t := range topMap {
+		if v, ok := portMap[id]; ok {
+			sellProfit = append(sellProfit, v)
+		} else {
+			buy = append(buy, t)
+		}
+	}
+	for id, p := range portMap {
+		if _, ok := topMap[id]; !ok {
+			sell = append(sell, p)
+		}
+	}
+
+	return sellProfit, sell, buy
+}
+
+func (t *STTM) Rebalance(ctx context.Context, from, to time.Time) error {
+	topCasualInstruments, topMarginInstruments, err := t.GetRebalancedTopInstruments(ctx, from, to)
+	if err != nil {
+		return fmt.Errorf("GetRebalanceTopInstruments: %w", err)
+	}
+	t.logger.Infof("Top instruments: %v", len(topCasualInstruments))
+	if t.marginCfg.Enabled {
+		t.logger.Infof("Margin instruments: %v", len(topMarginInstruments))
+	}
+
+	portfolioInstruments := t.portfolio.GetInstruments()
+	sellProfit, sell, buy := GetSellProfitSellBuyInstruments(topCasualInstruments, portfolioInstruments)
+	t.logger.Infof("sellProfit: %v sell: %v buy: %v", len(sellProfit), len(sell), len(buy))
+	t.logger.Infof("more info sellProfit: %v sell: %v buy: %v", sellProfit, sell, buy)
+
+	// partially filled buy orders must be tracked for selling before placing sell orders
+	t.execution.CancelBuys()
+
+	for _, i := range sellProfit {
+		if price, ok := t.lastPrice(i.FIGI, to); ok {
+			t.execution.Sell(price, i, t.ordersCfg.SellOutProfit)
+		}
+	}
+	t.logger.Infof("sellProfit requested")
+
+	for _, i := range sell {
+		if price, ok := t.lastPrice(i.FIGI, to); ok {
+			t.execution.Sell(price, i, t.ordersCfg.SellOrder)
+		}
+	}
+
+	t.logger.Infof("sellMarket requested")
+
+	if err := t.BuyInstruments(buy, to); err != nil {
+		return fmt.Errorf("BuyInstruments: %w", err)
+	}
+	t.logger.Infof("BuyInstruments requested")
+
+	if t.marginCfg.Enabled {
+		if err := t.MarginSell(topMarginInstruments, to); err != nil {
+			return fmt.Errorf("MarginSell: %w", err)
+		}
+		t.logger.Infof("MarginSell requested")
+	}
+
+	return nil
+}
+
+func (t *STTM) MarginSell(instruments []model.Instrument, to time.Time) error {
+	lastPrices := make(map[string]float64)
+	for _, i := range instruments {
+		lp, err := t.marketData.GetLastPriceOn(i.FIGI, to)
+		if err != nil {
+			t.logger.Errorf("GetLastPriceOn margin sell: %s", err)
+			continue
+		}
+		lastPrices[i.UID] = lp
+	}
+	if len(lastPrices) == 0 {
+		return nil
+	}
+
+	instrumentsQuantities := spreadLots(instruments, lastPrices, t.portfolio.GetBalance())
+
+	for _, instr := range instruments {
+		t.execution.Short(max(instrumentsQuantities[instr.UID]-1, 0), lastPrices[instr.UID], instr, t.marginCfg)
+	}
+
+	return nil
+}
+
+func (t *STTM) BuyInstruments(instruments []model.Instrument, to time.Time) error {
+	lastPrices := make(map[string]float64)
+	for _, i := range instruments {
+		lp, err := t.marketData.GetLastPriceOn(i.FIGI, to)
+		if err != nil {
+			t.logger.Errorf("GetLastPriceOn buy instr: %s", err)
+			continue
+		}
+		lastPrices[i.UID] = lp
+	}
+	if len(lastPrices) == 0 {
+		return nil
+	}
+
+	// lots are spread round-robin and every instrument is bought by one order
+	instrumentsQuantities := spreadLots(instruments, lastPrices, t.portfolio.GetBalance())
+
+	for _, instr := range instruments {
+		if q := instrumentsQuantities[instr.UID]; q > 0 {
+			t.execution.Buy(q, lastPrices[instr.UID], instr)
+		}
+	}
+	return nil
+}
+
+// spreadLots adds lots round-robin while they fit into balance, instruments without positive price are skipped
+func spreadLots(instruments []model.Instrument, lastPrices map[string]float64, balance float64) map[string]float64 {
+	quantities := make(map[string]float64, len(instruments))
+	sum := 0.0
+	for added := true; added; {
+		added = false
+		for _, instr := range instruments {
+			price := lastPrices[instr.UID] * float64(instr.Lot)
+			if price <= 0 {
+				continue
+			}
+			if sum+price > balance {
+				return quantities
+			}
+			quantities[instr.UID]++
+			sum += price
+			added = true
+		}
+	}
+	return quantities
+}
+
+// GetRebalancedTopInstruments returns top for casual trading and for margin trading
+func (t *STTM) GetRebalancedTopInstruments(ctx context.Context, from, to time.Time) ([]model.Instrument, []model.Instrument, error) {
+	instrs, err := t.instruments.LoadInstruments(t.cfgInstruments)
+	if err != nil {
+		return nil, nil, fmt.Errorf("LoadInstruments: %v", err)
+	}
+	t.logger.Infof("loaded instruments: %v", len(instrs))
+
+	portfolioInstruments := t.portfolio.GetInstruments()
+	availableBalance := t.portfolio.GetBalance()
+
+	// get instruments that we available to buy
+	instruments := make([]model.Instrument, 0, len(instrs))
+	notTradable, _ := t.execution.(NotTradable)
+	for _, i := range instrs {
+		if notTradable != nil && notTradable.IsNotTradable(i.UID) {
+			t.logger.Infof("instrument %s isn't tradable, skip it", i.UID)
+			continue
+		}
+		lastPrice, err := t.marketData.GetLastPriceOn(i.FIGI, to)
+		if err != nil {
+			// t.logger.Errorf("GetLastPriceOn: %v", err)
+			continue
+		}
+		if _, ok := portfolioInstruments[i.UID]; lastPrice*float64(i.Lot) > availableBalance && !ok {
+			t.logger.Infof("last price: %v > %v", lastPrice*float64(i.Lot), availableBalance)
+			continue
+		}
+		instruments = append(instruments, i)
+	}
+
+	t.logger.Infof("try to get scores for %v instruments", len(instruments))
+	sttmCfg := t.sttmCfg
+
+	// get STTM indexes for instruments ids
+	indexes := make(map[string]float64, len(instruments))
+	instrumentsIds := func() []string {
+		ids := make([]string, 0, len(instruments))
+		for _, i := range instruments {
+			ids = append(ids, i.FIGI)
+		}
+		return ids
+	}()
+	indexesApi, err := t.signals.Scores(ctx, from, to, instrumentsIds...)
+	if err != nil {
+		t.logger.Errorf("GetIndex: %v", err)
+		return nil, nil, err
+	}
+
+	t.logger.Infof("got scores: %v, failed: %v", len(indexesApi.Values), len(indexesApi.Errors))
+
+	// instruments without score aren't ranked
+	instruments = slices.DeleteFunc(instruments, func(i model.Instrument) bool {
+		index, ok := indexesApi.Values[i.FIGI]
+		if !ok {
+			t.logger.Warnf("no score for %v: %v", i.FIGI, indexesApi.Errors[i.FIGI])
+			return true
+		}
+		indexes[i.UID] = index
+		return false
+	})
+
+	slices.SortFunc(instruments, func(a, b model.Instrument) int {
+		if indexes[a.UID] > indexes[b.UID] {
+			return -1
+		} else if indexes[a.UID] < indexes[b.UID] {
+			return 1
+		}
+		return 0
+	})
+
+	for _, i := range instruments {
+		t.logger.Infof("instrument index: %v = %f", i.FIGI, indexes[i.UID])
+	}
+
+	// top percent is calculated relative to overall number of instruments
+	topNCasual := int(float64(len(instruments)) * sttmCfg.TopSTTMPercent) // less than instruments len
+
+	topCasualInstruments := make([]model.Instrument, 0, topNCasual)
+	for i := range topNCasual {
+		if indexes[instruments[i].UID] < sttmCfg.TopSTTMThreshold {
+			continue
+		}
+		topCasualInstruments = append(topCasualInstruments, instruments[i])
+	}
+	t.logger.Infof("top casual indexes [%d of %d]: %v", len(topCasualInstruments), len(instruments), topCasualInstruments)
+
+	if t.marginCfg.Enabled {
+		if t.lastRebalanceIndexes == nil {
+			t.lastRebalanceIndexes = indexes
+			return topCasualInstruments, nil, nil
+		}
+		topNMargin := int(float64(len(instruments)) * t.marginCfg.STTMTop)
+		topMarginInstruments := make([]model.Instrument, 0, topNMargin)
+		for i := range topNMargin {
+			idx := len(instruments) - 1 - i
+			// we need instruments that were greater than STTMUpperThreshold last time
+			if t.lastRebalanceIndexes[instruments[idx].UID] < t.marginCfg.STTMUpperThreshold {
+				continue
+			}
+			// but now lower than STTMThreshold
+			if indexes[instruments[idx].UID] > t.marginCfg.STTMThreshold {
+				continue
+			}
+			topMarginInstruments = append(topMarginInstruments, instruments[idx])
+		}
+		t.lastRebalanceIndexes = indexes
+		t.logger.Infof("top margin indexes [%d of %d]: %v", len(topMarginInstruments), len(instruments), topMarginInstruments)
+		return topCasualInstruments, topMarginInstruments, nil
+	}
+
+	return topCasualInstruments, nil, nil
+}
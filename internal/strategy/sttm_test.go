@@ -0,0 +1,21 @@
+package strategy
+
+import (
+	"testing"
+
+	"github.com/STTM-NSU/trading-bot/internal/model"
+)
+
+func TestSpreadLots(t *testing.T) {
+	instruments := []model.Instrument{{UID: "a", Lot: 1}, {UID: "b", Lot: 10}, {UID: "c", Lot: 1}}
+
+	q := spreadLots(instruments, map[string]float64{"a": 10, "b": 1, "c": 0}, 45)
+	if q["a"] != 2 || q["b"] != 2 || q["c"] != 0 {
+		t.Fatalf("unexpected quantities: %v", q)
+	}
+
+	// zero and missing prices must not loop forever
+	if q := spreadLots(instruments, map[string]float64{"c": 0}, 100); len(q) != 0 {
+		t.Fatalf("unexpected quantities: %v", q)
+	}
+}
@@ -0,0 +1,72 @@
+package sttm
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/STTM-NSU/trading-bot/internal/model"
+	"github.com/lib/pq"
+)
+
+// indexes are cached by instrument, window and hyperparameters formatted as in request
+const (
+	_queryIndexes = `SELECT instrument_id, sttm_index, index_p_value, news_count FROM sttm_indexes
+						WHERE ts_from = $1 AND ts_to = $2 AND alpha = $3 AND p_value = $4 AND threshold = $5
+							AND instrument_id = ANY($6)`
+	_updateIndexes = `INSERT INTO sttm_indexes (
+								instrument_id,
+								ts_from,
+								ts_to,
+								alpha,
+								p_value,
+								threshold,
+								sttm_index,
+								index_p_value,
+								news_count
+							) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
+							ON CONFLICT (instrument_id, ts_from, ts_to, alpha, p_value, threshold)
+							DO UPDATE SET
+								sttm_index = EXCLUDED.sttm_index,
+								index_p_value = EXCLUDED.index_p_value,
+								news_count = EXCLUDED.news_count;`
+)
+
+func (s *STTMService) getCached(ctx context.Context, from, to time.Time, instrumentIds []string) (map[string]model.STTMIndex, error) {
+	var rows []struct {
+		InstrumentID string  `db:"instrument_id"`
+		Index        float64 `db:"sttm_index"`
+		PValue       float64 `db:"index_p_value"`
+		NewsCount    int     `db:"news_count"`
+	}
+	alpha, pValue, threshold := s.hyperparameters()
+	if err := s.db.SelectContext(ctx, &rows, _queryIndexes, from.UTC(), to.UTC(), alpha, pValue, threshold, pq.Array(instrumentIds)); err != nil {
+		return nil, fmt.Errorf("%w: can't query cached sttm indexes", err)
+	}
+
+	indexes := make(map[string]model.STTMIndex, len(rows))
+	for _, r := range rows {
+		indexes[r.InstrumentID] = model.STTMIndex{Index: r.Index, PValue: r.PValue, NewsCount: r.NewsCount}
+	}
+	return indexes, nil
+}
+
+func (s *STTMService) cache(ctx context.Context, from, to time.Time, indexes map[string]model.STTMIndex) error {
+	alpha, pValue, threshold := s.hyperparameters()
+	for id, index := range indexes {
+		if _, err := s.db.ExecContext(ctx, _updateIndexes,
+			id,
+			from.UTC(),
+			to.UTC(),
+			alpha,
+			pValue,
+			threshold,
+			index.Index,
+			index.PValue,
+			index.NewsCount,
+		); err != nil {
+			return fmt.Errorf("%w: can't cache sttm index", err)
+		}
+	}
+	return nil
+}
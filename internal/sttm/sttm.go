@@ -2,14 +2,18 @@ package sttm
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/STTM-NSU/trading-bot/internal/config"
 	"github.com/STTM-NSU/trading-bot/internal/logger"
 	"github.com/STTM-NSU/trading-bot/internal/model"
+	"github.com/jmoiron/sqlx"
 	"resty.dev/v3"
 )
 
@@ -17,22 +21,32 @@ const (
 	_sttmIndexURL = "/get-index"
 )
 
+var (
+	errUnavailable  = errors.New("sttm service is unavailable")
+	ErrMissingIndex = errors.New("sttm index isn't returned")
+)
+
 type STTMService struct {
-	c   *resty.Client
-	cfg config.STTMConfig
+	c       *resty.Client
+	db      *sqlx.DB // cache of indexes, nil for no cache
+	cfg     config.STTMConfig
+	breaker *Breaker
 
 	logger logger.Logger
 }
 
-func NewSTTMService(cfg config.STTMConfig, logger logger.Logger) *STTMService {
+func NewSTTMService(cfg config.STTMConfig, db *sqlx.DB, logger logger.Logger) *STTMService {
+	cfg.Client.Setup() // backtest config isn't set up
 	client := resty.New().
 		SetLogger(logger).
 		SetBaseURL(cfg.Address)
 
 	return &STTMService{
-		c:      client,
-		cfg:    cfg,
-		logger: logger,
+		c:       client,
+		db:      db,
+		cfg:     cfg,
+		breaker: NewBreaker(cfg.Client.BreakerFailures, cfg.Client.BreakerCooldown),
+		logger:  logger,
 	}
 }
 
@@ -40,18 +54,226 @@ func (s *STTMService) GetConfig() config.STTMConfig {
 	return s.cfg
 }
 
-// curl -X GET "http://192.168.0.24:8000/get-index?instrument_ids=BBG004730N88,BBG004730N88,BBG004730N88&from=2022-11-04T00:00:00&to=2022-11-05T00:00:00&alpha=0.05&p_value=0.05&threshold=0.3" -H "accept: application/json"
-func (s *STTMService) GetIndexes(ctx context.Context, from, to time.Time, instrumentIds ...string) ([]float64, time.Duration, error) {
+// Indexes are sttm indexes by instrument id, instruments of failed batches or not answered ones have errors instead
+type Indexes struct {
+	Values map[string]float64
+	Meta   map[string]model.STTMIndex // p-value and news count are zero for old service versions
+	Errors map[string]error
+}
+
+// GetIndexes reads indexes from cache and requests missed ones by batches in parallel,
+// got indexes are cached. Error is returned only if no index is got
+func (s *STTMService) GetIndexes(ctx context.Context, from, to time.Time, instrumentIds ...string) (Indexes, error) {
 	if from.After(to) {
-		return nil, 0, fmt.Errorf("invalid interval")
+		return Indexes{}, fmt.Errorf("invalid interval")
 	}
 	if to.Sub(from).Hours() < 24 {
-		return nil, 0, fmt.Errorf("interval must be at least one day")
+		return Indexes{}, fmt.Errorf("interval must be at least one day")
 	}
 	if len(instrumentIds) == 0 {
-		return nil, 0, fmt.Errorf("empty ids")
+		return Indexes{}, fmt.Errorf("empty ids")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.Client.MaxWait)
+	defer cancel()
+
+	res := Indexes{
+		Values: make(map[string]float64, len(instrumentIds)),
+		Meta:   make(map[string]model.STTMIndex),
+		Errors: make(map[string]error),
+	}
+	missed := instrumentIds
+	if s.db != nil {
+		cached, err := s.getCached(ctx, from, to, instrumentIds)
+		if err != nil {
+			s.logger.Warnf("%s: sttm cache is skipped", err)
+		}
+		missed = make([]string, 0, len(instrumentIds))
+		for _, id := range instrumentIds {
+			index, ok := cached[id]
+			if !ok {
+				missed = append(missed, id)
+				continue
+			}
+			res.Values[id], res.Meta[id] = index.Index, index
+		}
+		s.logger.Debugf("sttm cache: %d of %d indexes are cached", len(instrumentIds)-len(missed), len(instrumentIds))
 	}
 
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		lastErr error
+		fetched = make(map[string]model.STTMIndex, len(missed))
+		sem     = make(chan struct{}, s.cfg.Client.Parallel)
+	)
+	for _, batch := range Batches(missed, s.cfg.Client.BatchSize) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			resp, err := s.getBatch(ctx, from, to, batch)
+			var (
+				indexes map[string]model.STTMIndex
+				missing map[string]error
+			)
+			if err == nil {
+				indexes, missing, err = MatchIndexes(batch, resp)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				lastErr = err
+				for _, id := range batch {
+					res.Errors[id] = err
+				}
+				return
+			}
+			for id, err := range missing {
+				lastErr = err
+				res.Errors[id] = err
+			}
+			for id, index := range indexes {
+				res.Values[id], res.Meta[id] = index.Index, index
+				fetched[id] = index
+			}
+		}()
+	}
+	wg.Wait()
+
+	if s.db != nil && len(fetched) > 0 {
+		if err := s.cache(ctx, from, to, fetched); err != nil {
+			s.logger.Warnf("%s: sttm indexes aren't cached", err)
+		}
+	}
+
+	if len(res.Values) == 0 {
+		return res, fmt.Errorf("%w: can't get sttm indexes", lastErr)
+	}
+	return res, nil
+}
+
+// IndexWindow returns sttm calculation window of rebalance, the whole day of rebalance is included
+func IndexWindow(from, to time.Time) (time.Time, time.Time) {
+	return from, to.Add(24 * time.Hour).Truncate(24 * time.Hour)
+}
+
+// Window is interval of sttm index calculation
+type Window struct {
+	From, To time.Time
+}
+
+// Prewarm caches indexes of windows one by one, so repeated backtests don't request service,
+// windows which can't be calculated are skipped
+func (s *STTMService) Prewarm(ctx context.Context, windows []Window, instrumentIds ...string) error {
+	if s.db == nil {
+		return fmt.Errorf("sttm cache isn't configured")
+	}
+	for _, w := range windows {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		res, err := s.GetIndexes(ctx, w.From, w.To, instrumentIds...)
+		if err != nil {
+			s.logger.Warnf("%s: can't prewarm sttm indexes for [%s, %s]", err, w.From, w.To)
+			continue
+		}
+		s.logger.Infof("sttm indexes for [%s, %s] are prewarmed: %d, failed: %d", w.From, w.To, len(res.Values), len(res.Errors))
+	}
+	return nil
+}
+
+// getBatch retries batch while service asks to wait or is unavailable, until retries or wait time are exhausted
+func (s *STTMService) getBatch(ctx context.Context, from, to time.Time, instrumentIds []string) (model.STTMResponse, error) {
+	for attempt := 0; ; attempt++ {
+		if err := s.breaker.Allow(time.Now()); err != nil {
+			return model.STTMResponse{}, err
+		}
+
+		resp, retryAfter, err := s.requestIndexes(ctx, from, to, instrumentIds)
+		switch {
+		case err == nil:
+			s.breaker.Success()
+			return resp, nil
+		case ctx.Err() != nil:
+			s.breaker.Release()
+			return model.STTMResponse{}, fmt.Errorf("%w: sttm wait time is exceeded", err)
+		case retryAfter > 0: // index is being calculated
+			s.breaker.Success()
+		case errors.Is(err, errUnavailable):
+			s.breaker.Failure(time.Now())
+			retryAfter = s.cfg.Client.RetryDelay
+		default:
+			s.breaker.Release()
+			return model.STTMResponse{}, err
+		}
+
+		if attempt >= s.cfg.Client.MaxRetries {
+			return model.STTMResponse{}, fmt.Errorf("%w: sttm retries are exhausted", err)
+		}
+		s.logger.Infof("sttm: retry batch of %d instruments in %v", len(instrumentIds), retryAfter)
+		select {
+		case <-ctx.Done():
+			return model.STTMResponse{}, fmt.Errorf("%w: sttm wait time is exceeded", err)
+		case <-time.After(retryAfter):
+		}
+	}
+}
+
+// MatchIndexes maps response to requested ids. Keyed response is checked for every requested id,
+// not answered ids have ErrMissingIndex. Positional response is accepted only if it answers all ids,
+// so indexes are never shifted to other instruments
+func MatchIndexes(ids []string, resp model.STTMResponse) (map[string]model.STTMIndex, map[string]error, error) {
+	indexes := make(map[string]model.STTMIndex, len(ids))
+	missing := make(map[string]error)
+
+	if resp.Results != nil {
+		for _, id := range ids {
+			index, ok := resp.Results[id]
+			if !ok {
+				missing[id] = fmt.Errorf("%w: %s", ErrMissingIndex, id)
+				continue
+			}
+			indexes[id] = index
+		}
+		return indexes, missing, nil
+	}
+
+	if len(resp.Indexes) != len(ids) {
+		return nil, nil, fmt.Errorf("%w: sttm returned %d indexes for %d instruments", ErrMissingIndex, len(resp.Indexes), len(ids))
+	}
+	for k, id := range ids {
+		indexes[id] = model.STTMIndex{Index: resp.Indexes[k]}
+	}
+	return indexes, missing, nil
+}
+
+// Batches splits ids into batches of size at most
+func Batches(ids []string, size int) [][]string {
+	if size <= 0 {
+		size = max(len(ids), 1)
+	}
+	var batches [][]string
+	for len(ids) > 0 {
+		n := min(size, len(ids))
+		batches = append(batches, ids[:n:n])
+		ids = ids[n:]
+	}
+	return batches
+}
+
+func (s *STTMService) hyperparameters() (string, string, string) {
+	return strconv.FormatFloat(s.cfg.STTMHyperparameters.Alpha, 'f', 2, 64),
+		strconv.FormatFloat(s.cfg.STTMHyperparameters.PValue, 'f', 2, 64),
+		strconv.FormatFloat(s.cfg.STTMHyperparameters.Threshold, 'f', 2, 64)
+}
+
+// curl -X GET "http://192.168.0.24:8000/get-index?instrument_ids=BBG004730N88,BBG004730N88,BBG004730N88&from=2022-11-04T00:00:00&to=2022-11-05T00:00:00&alpha=0.05&p_value=0.05&threshold=0.3" -H "accept: application/json"
+func (s *STTMService) requestIndexes(ctx context.Context, from, to time.Time, instrumentIds []string) (model.STTMResponse, time.Duration, error) {
+	alpha, pValue, threshold := s.hyperparameters()
 	fromString := fmt.Sprintf("%s", from.UTC().Format(time.RFC3339))
 	fromString = fromString[:len(fromString)-1]
 	toString := fmt.Sprintf("%s", to.UTC().Format(time.RFC3339))
@@ -62,9 +284,10 @@ func (s *STTMService) GetIndexes(ctx context.Context, from, to time.Time, instru
 			"from":           fromString,
 			"to":             toString,
 			"instrument_ids": strings.Join(instrumentIds, ","),
-			"alpha":          strconv.FormatFloat(s.cfg.STTMHyperparameters.Alpha, 'f', 2, 64),
-			"p_value":        strconv.FormatFloat(s.cfg.STTMHyperparameters.PValue, 'f', 2, 64),
-			"threshold":      strconv.FormatFloat(s.cfg.STTMHyperparameters.Threshold, 'f', 2, 64),
+			"alpha":          alpha,
+			"p_value":        pValue,
+			"threshold":      threshold,
+			"format":         "keyed", // ignored by old service versions
 		}).
 		SetResult(&model.STTMResponse{}).
 		SetError(&model.STTMErrorResponse{}).
@@ -72,7 +295,7 @@ func (s *STTMService) GetIndexes(ctx context.Context, from, to time.Time, instru
 
 	resp, err := req.Get(_sttmIndexURL)
 	if err != nil {
-		return nil, 0, fmt.Errorf("%w: can't send request for  sttm index", err)
+		return model.STTMResponse{}, 0, fmt.Errorf("%w: %w: can't send request for sttm index", errUnavailable, err)
 	}
 	defer resp.Body.Close()
 
@@ -80,11 +303,17 @@ func (s *STTMService) GetIndexes(ctx context.Context, from, to time.Time, instru
 
 	if resp.IsError() {
 		response := resp.Error().(*model.STTMErrorResponse)
-		return nil, response.RetryAfter, fmt.Errorf("%s: sttm index request error", response.Message)
+		if response.RetryAfter == 0 && resp.StatusCode() >= 500 {
+			return model.STTMResponse{}, 0, fmt.Errorf("%w: %s: sttm index request error", errUnavailable, response.Message)
+		}
+		if response.RetryAfter == 0 && resp.StatusCode() == http.StatusTooManyRequests { // rate limited without hint
+			response.RetryAfter = s.cfg.Client.RetryDelay
+		}
+		return model.STTMResponse{}, response.RetryAfter, fmt.Errorf("%s: sttm index request error", response.Message)
 	}
 	if resp.IsSuccess() {
-		return resp.Result().(*model.STTMResponse).Indexes, 0, nil
+		return *resp.Result().(*model.STTMResponse), 0, nil
 	}
 
-	return nil, 0, fmt.Errorf("sttm index unexpected request error: %s", resp.Status())
+	return model.STTMResponse{}, 0, fmt.Errorf("sttm index unexpected request error: %s", resp.Status())
 }
@@ -0,0 +1,65 @@
+package sttm
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/STTM-NSU/trading-bot/internal/model"
+)
+
+func TestBatches(t *testing.T) {
+	batches := Batches([]string{"a", "b", "c", "d", "e"}, 2)
+	if len(batches) != 3 || len(batches[0]) != 2 || len(batches[2]) != 1 || batches[2][0] != "e" {
+		t.Errorf("unexpected batches %v", batches)
+	}
+	if batches := Batches([]string{"a", "b"}, 0); len(batches) != 1 {
+		t.Errorf("zero size must be one batch, got %v", batches)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	b := NewBreaker(2, time.Minute)
+	now := time.Now()
+
+	b.Failure(now)
+	if err := b.Allow(now); err != nil {
+		t.Errorf("breaker mustn't open before threshold")
+	}
+	b.Failure(now)
+	if err := b.Allow(now.Add(time.Second)); err == nil {
+		t.Errorf("breaker must be open")
+	}
+	if err := b.Allow(now.Add(time.Minute)); err != nil {
+		t.Errorf("trial request must be allowed after cooldown")
+	}
+	if err := b.Allow(now.Add(time.Minute)); err == nil {
+		t.Errorf("only one trial request is allowed")
+	}
+	b.Success()
+	if err := b.Allow(now.Add(time.Minute)); err != nil {
+		t.Errorf("breaker must be closed after success")
+	}
+}
+
+func TestMatchIndexes(t *testing.T) {
+	ids := []string{"a", "b", "c"}
+
+	indexes, missing, err := MatchIndexes(ids, model.STTMResponse{Results: map[string]model.STTMIndex{
+		"c": {Index: 0.3},
+		"a": {Index: 0.1},
+	}})
+	if err != nil || indexes["a"].Index != 0.1 || indexes["c"].Index != 0.3 {
+		t.Errorf("unexpected keyed indexes %v: %v", indexes, err)
+	}
+	if !errors.Is(missing["b"], ErrMissingIndex) || len(missing) != 1 {
+		t.Errorf("b must be missing, got %v", missing)
+	}
+
+	if _, _, err := MatchIndexes(ids, model.STTMResponse{Indexes: []float64{0.1, 0.2}}); !errors.Is(err, ErrMissingIndex) {
+		t.Errorf("short positional response mustn't be shifted, got %v", err)
+	}
+	if indexes, _, err := MatchIndexes(ids, model.STTMResponse{Indexes: []float64{0.1, 0.2, 0.3}}); err != nil || indexes["b"].Index != 0.2 {
+		t.Errorf("unexpected positional indexes %v: %v", indexes, err)
+	}
+}
@@ -0,0 +1,118 @@
+package stub
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/STTM-NSU/trading-bot/internal/logger"
+	"github.com/STTM-NSU/trading-bot/internal/model"
+)
+
+const _timeLayout = "2006-01-02T15:04:05"
+
+// Faults are injected by request number, so runs are reproducible, zero values disable faults
+type Faults struct {
+	RateLimitEvery int           // every n-th request gets 429
+	RetryAfter     time.Duration // of 429 responses
+	FailEvery      int           // every n-th request gets 500
+	DropEvery      int           // every n-th requested instrument isn't answered
+	Latency        time.Duration
+}
+
+// Handler implements /get-index of sttm service
+type Handler struct {
+	source Source
+	faults Faults
+	logger logger.Logger
+
+	requests atomic.Int64
+}
+
+func NewHandler(source Source, faults Faults, logger logger.Logger) *Handler {
+	return &Handler{
+		source: source,
+		faults: faults,
+		logger: logger,
+	}
+}
+
+// Mux returns mux with /get-index route
+func (h *Handler) Mux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("GET /get-index", h)
+	return mux
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n := h.requests.Add(1)
+	if h.faults.Latency > 0 {
+		time.Sleep(h.faults.Latency)
+	}
+
+	if every(n, h.faults.RateLimitEvery) {
+		writeError(w, http.StatusTooManyRequests, "index is being calculated", h.faults.RetryAfter)
+		return
+	}
+	if every(n, h.faults.FailEvery) {
+		writeError(w, http.StatusInternalServerError, "injected failure", 0)
+		return
+	}
+
+	q := r.URL.Query()
+	from, err := time.Parse(_timeLayout, q.Get("from"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid from", 0)
+		return
+	}
+	to, err := time.Parse(_timeLayout, q.Get("to"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid to", 0)
+		return
+	}
+	if !from.Before(to) {
+		writeError(w, http.StatusBadRequest, "invalid interval", 0)
+		return
+	}
+	ids := strings.Split(q.Get("instrument_ids"), ",")
+	if q.Get("instrument_ids") == "" {
+		writeError(w, http.StatusBadRequest, "empty instrument ids", 0)
+		return
+	}
+
+	keyed := q.Get("format") == "keyed"
+	resp := model.STTMResponse{}
+	if keyed {
+		resp.Results = make(map[string]model.STTMIndex, len(ids))
+	}
+	for k, id := range ids {
+		index, ok := h.source.Index(id, from, to)
+		if !ok || every(int64(k+1), h.faults.DropEvery) {
+			continue
+		}
+		if keyed {
+			resp.Results[id] = index
+		} else {
+			resp.Indexes = append(resp.Indexes, index.Index)
+		}
+	}
+
+	h.logger.Debugf("stub: request %d for %d instruments [%s, %s]", n, len(ids), from, to)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func every(n int64, each int) bool {
+	return each > 0 && n%int64(each) == 0
+}
+
+func writeError(w http.ResponseWriter, status int, message string, retryAfter time.Duration) {
+	writeJSON(w, status, model.STTMErrorResponse{Message: message, RetryAfter: retryAfter})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
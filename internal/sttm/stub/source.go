@@ -0,0 +1,84 @@
+package stub
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"time"
+
+	"github.com/STTM-NSU/trading-bot/internal/model"
+)
+
+// Source returns index of instrument for window, false if index isn't known
+type Source interface {
+	Index(instrumentId string, from, to time.Time) (model.STTMIndex, bool)
+}
+
+// Record is recorded response of sttm service for one instrument
+type Record struct {
+	InstrumentID string    `json:"instrument_id"`
+	From         time.Time `json:"from"`
+	To           time.Time `json:"to"`
+	Index        float64   `json:"index"`
+	PValue       float64   `json:"p_value"`
+	NewsCount    int       `json:"news_count"`
+}
+
+type recordKey struct {
+	instrumentId string
+	from, to     int64
+}
+
+// Fixture serves recorded indexes, not recorded ones aren't answered
+type Fixture struct {
+	records map[recordKey]model.STTMIndex
+}
+
+func NewFixture(records []Record) *Fixture {
+	f := &Fixture{records: make(map[recordKey]model.STTMIndex, len(records))}
+	for _, r := range records {
+		f.records[recordKey{r.InstrumentID, r.From.Unix(), r.To.Unix()}] = model.STTMIndex{
+			Index:     r.Index,
+			PValue:    r.PValue,
+			NewsCount: r.NewsCount,
+		}
+	}
+	return f
+}
+
+// LoadFixture reads json array of records
+func LoadFixture(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: can't read fixture", err)
+	}
+	var records []Record
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("%w: can't parse fixture", err)
+	}
+	return NewFixture(records), nil
+}
+
+func (f *Fixture) Index(instrumentId string, from, to time.Time) (model.STTMIndex, bool) {
+	index, ok := f.records[recordKey{instrumentId, from.Unix(), to.Unix()}]
+	return index, ok
+}
+
+// Synthetic generates index in [-1, 1] from hash of instrument, window and seed,
+// so the same request always gets the same index
+type Synthetic struct {
+	Seed uint64
+}
+
+func (s Synthetic) Index(instrumentId string, from, to time.Time) (model.STTMIndex, bool) {
+	h := fnv.New64a()
+	_, _ = fmt.Fprintf(h, "%s|%d|%d|%d", instrumentId, from.Unix(), to.Unix(), s.Seed)
+	v := h.Sum64()
+
+	return model.STTMIndex{
+		Index:     float64(v%2_000_001)/1_000_000 - 1,
+		PValue:    float64((v>>32)%1000) / 20_000, // below 0.05
+		NewsCount: int((v >> 48) % 100),
+	}, true
+}
@@ -0,0 +1,132 @@
+package sttm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/STTM-NSU/trading-bot/internal/config"
+	"github.com/STTM-NSU/trading-bot/internal/logger"
+	"github.com/STTM-NSU/trading-bot/internal/sttm/stub"
+)
+
+func TestGetIndexesWithStub(t *testing.T) {
+	l, sync, err := logger.NewZapLogger(logger.Error)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sync()
+
+	// the third request is rate limited and retried, the second instrument of every batch isn't answered
+	source := stub.Synthetic{Seed: 1}
+	srv := httptest.NewServer(stub.NewHandler(source, stub.Faults{
+		RateLimitEvery: 3,
+		RetryAfter:     time.Millisecond,
+		DropEvery:      2,
+	}, l).Mux())
+	defer srv.Close()
+
+	cfg := config.STTMConfig{Address: srv.URL}
+	if err := cfg.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Client.BatchSize, cfg.Client.Parallel = 2, 1
+
+	from := time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+	res, err := NewSTTMService(cfg, nil, l).GetIndexes(context.Background(), from, to, "a", "b", "c", "d", "e")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"a", "c", "e"} {
+		want, _ := source.Index(id, from, to)
+		if res.Values[id] != want.Index || res.Meta[id] != want {
+			t.Errorf("unexpected index of %s: %v", id, res.Values[id])
+		}
+	}
+	for _, id := range []string{"b", "d"} {
+		if _, ok := res.Values[id]; ok || res.Errors[id] == nil {
+			t.Errorf("%s must be reported as missing", id)
+		}
+	}
+}
+
+func TestBreakerFailedTrial(t *testing.T) {
+	l, _, err := logger.NewZapLogger(logger.Error)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// service fails, then trial request is bad one and the next trial succeeds
+	var requests atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch requests.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"message": "failure"}`))
+		case 2:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"message": "bad request"}`))
+		default:
+			_, _ = w.Write([]byte(`{"results": {"a": {"index": 0.5}}}`))
+		}
+	}))
+	defer srv.Close()
+
+	cfg := config.STTMConfig{Address: srv.URL}
+	if err := cfg.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Client.BreakerFailures, cfg.Client.BreakerCooldown, cfg.Client.RetryDelay = 1, 10*time.Millisecond, time.Millisecond
+	s := NewSTTMService(cfg, nil, l)
+
+	from := time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+	if _, err := s.GetIndexes(context.Background(), from, to, "a"); err == nil {
+		t.Fatal("breaker must be opened by failure")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if _, err := s.GetIndexes(context.Background(), from, to, "a"); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("trial request must fail with bad request, got %v", err)
+	}
+	res, err := s.GetIndexes(context.Background(), from, to, "a")
+	if err != nil {
+		t.Fatalf("failed trial mustn't leave breaker open: %v", err)
+	}
+	if res.Values["a"] != 0.5 {
+		t.Errorf("unexpected index %f", res.Values["a"])
+	}
+}
+
+func TestRateLimitWithoutRetryAfter(t *testing.T) {
+	l, _, err := logger.NewZapLogger(logger.Error)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every second request gets 429 without retry_after and is retried after retry delay
+	srv := httptest.NewServer(stub.NewHandler(stub.Synthetic{Seed: 1}, stub.Faults{RateLimitEvery: 2}, l).Mux())
+	defer srv.Close()
+
+	cfg := config.STTMConfig{Address: srv.URL}
+	if err := cfg.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Client.BatchSize, cfg.Client.Parallel, cfg.Client.RetryDelay = 1, 1, time.Millisecond
+
+	from := time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC)
+	res, err := NewSTTMService(cfg, nil, l).GetIndexes(context.Background(), from, from.Add(24*time.Hour), "a", "b", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Values) != 3 || len(res.Errors) != 0 {
+		t.Errorf("rate limited batches must be retried, got %d values, errors %v", len(res.Values), res.Errors)
+	}
+}
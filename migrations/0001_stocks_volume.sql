@@ -0,0 +1,2 @@
+-- hour candles volume in lots, used by volume slippage and bar participation limits of backtest
+ALTER TABLE stocks ADD COLUMN IF NOT EXISTS volume BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,8 @@
+-- splits and reverse splits, candles before ts are adjusted by ratio (new securities per old one)
+CREATE TABLE IF NOT EXISTS corporate_actions (
+    instrument_id TEXT NOT NULL,
+    type TEXT NOT NULL,
+    ts TIMESTAMP NOT NULL,
+    ratio DOUBLE PRECISION NOT NULL,
+    PRIMARY KEY (instrument_id, ts)
+);
@@ -0,0 +1,9 @@
+-- bracket legs of position: protective stop posted after buy fill and exit stop
+ALTER TABLE portfolio_instruments ADD COLUMN IF NOT EXISTS hedge_order_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE portfolio_instruments ADD COLUMN IF NOT EXISTS exit_order_id TEXT NOT NULL DEFAULT '';
+
+-- real and paper accounts can hold the same instrument
+ALTER TABLE portfolio_instruments DROP CONSTRAINT IF EXISTS portfolio_instruments_pkey;
+ALTER TABLE portfolio_instruments DROP CONSTRAINT IF EXISTS portfolio_instruments_instrument_id_key;
+CREATE UNIQUE INDEX IF NOT EXISTS portfolio_instruments_account_instrument
+    ON portfolio_instruments (account_id, instrument_id);
@@ -0,0 +1,15 @@
+-- fills of real and paper trading
+CREATE TABLE IF NOT EXISTS journal (
+    id BIGSERIAL PRIMARY KEY,
+    account_id TEXT NOT NULL,
+    instrument_id TEXT NOT NULL,
+    direction TEXT NOT NULL,
+    quantity DOUBLE PRECISION NOT NULL, -- in lots
+    price DOUBLE PRECISION NOT NULL,
+    amount DOUBLE PRECISION NOT NULL, -- with commission
+    commission DOUBLE PRECISION NOT NULL,
+    paper BOOLEAN NOT NULL DEFAULT FALSE,
+    ts TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS journal_account_ts ON journal (account_id, ts);
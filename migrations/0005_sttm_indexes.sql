@@ -0,0 +1,13 @@
+-- cached sttm indexes by instrument, window and hyperparameters of request
+CREATE TABLE IF NOT EXISTS sttm_indexes (
+    instrument_id TEXT NOT NULL,
+    ts_from TIMESTAMP NOT NULL,
+    ts_to TIMESTAMP NOT NULL,
+    alpha TEXT NOT NULL,
+    p_value TEXT NOT NULL,
+    threshold TEXT NOT NULL,
+    sttm_index DOUBLE PRECISION NOT NULL,
+    index_p_value DOUBLE PRECISION NOT NULL,
+    news_count INTEGER NOT NULL,
+    PRIMARY KEY (instrument_id, ts_from, ts_to, alpha, p_value, threshold)
+);